@@ -0,0 +1,106 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type RegistryRewrite struct {
+	Original string
+	Mirror   string
+}
+
+var (
+	offlineChartsDir string
+	registryRewrites []RegistryRewrite
+)
+
+func initAirgapConfig() {
+	offlineChartsDir = os.Getenv("OFFLINE_CHARTS_DIR")
+	registryRewrites = parseRegistryRewrites(os.Getenv("REGISTRY_REWRITES"))
+}
+
+// parseRegistryRewrites parses comma-separated list of original=mirror pairs,
+// i.e. "registry.example.com/charts=oci://mirror.registry.svc:5000/charts"
+func parseRegistryRewrites(rewriteList string) []RegistryRewrite {
+	var rewrites []RegistryRewrite
+	for _, rewrite := range strings.Split(rewriteList, ",") {
+		rewriteSplit := strings.SplitN(strings.TrimSpace(rewrite), "=", 2)
+		if len(rewriteSplit) == 2 && len(rewriteSplit[0]) > 0 && len(rewriteSplit[1]) > 0 {
+			rewrites = append(rewrites, RegistryRewrite{
+				Original: strings.TrimSuffix(stripUriScheme(rewriteSplit[0]), "/"),
+				Mirror:   strings.TrimSuffix(rewriteSplit[1], "/"),
+			})
+		}
+	}
+	return rewrites
+}
+
+func stripUriScheme(uri string) string {
+	for _, scheme := range []string{"oci://", "https://", "http://"} {
+		uri = strings.TrimPrefix(uri, scheme)
+	}
+	return uri
+}
+
+// rewriteArtUri replaces the longest matching original registry prefix of artUri with its mirror.
+// Scheme of the original uri is ignored when matching, scheme of the mirror is kept so that it drives OCI detection.
+func rewriteArtUri(artUri string) string {
+	artUriNoScheme := stripUriScheme(artUri)
+	var matchedRewrite *RegistryRewrite
+	for i, rewrite := range registryRewrites {
+		isPrefix := artUriNoScheme == rewrite.Original || strings.HasPrefix(artUriNoScheme, rewrite.Original+"/")
+		if isPrefix && (matchedRewrite == nil || len(rewrite.Original) > len(matchedRewrite.Original)) {
+			matchedRewrite = &registryRewrites[i]
+		}
+	}
+	if matchedRewrite == nil {
+		return artUri
+	}
+	rewrittenUri := matchedRewrite.Mirror + strings.TrimPrefix(artUriNoScheme, matchedRewrite.Original)
+	sugar.Debug("Rewrote artifact uri ", artUri, " to ", rewrittenUri)
+	return rewrittenUri
+}
+
+// offlineChartPath returns path of pre-seeded chart archive <chart>-<version>.tgz in OFFLINE_CHARTS_DIR.
+// The archive may be accompanied by <chart>-<version>.digest holding OCI manifest digest of the chart
+// and by <chart>-<version>.tgz.sig holding cosign signature of the archive.
+func offlineChartPath(helmRepoInfo HelmRepoInfo, version string) string {
+	return filepath.Join(offlineChartsDir, helmRepoInfo.ChartName+"-"+version+".tgz")
+}
+
+// restoreChartFromOfflineDir copies pre-seeded chart archive from OFFLINE_CHARTS_DIR into path.
+// Returns OCI manifest digest shipped with the archive, if any, and true if the chart was found.
+func restoreChartFromOfflineDir(path string, helmRepoInfo HelmRepoInfo, version string) (string, bool) {
+	if len(offlineChartsDir) < 1 {
+		return "", false
+	}
+	chartPath := offlineChartPath(helmRepoInfo, version)
+	if _, err := os.Stat(chartPath); err != nil {
+		sugar.Debug("Chart not found in offline charts directory: ", chartPath)
+		return "", false
+	}
+	_, _, err := shellout("cp " + chartPath + " " + path)
+	if err != nil {
+		return "", false
+	}
+	sugar.Info("Using pre-seeded chart ", chartPath)
+	manifestDigest, _ := os.ReadFile(strings.TrimSuffix(chartPath, ".tgz") + ".digest")
+	return strings.TrimSpace(string(manifestDigest)), true
+}
@@ -0,0 +1,51 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"testing"
+)
+
+func TestRewriteArtUri(t *testing.T) {
+	registryRewrites = parseRegistryRewrites("registry.example.com=oci://mirror.svc:5000,registry.example.com/charts/special=https://special-mirror.svc/charts, https://charts.bitnami.com/bitnami=oci://mirror.svc:5000/bitnami")
+	defer func() { registryRewrites = nil }()
+
+	testCases := map[string]string{
+		"registry.example.com/charts/app":          "oci://mirror.svc:5000/charts/app",
+		"oci://registry.example.com/charts/app":    "oci://mirror.svc:5000/charts/app",
+		"registry.example.com/charts/special/app":  "https://special-mirror.svc/charts/app",
+		"https://charts.bitnami.com/bitnami/redis": "oci://mirror.svc:5000/bitnami/redis",
+		"registry.example.com.evil.com/charts/app": "registry.example.com.evil.com/charts/app",
+		"other.example.com/charts/app":             "other.example.com/charts/app",
+	}
+	for artUri, expected := range testCases {
+		actual := rewriteArtUri(artUri)
+		if actual != expected {
+			t.Errorf("rewrite of %s: expected %s, got %s", artUri, expected, actual)
+		}
+	}
+}
+
+func TestGetHelmRepoInfoAppliesRewriteBeforeOciDetection(t *testing.T) {
+	registryRewrites = parseRegistryRewrites("charts.example.com=oci://mirror.svc:5000/charts")
+	defer func() { registryRewrites = nil }()
+
+	rd := RelizaDeployment{ArtUri: "https://charts.example.com/app"}
+	helmRepoInfo := GetHelmRepoInfoFromDeployment(&rd)
+	if !helmRepoInfo.UseOci || helmRepoInfo.OciUri != "oci://mirror.svc:5000/charts/app" || helmRepoInfo.RepoHost != "mirror.svc:5000/charts" {
+		t.Fatalf("unexpected helm repo info %+v", helmRepoInfo)
+	}
+}
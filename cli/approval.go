@@ -0,0 +1,299 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/relizaio/reliza-cd/utils"
+)
+
+const (
+	PendingChangeFile            = "pending-change.json"
+	PendingChangeYaml            = "pending-change.yaml"
+	PendingChangePrefix          = "rlz-pending-"
+	DeployedChangeDigestFile     = "deployed-change-digest"
+	ApprovedDigestAnnotation     = "reliza.io/approved-digest"
+	RequireApprovalProperty      = "REQUIRE_APPROVAL"
+	ApprovedChangeDigestProperty = "APPROVED_CHANGE_DIGEST"
+)
+
+var approvalNamespaces map[string]bool
+
+type PendingChange struct {
+	Digest          string `json:"digest"`
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	Bundle          string `json:"bundle"`
+	ArtUri          string `json:"artUri"`
+	ArtVersion      string `json:"artVersion"`
+	PreviousVersion string `json:"previousVersion"`
+	DetectedAt      string `json:"detectedAt"`
+	Status          string `json:"status"`
+}
+
+const (
+	PendingChangeStatusPending    = "PENDING"
+	PendingChangeStatusInstalled  = "INSTALLED"
+	PendingChangeStatusSuperseded = "SUPERSEDED"
+)
+
+func initApprovalConfig() {
+	approvalNamespaces = parseNamespaceList(os.Getenv("APPROVAL_NAMESPACES"))
+}
+
+// IsApprovalRequired returns true if changes to rd must be approved before install, either because
+// its namespace is listed in APPROVAL_NAMESPACES or because the bundle has REQUIRE_APPROVAL set to true on the Hub.
+func IsApprovalRequired(rd *RelizaDeployment) bool {
+	if approvalNamespaces[rd.Namespace] || approvalNamespaces["*"] {
+		return true
+	}
+	requireApproval, err := GetInstancePropertyForBundle(rd, RequireApprovalProperty)
+	return err == nil && strings.ToLower(strings.TrimSpace(requireApproval)) == "true"
+}
+
+// IsChangePending returns true if a change was detected on a previous loop which has not been installed yet
+// and is still the change resolved for rd. A pending change which no longer matches the current state, i.e. because
+// Hub reverted the bundle to the deployed version, is cleared.
+func IsChangePending(groupPath string, rd *RelizaDeployment) bool {
+	pendingChange, err := readPendingChange(groupPath)
+	if err != nil {
+		return false
+	}
+	digest, err := ComputeChangeDigest(groupPath, rd)
+	if err != nil {
+		sugar.Error("Failed to compute change digest: ", err)
+		return true
+	}
+	if pendingChange.Digest != digest {
+		sugar.Infow("Pending change no longer matches resolved state, clearing it",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"namespace", rd.Namespace,
+			"pendingDigest", pendingChange.Digest,
+			"digest", digest)
+		clearPendingChange(groupPath, rd, PendingChangeStatusSuperseded)
+		return false
+	}
+	return true
+}
+
+// ComputeChangeDigest produces a digest identifying the pending change - chart coordinates plus resolved values for diff,
+// or rendered manifests for manifests and kustomize deployments.
+func ComputeChangeDigest(groupPath string, rd *RelizaDeployment) (string, error) {
+	changeFile := ValuesDiff
+	if !IsHelmDeployment(rd) {
+		changeFile = ManifestsRendered
+	}
+	changeData, err := os.ReadFile(groupPath + changeFile)
+	if err != nil {
+		return "", err
+	}
+	hasher := sha256.New()
+	hasher.Write([]byte(rd.ArtUri + "\n" + rd.ArtVersion + "\n" + rd.ArtHash.Value + "\n"))
+	hasher.Write(changeData)
+	if argoOptions, err := os.ReadFile(groupPath + ArgoApplicationOptionsFile); err == nil && argoInfo.IsArgoEnabled {
+		hasher.Write(argoOptions)
+	}
+	return "sha256:" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// IsChangeApproved records the pending change for rd in the workspace and in a ConfigMap in the secrets namespace,
+// then checks whether an approval marker matching the change digest is present.
+// Approval is given either by annotating the ConfigMap with reliza.io/approved-digest
+// or by setting APPROVED_CHANGE_DIGEST instance property for the bundle on Reliza Hub.
+func IsChangeApproved(groupPath string, rd *RelizaDeployment) (bool, error) {
+	digest, err := ComputeChangeDigest(groupPath, rd)
+	if err != nil {
+		sugar.Error("Failed to compute change digest: ", err)
+		return false, err
+	}
+
+	if _, err := readPendingChange(groupPath); err == nil && digest == readDeployedChangeDigest(groupPath) {
+		// pending change was reverted to what is already deployed, nothing left to approve
+		sugar.Infow("Resolved state matches deployed state, no approval needed",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"namespace", rd.Namespace,
+			"digest", digest)
+		clearPendingChange(groupPath, rd, PendingChangeStatusSuperseded)
+		return false, nil
+	}
+
+	err = recordPendingChange(groupPath, rd, digest)
+	if err != nil {
+		return false, err
+	}
+
+	pendingName := PendingChangePrefix + rd.Name
+	approvedDigest, _, _ := shellout(KubectlApp + " get configmap " + pendingName + " -n " + SecretsNamespace + " -o jsonpath='{.metadata.annotations.reliza\\.io/approved-digest}'")
+	isApproved := strings.TrimSpace(approvedDigest) == digest
+
+	if !isApproved {
+		hubDigest, err := GetInstancePropertyForBundle(rd, ApprovedChangeDigestProperty)
+		isApproved = err == nil && strings.TrimSpace(hubDigest) == digest
+	}
+
+	if isApproved {
+		sugar.Infow("Change approved, proceeding with install",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"namespace", rd.Namespace,
+			"digest", digest)
+	} else {
+		sugar.Infow("Change is pending approval",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"namespace", rd.Namespace,
+			"digest", digest,
+			"approveWith", KubectlApp+" annotate configmap "+pendingName+" -n "+SecretsNamespace+" --overwrite "+ApprovedDigestAnnotation+"="+digest)
+	}
+	return isApproved, nil
+}
+
+// ClearPendingChange removes pending change record once the change has been installed
+// and records digest of the installed change.
+func ClearPendingChange(groupPath string, rd *RelizaDeployment) {
+	digest, err := ComputeChangeDigest(groupPath, rd)
+	if err == nil {
+		err = os.WriteFile(groupPath+DeployedChangeDigestFile, []byte(digest), 0600)
+	}
+	if err != nil {
+		sugar.Error(err)
+	}
+	clearPendingChange(groupPath, rd, PendingChangeStatusInstalled)
+}
+
+func clearPendingChange(groupPath string, rd *RelizaDeployment, status string) {
+	pendingChange, err := readPendingChange(groupPath)
+	if err != nil {
+		return
+	}
+	os.Remove(groupPath + PendingChangeFile)
+	os.Remove(groupPath + PendingChangeYaml)
+	os.Remove(groupPath + PendingValuesChange)
+	os.Remove(groupPath + PendingManifestDiff)
+	dryRunShellout(KubectlApp + " delete configmap " + PendingChangePrefix + rd.Name + " -n " + SecretsNamespace + " --ignore-not-found")
+	pendingChange.Status = status
+	reportToHub(PendingChangeReport, groupPath, rd, pendingChange)
+}
+
+func readPendingChange(groupPath string) (PendingChange, error) {
+	var pendingChange PendingChange
+	pendingData, err := os.ReadFile(groupPath + PendingChangeFile)
+	if err == nil {
+		err = json.Unmarshal(pendingData, &pendingChange)
+	}
+	return pendingChange, err
+}
+
+func readDeployedChangeDigest(groupPath string) string {
+	deployedDigest, err := os.ReadFile(groupPath + DeployedChangeDigestFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(deployedDigest))
+}
+
+func recordPendingChange(groupPath string, rd *RelizaDeployment, digest string) error {
+	pendingChange, _ := readPendingChange(groupPath)
+	if pendingChange.Digest == digest {
+		// already recorded on one of the previous loops
+		return nil
+	}
+
+	pendingChange = PendingChange{
+		Digest:     digest,
+		Name:       rd.Name,
+		Namespace:  rd.Namespace,
+		Bundle:     rd.Bundle,
+		ArtUri:     rd.ArtUri,
+		ArtVersion: rd.ArtVersion,
+		DetectedAt: time.Now().UTC().Format(time.RFC3339),
+		Status:     PendingChangeStatusPending,
+	}
+	recordedData, err := os.ReadFile(groupPath + RecordedDeloyedData)
+	if err == nil {
+		var deployedRd RelizaDeployment
+		json.Unmarshal(recordedData, &deployedRd)
+		pendingChange.PreviousVersion = deployedRd.ArtVersion
+	}
+
+	persistPendingDiff(groupPath)
+	valuesChanges, _ := os.ReadFile(groupPath + PendingValuesChange)
+
+	pendingYamlPath := groupPath + PendingChangeYaml
+	pendingYamlFile := utils.CreateFile(pendingYamlPath)
+	err = ProducePendingChangeYaml(pendingYamlFile, rd, digest, string(valuesChanges), SecretsNamespace)
+	pendingYamlFile.Close()
+	if err == nil {
+		err = KubectlApply(pendingYamlPath)
+	}
+	if err != nil {
+		sugar.Error("Failed to record pending change: ", err)
+		return err
+	}
+
+	// pending change is recorded locally only once its ConfigMap is applied, so that a failed apply is retried on the next loop
+	pcJson, err := json.Marshal(pendingChange)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	err = os.WriteFile(groupPath+PendingChangeFile, pcJson, 0600)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	reportToHub(PendingChangeReport, groupPath, rd, pendingChange)
+	sugar.Infow("Recorded pending change",
+		"bundle", rd.Bundle,
+		"version", rd.ArtVersion,
+		"previousVersion", pendingChange.PreviousVersion,
+		"namespace", rd.Namespace,
+		"digest", digest)
+	return nil
+}
+
+// ProducePendingChangeYaml produces ConfigMap holding the pending change digest and, when available,
+// values changes of the pending change for review by approvers.
+func ProducePendingChangeYaml(w io.Writer, rd *RelizaDeployment, digest string, valuesChanges string, namespace string) error {
+	pendingChange := k8sConfigMap{
+		ApiVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata: objectMetadata{
+			Name:        PendingChangePrefix + rd.Name,
+			Namespace:   namespace,
+			Annotations: cdResourceAnnotations(rd),
+			Labels:      cdResourceLabels(rd.Name),
+		},
+		Data: map[string]string{
+			"digest":  digest,
+			"bundle":  rd.Bundle,
+			"version": rd.ArtVersion,
+		},
+	}
+	if len(valuesChanges) > 0 {
+		pendingChange.Data["valuesChanges"] = valuesChanges
+	}
+	return writeYaml(w, pendingChange)
+}
@@ -0,0 +1,152 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeChangeDigest(t *testing.T) {
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	_, err := ComputeChangeDigest(groupPath, &rd)
+	if err == nil {
+		t.Fatal("expected error when values for diff are missing")
+	}
+
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 1\n"), 0600)
+	digest, err := ComputeChangeDigest(groupPath, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameDigest, _ := ComputeChangeDigest(groupPath, &rd)
+	if digest != sameDigest {
+		t.Errorf("digest is not stable: %s != %s", digest, sameDigest)
+	}
+
+	rd.ArtVersion = "1.2.4"
+	versionDigest, _ := ComputeChangeDigest(groupPath, &rd)
+	if versionDigest == digest {
+		t.Error("digest does not change with version")
+	}
+
+	rd.ArtVersion = "1.2.3"
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 2\n"), 0600)
+	valuesDigest, _ := ComputeChangeDigest(groupPath, &rd)
+	if valuesDigest == digest {
+		t.Error("digest does not change with values")
+	}
+}
+
+func TestChangeApprovalFlow(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		// approval annotation is served from approved-digest file next to the stub tools
+		"kubectl":    "case \"$*\" in *approved-digest*) cat \"$(dirname $0)/../approved-digest\" 2>/dev/null;; esac",
+		"reliza-cli": "echo '{\"properties\":[]}'",
+	})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 1\n"), 0600)
+	approved, err := IsChangeApproved(groupPath, &rd)
+	if err != nil || approved {
+		t.Fatalf("expected change to be pending, approved = %v, err = %v", approved, err)
+	}
+	pendingChange, err := readPendingChange(groupPath)
+	if err != nil || pendingChange.Status != PendingChangeStatusPending {
+		t.Fatalf("expected pending change to be recorded, got %+v, err = %v", pendingChange, err)
+	}
+	if len(fakeToolCalls(t, toolsPath, "reliza-cli instdata --images "+pendingChange.Digest+" --namespace prod --sender reliza-cd-pending-change-prod---my-app")) != 1 {
+		t.Error("expected pending change to be reported to the Hub")
+	}
+	if !IsChangePending(groupPath, &rd) {
+		t.Error("expected change to stay pending on the next loop")
+	}
+
+	os.WriteFile(filepath.Join(toolsPath, "approved-digest"), []byte(pendingChange.Digest), 0600)
+	approved, err = IsChangeApproved(groupPath, &rd)
+	if err != nil || !approved {
+		t.Fatalf("expected change to be approved, approved = %v, err = %v", approved, err)
+	}
+	ClearPendingChange(groupPath, &rd)
+	if IsChangePending(groupPath, &rd) {
+		t.Error("expected installed change to be cleared")
+	}
+	if readDeployedChangeDigest(groupPath) != pendingChange.Digest {
+		t.Error("expected installed change digest to be recorded")
+	}
+
+	// new change is detected, then Hub reverts to the deployed state
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 2\n"), 0600)
+	approved, _ = IsChangeApproved(groupPath, &rd)
+	if approved || !IsChangePending(groupPath, &rd) {
+		t.Fatal("expected new change to be pending")
+	}
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 1\n"), 0600)
+	approved, _ = IsChangeApproved(groupPath, &rd)
+	if approved {
+		t.Error("expected reverted change not to be installed")
+	}
+	if IsChangePending(groupPath, &rd) {
+		t.Error("expected reverted change to be cleared")
+	}
+	if _, err := os.Stat(groupPath + PendingChangeFile); !os.IsNotExist(err) {
+		t.Error("expected pending change file to be removed")
+	}
+}
+
+func TestStalePendingChangeIsCleared(t *testing.T) {
+	fakeTools(t, map[string]string{"reliza-cli": "echo '{\"properties\":[]}'"})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 2\n"), 0600)
+	IsChangeApproved(groupPath, &rd)
+	rd.ArtVersion = "1.2.2"
+	if IsChangePending(groupPath, &rd) {
+		t.Error("expected pending change for another version to be cleared")
+	}
+}
+
+func TestPendingChangeIsRetriedWhenApplyFails(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *apply*) [ -f \"$(dirname $0)/../apply-ok\" ] || exit 1;; esac",
+	})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 1\n"), 0600)
+	if _, err := IsChangeApproved(groupPath, &rd); err == nil {
+		t.Fatal("expected failed apply of pending change to be returned")
+	}
+	if IsChangePending(groupPath, &rd) {
+		t.Fatal("expected pending change not to be recorded when its ConfigMap is not applied")
+	}
+
+	os.WriteFile(filepath.Join(toolsPath, "apply-ok"), []byte{}, 0600)
+	if _, err := IsChangeApproved(groupPath, &rd); err != nil {
+		t.Fatal(err)
+	}
+	if !IsChangePending(groupPath, &rd) {
+		t.Fatal("expected pending change to be recorded once applied")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl apply", PendingChangeYaml)) != 2 {
+		t.Error("expected pending change ConfigMap apply to be retried")
+	}
+}
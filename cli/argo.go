@@ -20,27 +20,19 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/relizaio/reliza-cd/utils"
 )
 
-type ArgoApplicationTemplateResolver struct {
-	Name                string
-	ArgoNamespace       string
-	ReleaseNamespace    string
-	HelmChartName       string
-	MegedValuesFromFile string
-	ChartUri            string
-	Version             string
-}
 type ArgoInfo struct {
 	IsArgoDetected bool
 	IsArgoEnabled  bool
 	ArgoNamespace  string
 }
 
+// detectArgo detects Argo CD by presence of the Application CRD and locates its namespace from ARGO_NAMESPACE
+// or, when not set, from the namespace of argocd-cm ConfigMap
 func detectArgo() ArgoInfo {
 	var argoInfo ArgoInfo
 	argoInfo.IsArgoDetected = false
@@ -53,13 +45,11 @@ func detectArgo() ArgoInfo {
 	if argoInfo.IsArgoEnabled {
 		retryLeft := 3
 		for !argoInfo.IsArgoDetected && retryLeft > 0 {
-			argoDetectedOut, _, _ := shellout(KubectlApp + " get pods -A | grep argocd | wc -l")
-			argoDetectedOut = strings.Replace(argoDetectedOut, "\n", "", -1)
-			argoDetectedOutInt, err := strconv.Atoi(argoDetectedOut)
-
+			argoCrdOut, _, err := shellout(KubectlApp + " get crd applications.argoproj.io --ignore-not-found -o name")
 			if err != nil {
 				sugar.Error(err)
-			} else if argoDetectedOutInt > 0 {
+			}
+			if len(strings.TrimSpace(argoCrdOut)) > 0 {
 				argoInfo.IsArgoDetected = true
 			} else {
 				retryLeft--
@@ -68,122 +58,108 @@ func detectArgo() ArgoInfo {
 			}
 		}
 
-		argoInfo.ArgoNamespace, _, _ = shellout(KubectlApp + " get secrets -A | grep argocd-initial-admin-secret | awk '{ print $1 }'")
-		argoInfo.ArgoNamespace = strings.Replace(argoInfo.ArgoNamespace, "\n", "", -1)
-
+		if argoInfo.IsArgoDetected {
+			argoInfo.ArgoNamespace = resolveArgoNamespace()
+		}
 	}
 
 	return argoInfo
 }
 
-func IsFirstArgoInstallDone(rd *RelizaDeployment) bool {
-	isFirstInstallDone := false
-	argoAppListOut, _, _ := shellout(KubectlApp + " kubectl get applications -A | grep " + rd.Name + " | wc -l")
-	argoAppListOut = strings.Replace(argoAppListOut, "\n", "", -1)
-	argoAppListOutInt, err := strconv.Atoi(argoAppListOut)
-
-	if err != nil {
-		sugar.Error(err)
-	} else if argoAppListOutInt > 0 {
-		isFirstInstallDone = true
+func resolveArgoNamespace() string {
+	argoNamespace := os.Getenv("ARGO_NAMESPACE")
+	if len(argoNamespace) < 1 {
+		argoNamespace, _, _ = shellout(KubectlApp + " get configmap -A --field-selector metadata.name=argocd-cm -o jsonpath='{.items[0].metadata.namespace}'")
+		argoNamespace = strings.TrimSpace(argoNamespace)
 	}
-	return isFirstInstallDone
+	sugar.Info("Using argocd namespace ", argoNamespace)
+	return argoNamespace
 }
 
-func indent(s string, n int) string {
-	s = strings.TrimSpace(s)
-	indentStr := strings.Repeat(" ", n)
-	lines := strings.Split(s, "\n")
-	for i, line := range lines {
-		lines[i] = indentStr + line
+// IsFirstArgoInstallDone returns true if Argo CD Application of rd exists, looked up by its exact reliza.io/name label
+func IsFirstArgoInstallDone(rd *RelizaDeployment) bool {
+	argoAppListOut, _, err := shellout(KubectlApp + " get applications -n " + SecretsNamespace + " -l 'reliza.io/type=cdresource,reliza.io/name=" + rd.Name + "' -o name")
+	if err != nil {
+		sugar.Error(err)
 	}
-	return strings.Join(lines, "\n")
+	return len(strings.TrimSpace(argoAppListOut)) > 0
 }
 
-func ProduceArgoApplicationYaml(w io.Writer, rd *RelizaDeployment, namespace, groupPath string) error {
-	applicationTmpl :=
-		`apiVersion: argoproj.io/v1alpha1	
-kind: Application
-metadata:
-  name: {{.Name}}
-  namespace: {{.ArgoNamespace}}
-  finalizers:
-    - resources-finalizer.argocd.argoproj.io
-  labels:
-    reliza.io/type: cdresource
-    reliza.io/name: {{.Name}}
-spec:
-  syncPolicy:
-    automated: {}
-  destination:
-    namespace: {{.ReleaseNamespace}}
-    server: https://kubernetes.default.svc
-  project: default
-  source:
-    chart: {{.HelmChartName}}
-    helm:
-      values: |
-{{ indent .MegedValuesFromFile 8 }}
-    repoURL: {{.ChartUri}}
-    targetRevision: {{.Version}}`
-
+func ProduceArgoApplicationYaml(w io.Writer, rd *RelizaDeployment, namespace, groupPath string, appOptions ArgoApplicationOptions) error {
 	helmRepoInfo := GetHelmRepoInfoFromDeployment(rd)
 
 	helmValues, err := os.ReadFile(groupPath + InstallValues)
 	if err != nil {
 		sugar.Error(err)
+		return err
 	}
 
-	argoAppTmplRes := ArgoApplicationTemplateResolver{
-		Name:                rd.Name,
-		ArgoNamespace:       namespace,
-		ReleaseNamespace:    rd.Namespace,
-		HelmChartName:       helmRepoInfo.ChartName,
-		ChartUri:            helmRepoInfo.RepoHost,
-		Version:             rd.ArtVersion,
-		MegedValuesFromFile: string(helmValues),
-	}
+	chartUri := helmRepoInfo.RepoHost
 	if !helmRepoInfo.UseOci {
-		argoAppTmplRes.ChartUri = helmRepoInfo.RepoUri
+		chartUri = helmRepoInfo.RepoUri
 	}
-	funcMap := template.FuncMap{
-		"indent": indent,
-	}
-	tmpl, err := template.New("applicationtmpl").Funcs(funcMap).Parse(applicationTmpl)
-	if err != nil {
-		panic(err)
-	}
-
-	err = tmpl.Execute(w, argoAppTmplRes)
-	if err != nil {
-		panic(err)
+	application := argoApplication{
+		ApiVersion: "argoproj.io/v1alpha1",
+		Kind:       "Application",
+		Metadata: objectMetadata{
+			Name:        rd.Name,
+			Namespace:   namespace,
+			Annotations: cdResourceAnnotations(rd),
+			Finalizers:  []string{"resources-finalizer.argocd.argoproj.io"},
+			Labels:      cdResourceLabels(rd.Name),
+		},
+		Spec: argoApplicationSpec{
+			Destination: resolveArgoDestination(rd),
+			Source: argoApplicationSource{
+				Chart:          helmRepoInfo.ChartName,
+				Helm:           argoHelmSource{Values: string(helmValues)},
+				RepoURL:        chartUri,
+				TargetRevision: rd.ArtVersion,
+			},
+		},
 	}
-	return err
+	applyArgoApplicationOptions(&application, appOptions)
+	return writeYaml(w, application)
 }
 
 func installArgoApplication(groupPath string, rd *RelizaDeployment, argoNameSpace string) error {
 
 	applicationPath := groupPath + "argo-app.yaml"
 	applicationFile := utils.CreateFile(applicationPath)
-	err := ProduceArgoApplicationYaml(applicationFile, rd, SecretsNamespace, groupPath)
+	err := ProduceArgoApplicationYaml(applicationFile, rd, SecretsNamespace, groupPath, readArgoApplicationOptions(groupPath, rd))
+	applicationFile.Close()
 
 	if err != nil {
 		return err
 	}
-	CreateNamespaceIfMissing(rd.Namespace)
-	KubectlApply(applicationPath)
-	return nil
+	CreateNamespaceIfMissing(rd.Namespace, ClusterFlags(rd))
+	err = KubectlApply(applicationPath)
+	if err == nil {
+		recordAppliedArgoApplicationOptions(groupPath)
+		WaitForArgoApplication(rd)
+	}
+	return err
+}
+
+// argoInstallNamespace returns namespace for Argo CD installed in NEW_ARGO mode, ARGO_NAMESPACE or argocd if not set
+func argoInstallNamespace() string {
+	argoNamespace := os.Getenv("ARGO_NAMESPACE")
+	if len(argoNamespace) < 1 {
+		argoNamespace = "argocd"
+	}
+	return argoNamespace
 }
 
 func installArgoCD() {
-	sugar.Info("Installing argocd")
+	argoNamespace := argoInstallNamespace()
+	sugar.Info("Installing argocd in namespace ", argoNamespace)
 	dryRunShellout(HelmApp + " repo add argo https://argoproj.github.io/argo-helm")
 	dryRunShellout(HelmApp + " repo update")
 	retryLeft := 3
 	argocdInstalled := false
 	argoVersion := os.Getenv("ARGO_HELM_VERSION")
 	for !argocdInstalled && retryLeft > 0 {
-		_, _, err := dryRunShellout(HelmApp + " upgrade --install --create-namespace --set dex.enabled=false --set notifications.enabled=false --set applicationSet.enabled=false --set configs.params.server.insecure=true -n argocd argocd argo/argo-cd --version " + argoVersion)
+		_, _, err := dryRunShellout(HelmApp + " upgrade --install --create-namespace --set dex.enabled=false --set notifications.enabled=false --set applicationSet.enabled=" + strconv.FormatBool(useApplicationSet) + " --set configs.params.server.insecure=true -n " + argoNamespace + " argocd argo/argo-cd --version " + argoVersion)
 		if err == nil {
 			argocdInstalled = true
 		} else {
@@ -193,7 +169,7 @@ func installArgoCD() {
 		}
 	}
 	sugar.Info("Waiting for argocd installation to complete ...")
-	dryRunShellout("while ! " + KubectlApp + " get secrets -A | grep argocd-initial-admin-secret; do sleep 1; done")
+	dryRunShellout("while ! " + KubectlApp + " get configmap argocd-cm -n " + argoNamespace + "; do sleep 1; done")
 	sugar.Info("argocd installation complete.")
 
 }
@@ -0,0 +1,38 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"testing"
+)
+
+func TestInstallArgoCDUsesArgoNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		argoNamespace string
+		expected      string
+	}{{"", "argocd"}, {"gitops", "gitops"}} {
+		t.Setenv("ARGO_NAMESPACE", tc.argoNamespace)
+		toolsPath := fakeTools(t, map[string]string{})
+		installArgoCD()
+		if calls := fakeToolCalls(t, toolsPath, "helm upgrade --install", "-n "+tc.expected+" argocd argo/argo-cd"); len(calls) != 1 {
+			t.Errorf("expected argocd to be installed in %s, got %v", tc.expected, fakeToolCalls(t, toolsPath, "helm upgrade"))
+		}
+		if calls := fakeToolCalls(t, toolsPath, "kubectl get configmap argocd-cm -n "+tc.expected); len(calls) != 1 {
+			t.Errorf("expected installation to be awaited in %s, got %v", tc.expected, fakeToolCalls(t, toolsPath, "kubectl"))
+		}
+	}
+}
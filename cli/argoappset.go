@@ -0,0 +1,317 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ApplicationSetElementFile = "appset-element.json"
+	ApplicationSetName        = "reliza-cd"
+	argoApplicationSetFile    = "application-set.yaml"
+)
+
+// ApplicationSetElement holds parameters of a single deployment in the list generator of reliza-cd ApplicationSet
+type ApplicationSetElement struct {
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Bundle    string `json:"bundle" yaml:"bundle"`
+	Chart     string `json:"chart" yaml:"chart"`
+	RepoUrl   string `json:"repoURL" yaml:"repoURL"`
+	Version   string `json:"version" yaml:"version"`
+	Values    string `json:"values" yaml:"values"`
+	Project   string `json:"project" yaml:"project"`
+	Server    string `json:"server" yaml:"server"`
+	Cluster   string `json:"cluster" yaml:"cluster"`
+	// per-bundle ARGO_APPLICATION_OPTIONS, applied by templatePatch of the ApplicationSet
+	SyncPolicy        argoSyncPolicy           `json:"syncPolicy" yaml:"syncPolicy"`
+	IgnoreDifferences []map[string]interface{} `json:"ignoreDifferences" yaml:"ignoreDifferences"`
+	Annotations       map[string]string        `json:"annotations" yaml:"annotations"`
+}
+
+// applicationSetTemplatePatch applies options of each element over the Application template, options are always set
+// on elements, so that missingkey=error does not fail on them
+const applicationSetTemplatePatch = `metadata:
+  annotations: {{ toJson .annotations }}
+spec:
+  syncPolicy: {{ toJson .syncPolicy }}
+  ignoreDifferences: {{ toJson .ignoreDifferences }}
+`
+
+var (
+	useApplicationSet        bool
+	appliedApplicationSetYml string
+	// pendingElements holds deployments whose elements were recorded but not yet applied with the ApplicationSet
+	pendingElements = map[string]pendingElement{}
+)
+
+type pendingElement struct {
+	groupPath string
+	rd        RelizaDeployment
+}
+
+func initApplicationSetConfig() {
+	useApplicationSet = strings.ToLower(os.Getenv("ARGO_APPLICATIONSET")) == "true"
+}
+
+// IsApplicationSetMode returns true if Argo CD Applications are generated from a single ApplicationSet
+func IsApplicationSetMode() bool {
+	return argoInfo.IsArgoEnabled && useApplicationSet
+}
+
+// recordApplicationSetElement records list generator element of rd in its workspace, the ApplicationSet is updated
+// from elements of all deployments once the loop is done, see ApplyApplicationSet. Deployed data of rd is recorded
+// once the ApplicationSet with the element is applied.
+func recordApplicationSetElement(groupPath string, rd *RelizaDeployment) error {
+	helmRepoInfo := GetHelmRepoInfoFromDeployment(rd)
+	helmValues, err := os.ReadFile(groupPath + InstallValues)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	chartUri := helmRepoInfo.RepoHost
+	if !helmRepoInfo.UseOci {
+		chartUri = helmRepoInfo.RepoUri
+	}
+	destination := resolveArgoDestination(rd)
+	// resolve options the same way as for Application, annotations of the template are kept by the patch
+	optionsApplication := argoApplication{Metadata: objectMetadata{Annotations: map[string]string{}}}
+	applyArgoApplicationOptions(&optionsApplication, readArgoApplicationOptions(groupPath, rd))
+	ignoreDifferences := optionsApplication.Spec.IgnoreDifferences
+	if ignoreDifferences == nil {
+		ignoreDifferences = []map[string]interface{}{}
+	}
+	element := ApplicationSetElement{
+		Name:              rd.Name,
+		Namespace:         rd.Namespace,
+		Bundle:            rd.Bundle,
+		Chart:             helmRepoInfo.ChartName,
+		RepoUrl:           chartUri,
+		Version:           rd.ArtVersion,
+		Values:            string(helmValues),
+		Project:           optionsApplication.Spec.Project,
+		Server:            destination.Server,
+		Cluster:           destination.Name,
+		SyncPolicy:        optionsApplication.Spec.SyncPolicy,
+		IgnoreDifferences: ignoreDifferences,
+		Annotations:       optionsApplication.Metadata.Annotations,
+	}
+	elementJson, err := json.Marshal(element)
+	if err == nil {
+		err = os.WriteFile(groupPath+ApplicationSetElementFile, elementJson, 0600)
+	}
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	pendingElements[rd.Name] = pendingElement{groupPath: groupPath, rd: *rd}
+	CreateNamespaceIfMissing(rd.Namespace, ClusterFlags(rd))
+	sugar.Infow("Recorded ApplicationSet element",
+		"bundle", rd.Bundle,
+		"version", rd.ArtVersion,
+		"namespace", rd.Namespace)
+	return nil
+}
+
+// EnsureApplicationSetElement records list generator element of rd installed before ApplicationSet mode was enabled
+func EnsureApplicationSetElement(groupPath string, rd *RelizaDeployment) {
+	if !IsApplicationSetMode() {
+		return
+	}
+	if _, err := os.Stat(groupPath + ApplicationSetElementFile); err == nil {
+		return
+	}
+	recordApplicationSetElement(groupPath, rd)
+}
+
+// ApplyApplicationSet applies reliza-cd ApplicationSet with list generator elements of all deployments still present in
+// the workspace, Argo CD creates, updates and prunes Applications accordingly. Elements of removed deployments are dropped
+// by DeleteObsoleteDeployment once deletion protection allows. ApplicationSet which would drop more than
+// MAX_DELETIONS_PER_LOOP elements, i.e. after the workspace was lost, is not applied. Once applied, deployed data
+// of deployments with recorded elements is recorded.
+func ApplyApplicationSet() error {
+	if !IsApplicationSetMode() {
+		return nil
+	}
+	elements := workspaceApplicationSetElements()
+	var appSetYaml bytes.Buffer
+	err := ProduceApplicationSetYaml(&appSetYaml, SecretsNamespace, elements)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	if appliedApplicationSetYml == appSetYaml.String() {
+		recordPendingElementsDeployed()
+		return nil
+	}
+	err = checkApplicationSetShrink(elements)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(argoProjectDir, 0700)
+	appSetPath := filepath.Join(argoProjectDir, argoApplicationSetFile)
+	err = os.WriteFile(appSetPath, appSetYaml.Bytes(), 0600)
+	if err == nil {
+		err = KubectlApply(appSetPath)
+	}
+	if err != nil {
+		sugar.Errorw("Failed to apply ApplicationSet", "name", ApplicationSetName, "error", err)
+		return err
+	}
+	appliedApplicationSetYml = appSetYaml.String()
+	sugar.Info("Applied ApplicationSet ", ApplicationSetName, " with ", len(elements), " elements")
+	recordPendingElementsDeployed()
+	return nil
+}
+
+// recordPendingElementsDeployed records deployed data of deployments whose elements were applied with the ApplicationSet
+func recordPendingElementsDeployed() {
+	for name, pending := range pendingElements {
+		delete(pendingElements, name)
+		if _, err := os.Stat(pending.groupPath + ApplicationSetElementFile); err != nil {
+			// deleted meanwhile
+			continue
+		}
+		recordAppliedArgoApplicationOptions(pending.groupPath)
+		RecordDeployedData(pending.groupPath, &pending.rd)
+		ClearPendingChange(pending.groupPath, &pending.rd)
+	}
+}
+
+// workspaceApplicationSetElements returns recorded elements of all deployments in the workspace
+func workspaceApplicationSetElements() []ApplicationSetElement {
+	var elements []ApplicationSetElement
+	workspaceEntries, err := os.ReadDir("workspace")
+	if err != nil {
+		sugar.Error(err)
+	}
+	for _, we := range workspaceEntries {
+		elementJson, err := os.ReadFile(filepath.Join("workspace", we.Name(), ApplicationSetElementFile))
+		if err != nil {
+			// not a deployment, not installed yet or already deleted
+			continue
+		}
+		var element ApplicationSetElement
+		if json.Unmarshal(elementJson, &element) == nil {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// checkApplicationSetShrink returns error if more than MAX_DELETIONS_PER_LOOP elements of the live ApplicationSet
+// are missing from elements
+func checkApplicationSetShrink(elements []ApplicationSetElement) error {
+	if deletionProtectionConfig.MaxDeletionsPerLoop <= 0 {
+		return nil
+	}
+	liveNames, stderr, err := shellout(KubectlApp + " get applicationset " + ApplicationSetName + " -n " + SecretsNamespace +
+		" --ignore-not-found -o jsonpath='{.spec.generators[0].list.elements[*].name}'")
+	if err != nil {
+		sugar.Errorw("Failed to read ApplicationSet, not applying it", "name", ApplicationSetName, "error", err, "stderr", stderr)
+		return err
+	}
+	names := map[string]bool{}
+	for _, element := range elements {
+		names[element.Name] = true
+	}
+	var dropped []string
+	for _, name := range strings.Fields(liveNames) {
+		if !names[name] {
+			dropped = append(dropped, name)
+		}
+	}
+	if len(dropped) > deletionProtectionConfig.MaxDeletionsPerLoop {
+		sugar.Errorw("ApplicationSet update would remove more elements than allowed per loop, not applying it",
+			"name", ApplicationSetName,
+			"removedElements", dropped,
+			"maxDeletionsPerLoop", deletionProtectionConfig.MaxDeletionsPerLoop)
+		return errors.New("ApplicationSet update would remove " + strconv.Itoa(len(dropped)) + " elements")
+	}
+	return nil
+}
+
+// removeApplicationSetElement removes element of the deployment in groupPath and applies the ApplicationSet without it,
+// returns false and restores the element if the ApplicationSet could not be applied
+func removeApplicationSetElement(groupPath string) bool {
+	elementPath := groupPath + ApplicationSetElementFile
+	elementJson, err := os.ReadFile(elementPath)
+	if err != nil {
+		return true
+	}
+	os.Remove(elementPath)
+	if ApplyApplicationSet() != nil {
+		os.WriteFile(elementPath, elementJson, 0600)
+		return false
+	}
+	return true
+}
+
+func ProduceApplicationSetYaml(w io.Writer, namespace string, elements []ApplicationSetElement) error {
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i].Name < elements[j].Name
+	})
+	if elements == nil {
+		elements = []ApplicationSetElement{}
+	}
+	templateLabels := cdResourceLabels("{{.name}}")
+	templateApplication := argoApplication{
+		Metadata: objectMetadata{
+			Name:        "{{.name}}",
+			Namespace:   namespace,
+			Annotations: map[string]string{"reliza.io/bundle": "{{.bundle}}", "reliza.io/version": "{{.version}}"},
+			Finalizers:  []string{"resources-finalizer.argocd.argoproj.io"},
+			Labels:      templateLabels,
+		},
+		Spec: argoApplicationSpec{
+			Destination: argoDestination{Namespace: "{{.namespace}}", Server: "{{.server}}", Name: "{{.cluster}}"},
+			Source: argoApplicationSource{
+				Chart:          "{{.chart}}",
+				Helm:           argoHelmSource{Values: "{{.values}}"},
+				RepoURL:        "{{.repoURL}}",
+				TargetRevision: "{{.version}}",
+			},
+		},
+	}
+	templateApplication.Spec.Project = "{{.project}}"
+
+	appSet := argoApplicationSet{
+		ApiVersion: "argoproj.io/v1alpha1",
+		Kind:       "ApplicationSet",
+		Metadata: objectMetadata{
+			Name:      ApplicationSetName,
+			Namespace: namespace,
+			Labels:    namespaceOwnershipLabels(),
+		},
+		Spec: argoApplicationSetSpec{
+			GoTemplate:        true,
+			GoTemplateOptions: []string{"missingkey=error"},
+			Generators:        []argoGenerator{{List: argoListGenerator{Elements: elements}}},
+			Template:          argoApplicationTemplate{Metadata: templateApplication.Metadata, Spec: templateApplication.Spec},
+			TemplatePatch:     applicationSetTemplatePatch,
+		},
+	}
+	return writeYaml(w, appSet)
+}
@@ -0,0 +1,163 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProduceApplicationSetYamlGolden(t *testing.T) {
+	prodOptions := argoApplication{Metadata: objectMetadata{Annotations: map[string]string{}}}
+	applyArgoApplicationOptions(&prodOptions, parseArgoApplicationOptions("test", "prune: true\nsyncOptions:\n  - CreateNamespace=true\n"+
+		"ignoreDifferences:\n  - group: apps\n    kind: Deployment\n    jsonPointers:\n      - /spec/replicas\n"+
+		"annotations:\n  notifications.argoproj.io/subscribe.on-sync-failed.slack: deployments\n"))
+	elements := []ApplicationSetElement{
+		{Name: "prod---web", Namespace: "prod", Bundle: "Web", Chart: "web", RepoUrl: "https://charts.example.com", Version: "2.0.0",
+			Values: "replicaCount: 3\n", Project: "reliza", Server: "https://kubernetes.default.svc",
+			SyncPolicy: prodOptions.Spec.SyncPolicy, IgnoreDifferences: prodOptions.Spec.IgnoreDifferences, Annotations: prodOptions.Metadata.Annotations},
+		{Name: "eu---my-app", Namespace: "eu", Bundle: "My Bundle", Chart: "my-app", RepoUrl: "registry.example.com/charts", Version: "1.2.3",
+			Values: "replicaCount: 2\n", Project: "reliza", Cluster: "eu-prod",
+			SyncPolicy: argoSyncPolicy{Automated: &argoSyncAutomated{SelfHeal: true}}, IgnoreDifferences: []map[string]interface{}{}, Annotations: map[string]string{}},
+	}
+	var appSetYaml bytes.Buffer
+	err := ProduceApplicationSetYaml(&appSetYaml, "argocd", elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "application-set.yaml", appSetYaml.Bytes())
+}
+
+// setupApplicationSetWorkspace enables ApplicationSet mode and records elements of names in the workspace, kubectl reports
+// names listed in live-elements of the returned tools directory as elements of the live ApplicationSet
+func setupApplicationSetWorkspace(t *testing.T, names ...string) string {
+	t.Chdir(t.TempDir())
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *'get applicationset'*) cat $(dirname $0)/../live-elements;; esac",
+	})
+	prevArgoEnabled, prevUseApplicationSet, prevMaxDeletions := argoInfo.IsArgoEnabled, useApplicationSet, deletionProtectionConfig.MaxDeletionsPerLoop
+	t.Cleanup(func() {
+		argoInfo.IsArgoEnabled, useApplicationSet, deletionProtectionConfig.MaxDeletionsPerLoop = prevArgoEnabled, prevUseApplicationSet, prevMaxDeletions
+		appliedApplicationSetYml = ""
+	})
+	argoInfo.IsArgoEnabled, useApplicationSet, deletionProtectionConfig.MaxDeletionsPerLoop = true, true, 1
+	appliedApplicationSetYml = ""
+	for _, name := range names {
+		rd := RelizaDeployment{Name: name, Namespace: getNamespaceFromDeploymentName(name)}
+		os.MkdirAll(filepath.Join("workspace", name), 0700)
+		elementJson, _ := json.Marshal(ApplicationSetElement{Name: name, Namespace: rd.Namespace})
+		recordedJson, _ := json.Marshal(rd)
+		if err := os.WriteFile(filepath.Join("workspace", name, ApplicationSetElementFile), elementJson, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join("workspace", name, RecordedDeloyedData), recordedJson, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return toolsPath
+}
+
+func TestApplicationSetIsNotShrunkBeyondDeletionLimit(t *testing.T) {
+	toolsPath := setupApplicationSetWorkspace(t, "prod---web")
+	os.WriteFile(filepath.Join(toolsPath, "live-elements"), []byte("prod---web prod---api prod---worker"), 0600)
+	if err := ApplyApplicationSet(); err == nil {
+		t.Fatal("expected ApplicationSet dropping two elements to be refused")
+	}
+	if calls := fakeToolCalls(t, toolsPath, "kubectl apply"); len(calls) != 0 {
+		t.Fatalf("expected ApplicationSet not to be applied, got %v", calls)
+	}
+
+	os.WriteFile(filepath.Join(toolsPath, "live-elements"), []byte("prod---web prod---api"), 0600)
+	if err := ApplyApplicationSet(); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fakeToolCalls(t, toolsPath, "kubectl apply", "application-set.yaml"); len(calls) != 1 {
+		t.Fatalf("expected ApplicationSet dropping one element to be applied, got %v", calls)
+	}
+}
+
+func TestObsoleteDeploymentIsPrunedThroughApplicationSet(t *testing.T) {
+	toolsPath := setupApplicationSetWorkspace(t, "prod---web", "prod---api")
+	os.WriteFile(filepath.Join(toolsPath, "live-elements"), []byte("prod---web prod---api"), 0600)
+	if err := ApplyApplicationSet(); err != nil {
+		t.Fatal(err)
+	}
+
+	DeleteObsoleteDeployment("workspace/prod---api/")
+	if calls := fakeToolCalls(t, toolsPath, "kubectl apply", "application-set.yaml"); len(calls) != 2 {
+		t.Fatalf("expected ApplicationSet to be applied without the element, got %v", calls)
+	}
+	if calls := fakeToolCalls(t, toolsPath, "delete application"); len(calls) != 0 {
+		t.Fatalf("expected the application to be pruned by Argo CD, got %v", calls)
+	}
+	elements := workspaceApplicationSetElements()
+	if len(elements) != 1 || elements[0].Name != "prod---web" {
+		t.Fatalf("expected only element of remaining deployment, got %v", elements)
+	}
+	if _, err := os.Stat("workspace/prod---api"); !os.IsNotExist(err) {
+		t.Fatal("expected workspace of deleted deployment to be removed")
+	}
+}
+
+func TestObsoleteDeploymentIsKeptWhenApplicationSetUpdateFails(t *testing.T) {
+	toolsPath := setupApplicationSetWorkspace(t, "prod---web", "prod---api", "prod---worker")
+	// live ApplicationSet has elements of deployments already gone from the workspace
+	os.WriteFile(filepath.Join(toolsPath, "live-elements"), []byte("prod---web prod---api prod---worker prod---old"), 0600)
+
+	DeleteObsoleteDeployment("workspace/prod---api/")
+	if calls := fakeToolCalls(t, toolsPath, "delete application"); len(calls) != 0 {
+		t.Fatalf("expected application not to be deleted, got %v", calls)
+	}
+	if _, err := os.Stat("workspace/prod---api/" + ApplicationSetElementFile); err != nil {
+		t.Fatal("expected element to be restored for retry on the next loop")
+	}
+}
+
+func TestDeployedDataIsRecordedOnceApplicationSetIsApplied(t *testing.T) {
+	toolsPath := setupApplicationSetWorkspace(t, "prod---web")
+	t.Cleanup(func() { pendingElements = map[string]pendingElement{} })
+	rd := RelizaDeployment{Name: "prod---api", Namespace: "prod", ArtVersion: "1.2.3"}
+	groupPath := "workspace/prod---api/"
+	os.MkdirAll(groupPath, 0700)
+	os.WriteFile(groupPath+InstallValues, []byte("replicaCount: 2\n"), 0600)
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicaCount: 2\n"), 0600)
+	if err := InstallApplication(groupPath, &rd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(groupPath + RecordedDeloyedData); err == nil {
+		t.Fatal("expected deployed data not to be recorded before the ApplicationSet is applied")
+	}
+
+	// live ApplicationSet lost elements of more deployments than may be deleted per loop
+	os.WriteFile(filepath.Join(toolsPath, "live-elements"), []byte("prod---web prod---old prod---older"), 0600)
+	if ApplyApplicationSet() == nil {
+		t.Fatal("expected ApplicationSet update to be refused")
+	}
+	if _, err := os.Stat(groupPath + RecordedDeloyedData); err == nil {
+		t.Fatal("expected deployed data not to be recorded when the ApplicationSet is not applied")
+	}
+
+	os.WriteFile(filepath.Join(toolsPath, "live-elements"), []byte("prod---web"), 0600)
+	if err := ApplyApplicationSet(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(groupPath + RecordedDeloyedData); err != nil {
+		t.Fatal("expected deployed data to be recorded once the ApplicationSet is applied")
+	}
+}
@@ -0,0 +1,304 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ArgoApplicationOptionsProperty = "ARGO_APPLICATION_OPTIONS"
+	// builtinArgoProject is the default project of Argo CD, which is used as is when set with ARGO_PROJECT
+	builtinArgoProject = "default"
+	defaultArgoProject = "reliza-cd"
+	argoProjectDir     = "argo"
+	argoProjectFile    = "app-project.yaml"
+	// ArgoApplicationOptionsFile holds ARGO_APPLICATION_OPTIONS resolved on the current loop, AppliedArgoApplicationOptionsFile
+	// those of the last applied Application
+	ArgoApplicationOptionsFile        = "argo-app-options.yaml"
+	AppliedArgoApplicationOptionsFile = "applied-argo-app-options.yaml"
+)
+
+// ArgoApplicationOptions customizes generated Argo CD Applications. Options set per bundle override defaults field by field.
+type ArgoApplicationOptions struct {
+	Project           string                   `yaml:"project"`
+	Automated         *bool                    `yaml:"automated"`
+	Prune             *bool                    `yaml:"prune"`
+	SelfHeal          *bool                    `yaml:"selfHeal"`
+	SyncOptions       []string                 `yaml:"syncOptions"`
+	Retry             map[string]interface{}   `yaml:"retry"`
+	IgnoreDifferences []map[string]interface{} `yaml:"ignoreDifferences"`
+	Annotations       map[string]string        `yaml:"annotations"`
+}
+
+var (
+	argoApplicationDefaults     ArgoApplicationOptions
+	argoProjectName             string
+	appliedArgoProject          string
+	argoProjectClusterResources []argoGroupKind
+)
+
+func initArgoApplicationConfig() {
+	argoApplicationDefaults = parseArgoApplicationOptions("ARGO_APPLICATION_DEFAULTS", os.Getenv("ARGO_APPLICATION_DEFAULTS"))
+	argoProjectName = os.Getenv("ARGO_PROJECT")
+	if len(argoProjectName) < 1 {
+		argoProjectName = defaultArgoProject
+	}
+	argoProjectClusterResources = parseArgoClusterResources(os.Getenv("ARGO_PROJECT_CLUSTER_RESOURCES"))
+}
+
+// parseArgoClusterResources parses comma-separated group/kind list of cluster-scoped resources allowed in the project,
+// kinds without group belong to the core group. Defaults to namespaces only.
+func parseArgoClusterResources(clusterResources string) []argoGroupKind {
+	groupKinds := []argoGroupKind{}
+	for _, groupKind := range strings.Split(clusterResources, ",") {
+		groupKind = strings.TrimSpace(groupKind)
+		if len(groupKind) < 1 {
+			continue
+		}
+		sepIndex := strings.LastIndex(groupKind, "/")
+		groupKinds = append(groupKinds, argoGroupKind{Group: groupKind[:max(sepIndex, 0)], Kind: groupKind[sepIndex+1:]})
+	}
+	if len(groupKinds) < 1 {
+		groupKinds = append(groupKinds, argoGroupKind{Group: "", Kind: "Namespace"})
+	}
+	return groupKinds
+}
+
+func parseArgoApplicationOptions(source string, optionsYaml string) ArgoApplicationOptions {
+	var appOptions ArgoApplicationOptions
+	if len(strings.TrimSpace(optionsYaml)) < 1 {
+		return appOptions
+	}
+	err := yaml.Unmarshal([]byte(optionsYaml), &appOptions)
+	if err != nil {
+		sugar.Error("Failed to parse "+source+": ", err)
+		return ArgoApplicationOptions{}
+	}
+	return appOptions
+}
+
+func mergeArgoApplicationOptions(base ArgoApplicationOptions, override ArgoApplicationOptions) ArgoApplicationOptions {
+	merged := base
+	if len(override.Project) > 0 {
+		merged.Project = override.Project
+	}
+	if override.Automated != nil {
+		merged.Automated = override.Automated
+	}
+	if override.Prune != nil {
+		merged.Prune = override.Prune
+	}
+	if override.SelfHeal != nil {
+		merged.SelfHeal = override.SelfHeal
+	}
+	if override.SyncOptions != nil {
+		merged.SyncOptions = override.SyncOptions
+	}
+	if override.Retry != nil {
+		merged.Retry = override.Retry
+	}
+	if override.IgnoreDifferences != nil {
+		merged.IgnoreDifferences = override.IgnoreDifferences
+	}
+	if override.Annotations != nil {
+		merged.Annotations = map[string]string{}
+		for k, v := range base.Annotations {
+			merged.Annotations[k] = v
+		}
+		for k, v := range override.Annotations {
+			merged.Annotations[k] = v
+		}
+	}
+	return merged
+}
+
+// ResolveArgoApplicationOptions merges ARGO_APPLICATION_OPTIONS instance property of the bundle over ARGO_APPLICATION_DEFAULTS
+func ResolveArgoApplicationOptions(rd *RelizaDeployment) ArgoApplicationOptions {
+	appOptions, _ := resolveArgoApplicationOptions(rd)
+	return appOptions
+}
+
+// resolveArgoApplicationOptions returns defaults together with the error if the instance property cannot be fetched
+func resolveArgoApplicationOptions(rd *RelizaDeployment) (ArgoApplicationOptions, error) {
+	bundleOptions, err := GetInstancePropertyForBundle(rd, ArgoApplicationOptionsProperty)
+	if err != nil {
+		return argoApplicationDefaults, err
+	}
+	return mergeArgoApplicationOptions(argoApplicationDefaults, parseArgoApplicationOptions(ArgoApplicationOptionsProperty, bundleOptions)), nil
+}
+
+// IsArgoApplicationOptionsChanged resolves Argo CD Application options of rd, records them in the workspace, where they are
+// used for install and covered by the change digest, and returns true if they differ from options of the last applied Application.
+// If options cannot be resolved, those of the last applied Application are kept.
+func IsArgoApplicationOptionsChanged(groupPath string, rd *RelizaDeployment) bool {
+	if !argoInfo.IsArgoEnabled || !IsHelmDeployment(rd) {
+		return false
+	}
+	appliedOptions, appliedErr := os.ReadFile(groupPath + AppliedArgoApplicationOptionsFile)
+	appOptions, err := resolveArgoApplicationOptions(rd)
+	if err != nil {
+		if appliedErr == nil {
+			os.WriteFile(groupPath+ArgoApplicationOptionsFile, appliedOptions, 0600)
+		}
+		return false
+	}
+	optionsYaml, err := yaml.Marshal(appOptions)
+	if err == nil {
+		err = os.WriteFile(groupPath+ArgoApplicationOptionsFile, optionsYaml, 0600)
+	}
+	if err != nil {
+		sugar.Error("Failed to record Argo CD application options: ", err)
+		return false
+	}
+	if appliedErr != nil {
+		// Application applied before options were recorded, its options are taken as applied
+		os.WriteFile(groupPath+AppliedArgoApplicationOptionsFile, optionsYaml, 0600)
+		return false
+	}
+	isChanged := !bytes.Equal(appliedOptions, optionsYaml)
+	if isChanged {
+		sugar.Infow("Argo CD application options changed",
+			"bundle", rd.Bundle,
+			"namespace", rd.Namespace)
+	}
+	return isChanged
+}
+
+// readArgoApplicationOptions returns options recorded by IsArgoApplicationOptionsChanged on the current loop,
+// resolving them if not recorded
+func readArgoApplicationOptions(groupPath string, rd *RelizaDeployment) ArgoApplicationOptions {
+	optionsYaml, err := os.ReadFile(groupPath + ArgoApplicationOptionsFile)
+	if err != nil {
+		return ResolveArgoApplicationOptions(rd)
+	}
+	return parseArgoApplicationOptions(ArgoApplicationOptionsFile, string(optionsYaml))
+}
+
+// recordAppliedArgoApplicationOptions records options of the applied Application for change detection
+func recordAppliedArgoApplicationOptions(groupPath string) {
+	optionsYaml, err := os.ReadFile(groupPath + ArgoApplicationOptionsFile)
+	if err == nil {
+		err = os.WriteFile(groupPath+AppliedArgoApplicationOptionsFile, optionsYaml, 0600)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		sugar.Error("Failed to record applied Argo CD application options: ", err)
+	}
+}
+
+func applyArgoApplicationOptions(application *argoApplication, appOptions ArgoApplicationOptions) {
+	application.Spec.Project = argoProjectName
+	if len(appOptions.Project) > 0 {
+		application.Spec.Project = appOptions.Project
+	}
+	if appOptions.Automated != nil && !*appOptions.Automated {
+		application.Spec.SyncPolicy.Automated = nil
+	} else {
+		application.Spec.SyncPolicy.Automated = &argoSyncAutomated{
+			Prune:    appOptions.Prune != nil && *appOptions.Prune,
+			SelfHeal: appOptions.SelfHeal != nil && *appOptions.SelfHeal,
+		}
+	}
+	application.Spec.SyncPolicy.SyncOptions = appOptions.SyncOptions
+	application.Spec.SyncPolicy.Retry = appOptions.Retry
+	application.Spec.IgnoreDifferences = appOptions.IgnoreDifferences
+	for k, v := range appOptions.Annotations {
+		application.Metadata.Annotations[k] = v
+	}
+}
+
+// ApplyArgoProject maintains AppProject named by ARGO_PROJECT, reliza-cd by default, restricting destinations
+// to namespaces of current deployments and of deployments in the workspace which are not deleted yet.
+// The default project of Argo CD is not modified.
+func ApplyArgoProject(rlzDeployments []RelizaDeployment, existingDeployments map[string]bool) {
+	if !argoInfo.IsArgoEnabled || argoProjectName == builtinArgoProject {
+		return
+	}
+	deployments := append([]RelizaDeployment{}, rlzDeployments...)
+	for name := range existingDeployments {
+		recordedData, err := os.ReadFile("workspace/" + name + "/" + RecordedDeloyedData)
+		if err == nil {
+			var recordedRd RelizaDeployment
+			if json.Unmarshal(recordedData, &recordedRd) == nil {
+				deployments = append(deployments, recordedRd)
+			}
+		}
+	}
+	var projectYaml bytes.Buffer
+	err := ProduceArgoAppProjectYaml(&projectYaml, argoProjectName, SecretsNamespace, deployments)
+	if err != nil {
+		sugar.Error(err)
+		return
+	}
+	if appliedArgoProject == projectYaml.String() {
+		return
+	}
+	os.MkdirAll(argoProjectDir, 0700)
+	projectPath := filepath.Join(argoProjectDir, argoProjectFile)
+	err = os.WriteFile(projectPath, projectYaml.Bytes(), 0600)
+	if err == nil {
+		err = KubectlApply(projectPath)
+	}
+	if err != nil {
+		sugar.Errorw("Failed to apply Argo CD project", "project", argoProjectName, "error", err)
+		return
+	}
+	appliedArgoProject = projectYaml.String()
+	sugar.Info("Applied Argo CD project ", argoProjectName)
+}
+
+func ProduceArgoAppProjectYaml(w io.Writer, projectName string, namespace string, deployments []RelizaDeployment) error {
+	seen := map[argoProjectDestination]bool{}
+	destinations := []argoProjectDestination{}
+	for i := range deployments {
+		dest := resolveArgoDestination(&deployments[i])
+		projectDest := argoProjectDestination{Namespace: dest.Namespace, Server: dest.Server, Name: dest.Name}
+		if !seen[projectDest] {
+			seen[projectDest] = true
+			destinations = append(destinations, projectDest)
+		}
+	}
+	sort.Slice(destinations, func(i, j int) bool {
+		if destinations[i].Name+destinations[i].Server != destinations[j].Name+destinations[j].Server {
+			return destinations[i].Name+destinations[i].Server < destinations[j].Name+destinations[j].Server
+		}
+		return destinations[i].Namespace < destinations[j].Namespace
+	})
+	project := argoAppProject{
+		ApiVersion: "argoproj.io/v1alpha1",
+		Kind:       "AppProject",
+		Metadata: objectMetadata{
+			Name:      projectName,
+			Namespace: namespace,
+			Labels:    namespaceOwnershipLabels(),
+		},
+		Spec: argoAppProjectSpec{
+			Description:              "Applications managed by Reliza CD",
+			SourceRepos:              []string{"*"},
+			Destinations:             destinations,
+			ClusterResourceWhitelist: argoProjectClusterResources,
+		},
+	}
+	return writeYaml(w, project)
+}
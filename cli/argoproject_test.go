@@ -0,0 +1,179 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProduceCustomizedArgoApplicationYamlGolden(t *testing.T) {
+	argoApplicationDefaults = parseArgoApplicationOptions("test", "project: reliza\nprune: true\nsyncOptions:\n  - CreateNamespace=true\nannotations:\n  notifications.argoproj.io/subscribe.on-sync-failed.slack: deployments\n")
+	defer func() { argoApplicationDefaults = ArgoApplicationOptions{} }()
+	bundleOptions := parseArgoApplicationOptions("test", `selfHeal: true
+syncOptions:
+  - CreateNamespace=true
+  - ServerSideApply=true
+retry:
+  limit: 5
+  backoff:
+    duration: 5s
+    factor: 2
+    maxDuration: 3m
+ignoreDifferences:
+  - group: apps
+    kind: Deployment
+    jsonPointers:
+      - /spec/replicas
+annotations:
+  notifications.argoproj.io/subscribe.on-health-degraded.slack: deployments
+`)
+
+	rd, _, _ := testResourceDeployment()
+	rd.ArtUri = "oci://registry.example.com/charts/my-app"
+	groupPath := t.TempDir() + "/"
+	err := os.WriteFile(groupPath+InstallValues, []byte("replicaCount: 2\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applicationYaml bytes.Buffer
+	err = ProduceArgoApplicationYaml(&applicationYaml, &rd, "argocd", groupPath, mergeArgoApplicationOptions(argoApplicationDefaults, bundleOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "argo-application-customized.yaml", applicationYaml.Bytes())
+}
+
+func TestProduceArgoAppProjectYamlGolden(t *testing.T) {
+	deployments := []RelizaDeployment{
+		{Name: "prod---app", Namespace: "prod"},
+		{Name: "prod---other", Namespace: "prod"},
+		{Name: "dev---app", Namespace: "dev"},
+		{Name: "eu---app", Namespace: "eu", Cluster: "eu-prod"},
+	}
+	var projectYaml bytes.Buffer
+	err := ProduceArgoAppProjectYaml(&projectYaml, "reliza", "argocd", deployments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "argo-app-project.yaml", projectYaml.Bytes())
+}
+
+func TestParseArgoClusterResources(t *testing.T) {
+	if groupKinds := parseArgoClusterResources(""); !reflect.DeepEqual(groupKinds, []argoGroupKind{{Group: "", Kind: "Namespace"}}) {
+		t.Fatalf("expected namespaces only by default, got %v", groupKinds)
+	}
+	groupKinds := parseArgoClusterResources("Namespace, rbac.authorization.k8s.io/ClusterRole,*/*")
+	expected := []argoGroupKind{{Group: "", Kind: "Namespace"}, {Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}, {Group: "*", Kind: "*"}}
+	if !reflect.DeepEqual(groupKinds, expected) {
+		t.Fatalf("expected %v, got %v", expected, groupKinds)
+	}
+}
+
+func TestArgoApplicationOptionsChangeIsDetected(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		"reliza-cli": "[ -f \"$(dirname $0)/../hub-down\" ] && exit 1\n" +
+			"echo \"{\\\"properties\\\":[{\\\"value\\\":\\\"$(cat $(dirname $0)/../options)\\\"}]}\"",
+	})
+	setOptions := func(options string) {
+		if err := os.WriteFile(filepath.Join(toolsPath, "options"), []byte(options), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevArgoEnabled := argoInfo.IsArgoEnabled
+	argoInfo.IsArgoEnabled = true
+	defer func() { argoInfo.IsArgoEnabled = prevArgoEnabled }()
+	rd, _, _ := testResourceDeployment()
+	groupPath := t.TempDir() + "/"
+	if err := os.WriteFile(groupPath+ValuesDiff, []byte("replicaCount: 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	setOptions("selfHeal: true")
+	if IsArgoApplicationOptionsChanged(groupPath, &rd) {
+		t.Fatal("expected options of application applied before recording to be taken as applied")
+	}
+	digest, err := ComputeChangeDigest(groupPath, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setOptions("selfHeal: false")
+	if !IsArgoApplicationOptionsChanged(groupPath, &rd) {
+		t.Fatal("expected changed options to be detected")
+	}
+	if changedDigest, _ := ComputeChangeDigest(groupPath, &rd); changedDigest == digest {
+		t.Fatal("expected change digest to cover application options")
+	}
+	if appOptions := readArgoApplicationOptions(groupPath, &rd); appOptions.SelfHeal == nil || *appOptions.SelfHeal {
+		t.Fatalf("expected resolved options to be used for install, got %+v", appOptions)
+	}
+
+	// options stay changed until the application is applied, also while the hub is unreachable
+	if err := os.WriteFile(filepath.Join(toolsPath, "hub-down"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if IsArgoApplicationOptionsChanged(groupPath, &rd) {
+		t.Fatal("expected no change when options cannot be resolved")
+	}
+	os.Remove(filepath.Join(toolsPath, "hub-down"))
+	if !IsArgoApplicationOptionsChanged(groupPath, &rd) {
+		t.Fatal("expected changed options to be detected until applied")
+	}
+	recordAppliedArgoApplicationOptions(groupPath)
+	if IsArgoApplicationOptionsChanged(groupPath, &rd) {
+		t.Fatal("expected no change after options were applied")
+	}
+	applied, _ := os.ReadFile(groupPath + AppliedArgoApplicationOptionsFile)
+	if !strings.Contains(string(applied), "selfHeal: false") {
+		t.Fatalf("expected applied options to be recorded, got %s", applied)
+	}
+}
+
+func TestArgoProjectIsAppliedByDefault(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{})
+	t.Chdir(t.TempDir())
+	prevArgoEnabled, prevProjectName, prevAppliedProject := argoInfo.IsArgoEnabled, argoProjectName, appliedArgoProject
+	defer func() {
+		argoInfo.IsArgoEnabled, argoProjectName, appliedArgoProject = prevArgoEnabled, prevProjectName, prevAppliedProject
+	}()
+	argoInfo.IsArgoEnabled = true
+	deployments := []RelizaDeployment{{Name: "prod---app", Namespace: "prod"}}
+
+	t.Setenv("ARGO_PROJECT", "")
+	initArgoApplicationConfig()
+	appliedArgoProject = ""
+	ApplyArgoProject(deployments, map[string]bool{})
+	if calls := fakeToolCalls(t, toolsPath, "kubectl apply"); len(calls) != 1 {
+		t.Fatalf("expected reliza-cd project to be applied, got %v", calls)
+	}
+	projectYaml, _ := os.ReadFile(filepath.Join(argoProjectDir, argoProjectFile))
+	if !strings.Contains(string(projectYaml), "name: reliza-cd") {
+		t.Fatalf("expected reliza-cd project, got %s", projectYaml)
+	}
+
+	t.Setenv("ARGO_PROJECT", "default")
+	initArgoApplicationConfig()
+	appliedArgoProject = ""
+	ApplyArgoProject(deployments, map[string]bool{})
+	if calls := fakeToolCalls(t, toolsPath, "kubectl apply"); len(calls) != 1 {
+		t.Fatalf("expected default project of Argo CD not to be modified, got %v", calls)
+	}
+}
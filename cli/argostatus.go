@@ -0,0 +1,360 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ArgoStatusFile        = "argo-status.json"
+	defaultArgoWaitPeriod = 300
+)
+
+// ArgoApplicationStatus is the status of Argo CD Application of a bundle as recorded in argo-status.json of the deployment workspace
+type ArgoApplicationStatus struct {
+	Name               string   `json:"name"`
+	Namespace          string   `json:"namespace"`
+	Bundle             string   `json:"bundle"`
+	Version            string   `json:"version"`
+	SyncStatus         string   `json:"syncStatus"`
+	SyncRevision       string   `json:"syncRevision"`
+	HealthStatus       string   `json:"healthStatus"`
+	HealthMessage      string   `json:"healthMessage,omitempty"`
+	OperationPhase     string   `json:"operationPhase,omitempty"`
+	OperationMessage   string   `json:"operationMessage,omitempty"`
+	OperationStartedAt string   `json:"operationStartedAt,omitempty"`
+	OperationRevision  string   `json:"operationRevision,omitempty"`
+	ReconciledAt       string   `json:"reconciledAt,omitempty"`
+	Conditions         []string `json:"conditions,omitempty"`
+	CheckedAt          string   `json:"checkedAt"`
+	ReportedToHub      bool     `json:"reportedToHub,omitempty"`
+}
+
+// argoApplicationStatusJson is the subset of Application status read from kubectl json output
+type argoApplicationStatusJson struct {
+	Status struct {
+		Sync struct {
+			Status   string `json:"status"`
+			Revision string `json:"revision"`
+		} `json:"sync"`
+		Health struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"health"`
+		OperationState struct {
+			Phase      string `json:"phase"`
+			Message    string `json:"message"`
+			StartedAt  string `json:"startedAt"`
+			SyncResult struct {
+				Revision string `json:"revision"`
+			} `json:"syncResult"`
+		} `json:"operationState"`
+		ReconciledAt string `json:"reconciledAt"`
+		Conditions   []struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+var (
+	argoWaitTimeout      time.Duration
+	argoStatusPollPeriod = 5 * time.Second
+	// argoWaits holds targets of waits by deployment name, a wait in flight is retargeted when its deployment
+	// is applied again. Completed waits keep their result until it is recorded by the loop, see RefreshArgoApplicationStatus.
+	argoWaits     = map[string]*argoWait{}
+	argoWaitsLock sync.Mutex
+)
+
+type argoWait struct {
+	rd        RelizaDeployment
+	since     time.Time
+	completed bool
+	appStatus ArgoApplicationStatus
+	statusErr error
+}
+
+func initArgoStatusConfig() {
+	argoWaitTimeout = time.Duration(parseIntEnv("ARGO_WAIT_TIMEOUT", defaultArgoWaitPeriod)) * time.Second
+}
+
+func parseArgoApplicationStatus(appJson []byte, rd *RelizaDeployment) (ArgoApplicationStatus, error) {
+	var app argoApplicationStatusJson
+	err := json.Unmarshal(appJson, &app)
+	if err != nil {
+		return ArgoApplicationStatus{}, err
+	}
+	appStatus := ArgoApplicationStatus{
+		Name:               rd.Name,
+		Namespace:          rd.Namespace,
+		Bundle:             rd.Bundle,
+		Version:            rd.ArtVersion,
+		SyncStatus:         app.Status.Sync.Status,
+		SyncRevision:       app.Status.Sync.Revision,
+		HealthStatus:       app.Status.Health.Status,
+		HealthMessage:      app.Status.Health.Message,
+		OperationPhase:     app.Status.OperationState.Phase,
+		OperationMessage:   app.Status.OperationState.Message,
+		OperationStartedAt: app.Status.OperationState.StartedAt,
+		OperationRevision:  app.Status.OperationState.SyncResult.Revision,
+		ReconciledAt:       app.Status.ReconciledAt,
+		CheckedAt:          time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, condition := range app.Status.Conditions {
+		appStatus.Conditions = append(appStatus.Conditions, condition.Type+": "+condition.Message)
+	}
+	return appStatus, nil
+}
+
+// IsSettled returns true once the application is synced to the deployed version and healthy
+func (appStatus ArgoApplicationStatus) IsSettled() bool {
+	return appStatus.SyncStatus == "Synced" && appStatus.HealthStatus == "Healthy" && appStatus.SyncRevision == appStatus.Version
+}
+
+// IsFailed returns true if the last sync operation failed, the application is degraded or has error conditions
+func (appStatus ArgoApplicationStatus) IsFailed() bool {
+	if appStatus.OperationPhase == "Failed" || appStatus.OperationPhase == "Error" || appStatus.HealthStatus == "Degraded" {
+		return true
+	}
+	for _, condition := range appStatus.Conditions {
+		// condition types of errors are suffixed with Error, i.e. ComparisonError or SyncError, others are warnings
+		if conditionType, _, _ := strings.Cut(condition, ":"); strings.HasSuffix(conditionType, "Error") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFailedSince is IsFailed limited to state observed by Argo CD after since, so that the state of the previously
+// synced version is not taken for the outcome of the apply made at since
+func (appStatus ArgoApplicationStatus) IsFailedSince(since time.Time) bool {
+	isOperationCurrent := isArgoTimeSince(appStatus.OperationStartedAt, since) &&
+		(appStatus.OperationRevision == "" || appStatus.OperationRevision == appStatus.Version)
+	if isOperationCurrent && (appStatus.OperationPhase == "Failed" || appStatus.OperationPhase == "Error") {
+		return true
+	}
+	if isOperationCurrent && appStatus.OperationPhase == "Succeeded" && appStatus.HealthStatus == "Degraded" {
+		return true
+	}
+	if isArgoTimeSince(appStatus.ReconciledAt, since) {
+		for _, condition := range appStatus.Conditions {
+			if conditionType, _, _ := strings.Cut(condition, ":"); strings.HasSuffix(conditionType, "Error") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isArgoTimeSince returns true if Argo CD timestamp argoTime is not before since, timestamps have second precision
+func isArgoTimeSince(argoTime string, since time.Time) bool {
+	parsedTime, err := time.Parse(time.RFC3339, argoTime)
+	return err == nil && !parsedTime.Before(since.Truncate(time.Second))
+}
+
+func getArgoApplicationStatus(rd *RelizaDeployment) (ArgoApplicationStatus, error) {
+	appJson, _, err := shellout(KubectlApp + " get application " + rd.Name + " -n " + SecretsNamespace + " -o json")
+	if err != nil {
+		return ArgoApplicationStatus{}, err
+	}
+	return parseArgoApplicationStatus([]byte(appJson), rd)
+}
+
+// WaitForArgoApplication starts waiting in background for Application of rd to become synced to the deployed version
+// and healthy, see waitForArgoApplication. If a wait for the deployment is already in flight, it is retargeted to rd.
+func WaitForArgoApplication(rd *RelizaDeployment) {
+	if argoWaitTimeout <= 0 || DryRun {
+		return
+	}
+	target := &argoWait{rd: *rd, since: time.Now()}
+	argoWaitsLock.Lock()
+	prevTarget, exists := argoWaits[rd.Name]
+	inFlight := exists && !prevTarget.completed
+	argoWaits[rd.Name] = target
+	argoWaitsLock.Unlock()
+	if !inFlight {
+		go waitForArgoApplication(rd.Name)
+	}
+}
+
+// isArgoWaitInFlight returns true while Application of deployment name is waited for
+func isArgoWaitInFlight(name string) bool {
+	argoWaitsLock.Lock()
+	defer argoWaitsLock.Unlock()
+	target, exists := argoWaits[name]
+	return exists && !target.completed
+}
+
+// takeArgoWaitResult returns status of Application of deployment name observed by a completed wait and forgets the wait
+func takeArgoWaitResult(name string) (ArgoApplicationStatus, bool) {
+	argoWaitsLock.Lock()
+	defer argoWaitsLock.Unlock()
+	target, exists := argoWaits[name]
+	if !exists || !target.completed {
+		return ArgoApplicationStatus{}, false
+	}
+	delete(argoWaits, name)
+	return target.appStatus, target.statusErr == nil
+}
+
+// forgetArgoApplication drops wait and status metrics of Application of rd once it is deleted
+func forgetArgoApplication(rd *RelizaDeployment) {
+	argoWaitsLock.Lock()
+	delete(argoWaits, rd.Name)
+	argoWaitsLock.Unlock()
+	deleteArgoStatusMetrics(rd)
+}
+
+// waitForArgoApplication polls Application of the deployment until it is synced to the deployed version and healthy,
+// failed after the apply or ARGO_WAIT_TIMEOUT elapses. Failures are reported, but do not fail the deployment since
+// Argo CD keeps retrying the sync. The observed status is kept in argoWaits, so that it is recorded by the loop
+// which owns the deployment workspace.
+func waitForArgoApplication(name string) {
+	var target *argoWait
+	var appStatus ArgoApplicationStatus
+	var err error
+	for {
+		argoWaitsLock.Lock()
+		target = argoWaits[name]
+		argoWaitsLock.Unlock()
+		if target == nil {
+			// application was deleted
+			return
+		}
+		appStatus, err = getArgoApplicationStatus(&target.rd)
+		if err == nil && (appStatus.IsSettled() || appStatus.IsFailedSince(target.since)) {
+			break
+		}
+		if time.Now().After(target.since.Add(argoWaitTimeout)) {
+			break
+		}
+		time.Sleep(argoStatusPollPeriod)
+	}
+	argoWaitsLock.Lock()
+	currentTarget, exists := argoWaits[name]
+	isRetargeted := exists && currentTarget != target
+	if !isRetargeted {
+		target.completed = true
+		target.appStatus = appStatus
+		target.statusErr = err
+	}
+	argoWaitsLock.Unlock()
+	if isRetargeted {
+		// deployment was applied again after the last poll
+		waitForArgoApplication(name)
+		return
+	}
+	if !exists || err != nil {
+		return
+	}
+	result := "timeout"
+	if appStatus.IsSettled() {
+		result = "settled"
+	} else if appStatus.IsFailedSince(target.since) {
+		result = "failed"
+	}
+	recordArgoWaitMetrics(result, time.Since(target.since).Seconds())
+	if result == "settled" {
+		sugar.Infow("Argo CD application is synced and healthy",
+			"bundle", target.rd.Bundle,
+			"version", target.rd.ArtVersion,
+			"namespace", target.rd.Namespace)
+	} else {
+		logArgoApplicationProblem("Argo CD application did not become synced and healthy", appStatus, argoWaitTimeout.String())
+	}
+}
+
+// RefreshArgoApplicationStatus records current status of Application of rd, sends it to the Hub and logs when it changes
+// to failed or out of sync. Skipped while a wait for the Application is in flight, status observed by a completed wait
+// is recorded as is.
+func RefreshArgoApplicationStatus(groupPath string, rd *RelizaDeployment) {
+	if !argoInfo.IsArgoEnabled || isArgoWaitInFlight(rd.Name) {
+		return
+	}
+	if appStatus, isCompleted := takeArgoWaitResult(rd.Name); isCompleted {
+		recordArgoApplicationStatus(groupPath, rd, appStatus)
+		return
+	}
+	appStatus, err := getArgoApplicationStatus(rd)
+	if err != nil {
+		return
+	}
+	prevStatus := readArgoApplicationStatus(groupPath)
+	isChanged := prevStatus.SyncStatus != appStatus.SyncStatus || prevStatus.HealthStatus != appStatus.HealthStatus ||
+		prevStatus.OperationPhase != appStatus.OperationPhase
+	if !isChanged && prevStatus.ReportedToHub {
+		return
+	}
+	recordArgoApplicationStatus(groupPath, rd, appStatus)
+	if !isChanged {
+		return
+	}
+	if appStatus.IsFailed() || appStatus.SyncStatus == "OutOfSync" {
+		logArgoApplicationProblem("Argo CD application status changed", appStatus, "")
+	} else {
+		sugar.Infow("Argo CD application status changed",
+			"bundle", appStatus.Bundle,
+			"version", appStatus.Version,
+			"namespace", appStatus.Namespace,
+			"syncStatus", appStatus.SyncStatus,
+			"healthStatus", appStatus.HealthStatus)
+	}
+}
+
+func logArgoApplicationProblem(msg string, appStatus ArgoApplicationStatus, timeout string) {
+	sugar.Errorw(msg,
+		"bundle", appStatus.Bundle,
+		"version", appStatus.Version,
+		"namespace", appStatus.Namespace,
+		"syncStatus", appStatus.SyncStatus,
+		"syncRevision", appStatus.SyncRevision,
+		"healthStatus", appStatus.HealthStatus,
+		"healthMessage", appStatus.HealthMessage,
+		"operationPhase", appStatus.OperationPhase,
+		"operationMessage", appStatus.OperationMessage,
+		"conditions", appStatus.Conditions,
+		"timeout", timeout)
+}
+
+func readArgoApplicationStatus(groupPath string) ArgoApplicationStatus {
+	var appStatus ArgoApplicationStatus
+	statusBytes, err := os.ReadFile(groupPath + ArgoStatusFile)
+	if err == nil {
+		json.Unmarshal(statusBytes, &appStatus)
+	}
+	return appStatus
+}
+
+// recordArgoApplicationStatus records appStatus in the workspace and sends it to Reliza Hub, status which failed
+// to be sent is sent again on the next refresh
+func recordArgoApplicationStatus(groupPath string, rd *RelizaDeployment, appStatus ArgoApplicationStatus) {
+	recordArgoStatusMetrics(appStatus)
+	appStatus.ReportedToHub = reportToHub(ArgoStatusReport, groupPath, rd, appStatus) == nil
+	statusJson, err := json.Marshal(appStatus)
+	if err != nil {
+		sugar.Error(err)
+		return
+	}
+	err = os.WriteFile(groupPath+ArgoStatusFile, statusJson, 0600)
+	if err != nil {
+		sugar.Error(err)
+	}
+}
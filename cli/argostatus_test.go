@@ -0,0 +1,208 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArgoApplicationStatus(t *testing.T) {
+	rd := RelizaDeployment{Name: "prod---my-app", Namespace: "prod", Bundle: "My Bundle", ArtVersion: "1.2.3"}
+	testCases := []struct {
+		appJson string
+		settled bool
+		failed  bool
+	}{
+		{`{"status":{"sync":{"status":"Synced","revision":"1.2.3"},"health":{"status":"Healthy"}}}`, true, false},
+		// still reports previously synced version
+		{`{"status":{"sync":{"status":"Synced","revision":"1.2.2"},"health":{"status":"Healthy"}}}`, false, false},
+		{`{"status":{"sync":{"status":"OutOfSync","revision":"1.2.3"},"health":{"status":"Progressing"},"operationState":{"phase":"Running"}}}`, false, false},
+		{`{"status":{"sync":{"status":"OutOfSync","revision":"1.2.3"},"health":{"status":"Missing"},"operationState":{"phase":"Failed","message":"one or more objects failed to apply"}}}`, false, true},
+		{`{"status":{"sync":{"status":"Synced","revision":"1.2.3"},"health":{"status":"Degraded","message":"Deployment exceeded its progress deadline"}}}`, false, true},
+		{`{"status":{"sync":{"status":"Unknown"},"conditions":[{"type":"ComparisonError","message":"chart not found"}]}}`, false, true},
+		{`{"status":{"sync":{"status":"Synced","revision":"1.2.3"},"health":{"status":"Healthy"},"conditions":[{"type":"SharedResourceWarning","message":"shared"}]}}`, true, false},
+	}
+	for _, tc := range testCases {
+		appStatus, err := parseArgoApplicationStatus([]byte(tc.appJson), &rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if appStatus.IsSettled() != tc.settled || appStatus.IsFailed() != tc.failed {
+			t.Errorf("status %s: expected settled=%v failed=%v, got %+v", tc.appJson, tc.settled, tc.failed, appStatus)
+		}
+	}
+}
+
+func TestArgoApplicationFailureIsTakenAfterApplyOnly(t *testing.T) {
+	rd := RelizaDeployment{Name: "prod---my-app", Namespace: "prod", Bundle: "My Bundle", ArtVersion: "1.2.3"}
+	since := time.Date(2026, 10, 18, 12, 0, 0, 500, time.UTC)
+	testCases := []struct {
+		appJson string
+		failed  bool
+	}{
+		// failed sync and degraded health of previous version
+		{`{"status":{"sync":{"status":"OutOfSync","revision":"1.2.2"},"health":{"status":"Degraded"},"operationState":{"phase":"Failed","startedAt":"2026-10-18T11:50:00Z","syncResult":{"revision":"1.2.2"}},"reconciledAt":"2026-10-18T11:59:00Z"}}`, false},
+		{`{"status":{"sync":{"status":"OutOfSync","revision":"1.2.2"},"health":{"status":"Missing"},"operationState":{"phase":"Failed","startedAt":"2026-10-18T12:00:00Z","syncResult":{"revision":"1.2.3"}}}}`, true},
+		{`{"status":{"sync":{"status":"Synced","revision":"1.2.3"},"health":{"status":"Degraded"},"operationState":{"phase":"Succeeded","startedAt":"2026-10-18T12:00:05Z","syncResult":{"revision":"1.2.3"}}}}`, true},
+		{`{"status":{"sync":{"status":"Unknown"},"conditions":[{"type":"ComparisonError","message":"chart not found"}],"reconciledAt":"2026-10-18T11:59:00Z"}}`, false},
+		{`{"status":{"sync":{"status":"Unknown"},"conditions":[{"type":"ComparisonError","message":"chart not found"}],"reconciledAt":"2026-10-18T12:00:10Z"}}`, true},
+	}
+	for _, tc := range testCases {
+		appStatus, err := parseArgoApplicationStatus([]byte(tc.appJson), &rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if appStatus.IsFailedSince(since) != tc.failed {
+			t.Errorf("status %s: expected failed=%v since %v", tc.appJson, tc.failed, since)
+		}
+	}
+}
+
+func TestWaitForArgoApplicationInBackground(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "cat $(dirname $0)/../app.json",
+	})
+	setAppJson := func(appJson string) {
+		if err := os.WriteFile(filepath.Join(toolsPath, "app.json"), []byte(appJson), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevTimeout, prevPollPeriod, prevArgoEnabled := argoWaitTimeout, argoStatusPollPeriod, argoInfo.IsArgoEnabled
+	argoWaitTimeout, argoStatusPollPeriod, argoInfo.IsArgoEnabled = time.Minute, 10*time.Millisecond, true
+	defer func() {
+		argoWaitTimeout, argoStatusPollPeriod, argoInfo.IsArgoEnabled = prevTimeout, prevPollPeriod, prevArgoEnabled
+	}()
+	rd := RelizaDeployment{Name: "prod---my-app", Namespace: "prod", Bundle: "My Bundle", ArtVersion: "1.2.3"}
+	groupPath := t.TempDir() + "/"
+
+	setAppJson(`{"status":{"sync":{"status":"Synced","revision":"1.2.2"},"health":{"status":"Degraded"},"operationState":{"phase":"Failed","startedAt":"2020-01-01T00:00:00Z"}}}`)
+	WaitForArgoApplication(&rd)
+	time.Sleep(50 * time.Millisecond)
+	if !isArgoWaitInFlight(rd.Name) {
+		t.Fatal("expected state of previous version not to end the wait")
+	}
+	kubectlCalls := len(fakeToolCalls(t, toolsPath, "kubectl"))
+	RefreshArgoApplicationStatus(groupPath, &rd)
+	if len(fakeToolCalls(t, toolsPath, "kubectl")) > kubectlCalls+1 {
+		t.Fatal("expected status refresh to be skipped while waiting")
+	}
+
+	setAppJson(`{"status":{"sync":{"status":"Synced","revision":"1.2.3"},"health":{"status":"Healthy"}}}`)
+	for deadline := time.Now().Add(5 * time.Second); isArgoWaitInFlight(rd.Name); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected wait to end once the application is synced and healthy")
+		}
+	}
+	if _, err := os.Stat(groupPath + ArgoStatusFile); !os.IsNotExist(err) {
+		t.Fatal("expected status observed by the wait to be recorded by the loop only")
+	}
+	kubectlCalls = len(fakeToolCalls(t, toolsPath, "kubectl"))
+	RefreshArgoApplicationStatus(groupPath, &rd)
+	if len(fakeToolCalls(t, toolsPath, "kubectl")) != kubectlCalls {
+		t.Fatal("expected status observed by the wait to be recorded without reading it again")
+	}
+	if appStatus := readArgoApplicationStatus(groupPath); !appStatus.IsSettled() || !appStatus.ReportedToHub {
+		t.Fatalf("expected settled status to be recorded and sent to the hub, got %+v", appStatus)
+	}
+	if calls := fakeToolCalls(t, toolsPath, "reliza-cli instdata", "--namespace prod --sender reliza-cd-argo-status-prod---my-app"); len(calls) != 1 {
+		t.Fatalf("expected status to be sent to the hub once, got %v", calls)
+	}
+}
+
+func TestDeletedArgoApplicationIsNotWaitedFor(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": `echo '{"status":{"sync":{"status":"OutOfSync","revision":"1.2.2"},"health":{"status":"Progressing"}}}'`,
+	})
+	prevTimeout, prevPollPeriod, prevArgoEnabled := argoWaitTimeout, argoStatusPollPeriod, argoInfo.IsArgoEnabled
+	argoWaitTimeout, argoStatusPollPeriod, argoInfo.IsArgoEnabled = time.Minute, 10*time.Millisecond, true
+	defer func() {
+		argoWaitTimeout, argoStatusPollPeriod, argoInfo.IsArgoEnabled = prevTimeout, prevPollPeriod, prevArgoEnabled
+	}()
+	rd := RelizaDeployment{Name: "prod---removed-app", Namespace: "prod", Bundle: "Removed", ArtVersion: "1.2.3"}
+
+	WaitForArgoApplication(&rd)
+	time.Sleep(30 * time.Millisecond)
+	forgetArgoApplication(&rd)
+	time.Sleep(30 * time.Millisecond)
+	kubectlCalls := len(fakeToolCalls(t, toolsPath, "kubectl"))
+	time.Sleep(50 * time.Millisecond)
+	if len(fakeToolCalls(t, toolsPath, "kubectl")) != kubectlCalls || isArgoWaitInFlight(rd.Name) {
+		t.Fatal("expected wait to stop once the application is deleted")
+	}
+}
+
+func TestArgoApplicationMetrics(t *testing.T) {
+	for _, family := range metrics {
+		family.series = nil
+	}
+	rd := RelizaDeployment{Name: "prod---my-app", Namespace: "prod", Bundle: "My Bundle", ArtVersion: "1.2.3"}
+	recordArgoWaitMetrics("settled", 2)
+	recordArgoWaitMetrics("settled", 3)
+	recordArgoWaitMetrics("timeout", 300)
+	recordArgoStatusMetrics(ArgoApplicationStatus{Name: rd.Name, Namespace: "prod", Bundle: "My Bundle", Version: "1.2.3",
+		SyncStatus: "Synced", SyncRevision: "1.2.3", HealthStatus: "Degraded"})
+
+	var out strings.Builder
+	writeMetrics(&out)
+	for _, line := range []string{
+		"# TYPE reliza_cd_argo_application_waits_total counter",
+		`reliza_cd_argo_application_waits_total{result="settled"} 2`,
+		`reliza_cd_argo_application_waits_total{result="timeout"} 1`,
+		`reliza_cd_argo_application_wait_duration_seconds_sum{result="settled"} 5`,
+		`reliza_cd_argo_application_wait_duration_seconds_count{result="settled"} 2`,
+		`reliza_cd_argo_application_synced{name="prod---my-app",namespace="prod",bundle="My Bundle"} 1`,
+		`reliza_cd_argo_application_healthy{name="prod---my-app",namespace="prod",bundle="My Bundle"} 0`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected metrics to contain %s, got\n%s", line, out.String())
+		}
+	}
+
+	forgetArgoApplication(&rd)
+	out.Reset()
+	writeMetrics(&out)
+	if strings.Contains(out.String(), `name="prod---my-app"`) {
+		t.Fatalf("expected status metrics of deleted application to be removed, got\n%s", out.String())
+	}
+}
+
+func TestArgoStatusIsSentAgainAfterHubFailure(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl":    `echo '{"status":{"sync":{"status":"Synced","revision":"1.2.3"},"health":{"status":"Healthy"}}}'`,
+		"reliza-cli": "[ -f \"$(dirname $0)/../hub-down\" ] && exit 1\necho '{}'",
+	})
+	prevArgoEnabled := argoInfo.IsArgoEnabled
+	argoInfo.IsArgoEnabled = true
+	defer func() { argoInfo.IsArgoEnabled = prevArgoEnabled }()
+	rd := RelizaDeployment{Name: "prod---my-app", Namespace: "prod", Bundle: "My Bundle", ArtVersion: "1.2.3"}
+	groupPath := t.TempDir() + "/"
+
+	os.WriteFile(filepath.Join(toolsPath, "hub-down"), nil, 0600)
+	RefreshArgoApplicationStatus(groupPath, &rd)
+	if readArgoApplicationStatus(groupPath).ReportedToHub {
+		t.Fatal("expected status not to be marked as sent while the hub is down")
+	}
+	os.Remove(filepath.Join(toolsPath, "hub-down"))
+	RefreshArgoApplicationStatus(groupPath, &rd)
+	RefreshArgoApplicationStatus(groupPath, &rd)
+	if calls := fakeToolCalls(t, toolsPath, "--sender reliza-cd-argo-status-"); len(calls) != 2 {
+		t.Fatalf("expected unchanged status to be sent again only until delivered, got %v", calls)
+	}
+}
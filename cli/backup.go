@@ -91,7 +91,7 @@ func runBackup() {
 	tarFile := "/tmp/workspace-backup-" + timestamp + ".tar.gz"
 	encFile := tarFile + ".enc"
 
-	_, stderr, err := shellout("tar -czf " + tarFile + " -C /app workspace")
+	_, stderr, err := shellout("tar -czf " + tarFile + " -C /app --exclude workspace/" + ChartCacheDirName + " workspace")
 	if err != nil {
 		sugar.Error("Failed to create tar.gz of workspace: ", err, " stderr: ", stderr)
 		cleanup(tarFile, encFile)
@@ -0,0 +1,106 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	CanaryValues            = "canary-values.yaml"
+	CanaryReleaseSuffix     = "-canary"
+	RolloutStrategyProperty = "ROLLOUT_STRATEGY"
+	CanaryValuesProperty    = "CANARY_VALUES"
+	CanaryTimeoutProperty   = "CANARY_TIMEOUT"
+	RolloutStrategyCanary   = "canary"
+	defaultCanaryValues     = "replicaCount: 1\n"
+	defaultCanaryTimeout    = "5m"
+)
+
+func isCanaryRollout(rd *RelizaDeployment) bool {
+	strategy, err := GetInstancePropertyForBundle(rd, RolloutStrategyProperty)
+	return err == nil && strings.ToLower(strings.TrimSpace(strategy)) == RolloutStrategyCanary
+}
+
+func getCanaryReleaseName(rd *RelizaDeployment) string {
+	return GetChartNameFromDeployment(rd) + CanaryReleaseSuffix
+}
+
+// InstallHelmChartWithCanary installs new version of the chart as a separate canary release first.
+// Canary release is installed with install values overlaid by CANARY_VALUES instance property (replicaCount: 1 by default)
+// and helm --wait, so that it is only considered healthy once all its resources are ready within CANARY_TIMEOUT.
+// Healthy canary is promoted by upgrading the main release, after which the canary release is removed.
+// Unhealthy canary is discarded and the main release is left untouched.
+func InstallHelmChartWithCanary(groupPath string, rd *RelizaDeployment) error {
+	helmChartName := GetChartNameFromDeployment(rd)
+	canaryRelease := getCanaryReleaseName(rd)
+
+	canaryValues, err := GetInstancePropertyForBundle(rd, CanaryValuesProperty)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(canaryValues)) < 1 {
+		canaryValues = defaultCanaryValues
+	}
+	err = os.WriteFile(groupPath+CanaryValues, []byte(canaryValues), 0600)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+
+	canaryTimeout, err := GetInstancePropertyForBundle(rd, CanaryTimeoutProperty)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(canaryTimeout)) < 1 {
+		canaryTimeout = defaultCanaryTimeout
+	}
+
+	sugar.Infow("Installing canary release",
+		"bundle", rd.Bundle,
+		"version", rd.ArtVersion,
+		"namespace", rd.Namespace,
+		"release", canaryRelease,
+		"timeout", canaryTimeout)
+	canaryCmd := HelmApp + " upgrade --install " + canaryRelease + " -n " + rd.Namespace + ClusterFlags(rd) + " --labels " + helmReleaseLabels(rd) + " -f " + groupPath + InstallValues + " -f " + groupPath + CanaryValues + " --wait --timeout " + strings.TrimSpace(canaryTimeout) + " " + groupPath + helmChartName
+	stdout, stderr, err := dryRunShellout(canaryCmd)
+	if err != nil {
+		sugar.Errorw("Canary release is not healthy, discarding it",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"namespace", rd.Namespace,
+			"release", canaryRelease,
+			"stdout", stdout,
+			"stderr", stderr,
+			"error", err)
+		discardCanaryRelease(rd)
+		return err
+	}
+
+	sugar.Infow("Canary release is healthy, promoting to main release",
+		"bundle", rd.Bundle,
+		"version", rd.ArtVersion,
+		"namespace", rd.Namespace,
+		"release", helmChartName)
+	err = InstallHelmChart(groupPath, rd)
+	discardCanaryRelease(rd)
+	return err
+}
+
+func discardCanaryRelease(rd *RelizaDeployment) {
+	dryRunShellout(HelmApp + " uninstall " + getCanaryReleaseName(rd) + " -n " + rd.Namespace + ClusterFlags(rd) + " --ignore-not-found")
+}
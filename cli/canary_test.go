@@ -0,0 +1,113 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCanaryTools serve canary instance properties, helm upgrade of a release exits with the code stored in <release>-exit
+var fakeCanaryTools = map[string]string{
+	"reliza-cli": `case "$*" in
+*ROLLOUT_STRATEGY*) echo '{"properties":[{"key":"ROLLOUT_STRATEGY","value":"Canary"}]}';;
+*CANARY_TIMEOUT*) echo '{"properties":[{"key":"CANARY_TIMEOUT","value":"2m"}]}';;
+*) echo '{"properties":[]}';;
+esac`,
+	"helm": `case "$1 $2" in
+"upgrade --install") exit $(cat "$(dirname $0)/../$3-exit" 2>/dev/null || echo 0);;
+esac`,
+}
+
+func TestIsCanaryRollout(t *testing.T) {
+	fakeTools(t, fakeCanaryTools)
+	rd, _, _ := testResourceDeployment()
+	if !isCanaryRollout(&rd) {
+		t.Error("expected canary rollout when ROLLOUT_STRATEGY is canary")
+	}
+
+	fakeTools(t, map[string]string{"reliza-cli": "echo '{\"properties\":[]}'"})
+	if isCanaryRollout(&rd) {
+		t.Error("expected regular rollout when ROLLOUT_STRATEGY is not set")
+	}
+}
+
+func TestCanaryIsPromotedWhenHealthy(t *testing.T) {
+	toolsPath := fakeTools(t, fakeCanaryTools)
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	err := InstallHelmChartWithCanary(groupPath, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canaryValues, _ := os.ReadFile(groupPath + CanaryValues)
+	if string(canaryValues) != defaultCanaryValues {
+		t.Errorf("expected default canary values, got %s", canaryValues)
+	}
+	helmCalls := fakeToolCalls(t, toolsPath, "helm ")
+	expected := []string{
+		"helm upgrade --install my-app-canary -n prod",
+		"helm upgrade --install my-app --create-namespace -n prod",
+		"helm uninstall my-app-canary -n prod",
+	}
+	if len(helmCalls) != len(expected) {
+		t.Fatalf("expected helm calls %v, got %v", expected, helmCalls)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(helmCalls[i], expected[i]) {
+			t.Errorf("expected call %d to start with %s, got %s", i, expected[i], helmCalls[i])
+		}
+	}
+	if !strings.Contains(helmCalls[0], "-f "+groupPath+CanaryValues+" --wait --timeout 2m") {
+		t.Errorf("expected canary to be installed with canary values and wait, got %s", helmCalls[0])
+	}
+}
+
+func TestCanaryIsDiscardedWhenUnhealthy(t *testing.T) {
+	toolsPath := fakeTools(t, fakeCanaryTools)
+	os.WriteFile(filepath.Join(toolsPath, "my-app-canary-exit"), []byte("1"), 0600)
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	err := InstallHelmChartWithCanary(groupPath, &rd)
+	if err == nil {
+		t.Fatal("expected unhealthy canary to fail install")
+	}
+	if len(fakeToolCalls(t, toolsPath, "helm upgrade --install my-app ")) != 0 {
+		t.Error("expected main release to be left untouched")
+	}
+	if len(fakeToolCalls(t, toolsPath, "helm uninstall my-app-canary")) != 1 {
+		t.Error("expected canary release to be discarded")
+	}
+}
+
+func TestCanaryIsDiscardedWhenPromotionFails(t *testing.T) {
+	toolsPath := fakeTools(t, fakeCanaryTools)
+	os.WriteFile(filepath.Join(toolsPath, "my-app-exit"), []byte("1"), 0600)
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	err := InstallHelmChartWithCanary(groupPath, &rd)
+	if err == nil {
+		t.Fatal("expected failed promotion to fail install")
+	}
+	if len(fakeToolCalls(t, toolsPath, "helm uninstall my-app-canary")) != 1 {
+		t.Error("expected canary release to be discarded")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chartCachePullDigestFile = "pull-digest"
+	// ChartCacheDirName is the directory of the default chart cache in the workspace volume, so that cached charts survive restarts
+	ChartCacheDirName = "chart-cache"
+)
+
+type ChartCacheConfig struct {
+	Enabled      bool
+	Dir          string
+	MaxSizeBytes int64
+}
+
+type chartCacheEntry struct {
+	path       string
+	size       int64
+	lastAccess time.Time
+}
+
+var chartCacheConfig ChartCacheConfig
+
+func initChartCacheConfig() {
+	chartCacheConfig.Enabled = strings.ToLower(os.Getenv("CHART_CACHE_ENABLED")) != "false"
+	chartCacheConfig.Dir = os.Getenv("CHART_CACHE_DIR")
+	if len(chartCacheConfig.Dir) < 1 {
+		chartCacheConfig.Dir = "workspace/" + ChartCacheDirName
+	}
+	maxSizeMb := int64(1024)
+	if len(os.Getenv("CHART_CACHE_MAX_SIZE_MB")) > 0 {
+		parsedSize, err := strconv.ParseInt(os.Getenv("CHART_CACHE_MAX_SIZE_MB"), 10, 64)
+		if err != nil {
+			sugar.Error("Failed to parse CHART_CACHE_MAX_SIZE_MB, using default: ", err)
+		} else {
+			maxSizeMb = parsedSize
+		}
+	}
+	chartCacheConfig.MaxSizeBytes = maxSizeMb * 1024 * 1024
+}
+
+// chartCacheKey identifies chart content by repository, chart name and version, which are immutable in chart registries
+func chartCacheKey(helmRepoInfo HelmRepoInfo, version string) string {
+	digest := sha256.Sum256([]byte(helmRepoInfo.RepoUri + "/" + helmRepoInfo.ChartName + ":" + version))
+	return hex.EncodeToString(digest[:])
+}
+
+// restoreChartFromCache copies cached chart archive into path. Returns the recorded helm pull output digest and true on cache hit.
+func restoreChartFromCache(path string, helmRepoInfo HelmRepoInfo, version string) (string, bool) {
+	if !chartCacheConfig.Enabled {
+		return "", false
+	}
+	entryPath := filepath.Join(chartCacheConfig.Dir, chartCacheKey(helmRepoInfo, version))
+	cachedArchives, _ := filepath.Glob(filepath.Join(entryPath, "*.tgz"))
+	if len(cachedArchives) < 1 {
+		return "", false
+	}
+	_, _, err := shellout("cp " + entryPath + "/*.tgz " + path)
+	if err != nil {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(entryPath, now, now)
+	pullDigest, _ := os.ReadFile(filepath.Join(entryPath, chartCachePullDigestFile))
+	sugar.Debug("Restored chart ", helmRepoInfo.ChartName, " version ", version, " from cache")
+	return string(pullDigest), true
+}
+
+// removeChartFromCache drops cache entry of the chart, i.e. when the cached archive fails verification
+func removeChartFromCache(helmRepoInfo HelmRepoInfo, version string) {
+	if !chartCacheConfig.Enabled {
+		return
+	}
+	err := os.RemoveAll(filepath.Join(chartCacheConfig.Dir, chartCacheKey(helmRepoInfo, version)))
+	if err != nil {
+		sugar.Error(err)
+	}
+}
+
+// storeChartInCache records downloaded chart archive from path in the cache and evicts least recently used entries above size limit
+func storeChartInCache(path string, helmRepoInfo HelmRepoInfo, version string, pullDigest string) {
+	if !chartCacheConfig.Enabled {
+		return
+	}
+	entryPath := filepath.Join(chartCacheConfig.Dir, chartCacheKey(helmRepoInfo, version))
+	os.RemoveAll(entryPath)
+	err := os.MkdirAll(entryPath, 0700)
+	if err != nil {
+		sugar.Error(err)
+		return
+	}
+	_, _, err = shellout("cp " + path + "*.tgz " + entryPath + "/")
+	if err != nil {
+		os.RemoveAll(entryPath)
+		return
+	}
+	if len(pullDigest) > 0 {
+		os.WriteFile(filepath.Join(entryPath, chartCachePullDigestFile), []byte(pullDigest), 0600)
+	}
+	evictChartCache(chartCacheConfig.Dir, chartCacheConfig.MaxSizeBytes)
+}
+
+// evictChartCache removes least recently used cache entries until total cache size is within maxSizeBytes
+func evictChartCache(cacheDir string, maxSizeBytes int64) {
+	dirEntries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		sugar.Error(err)
+		return
+	}
+	var cacheEntries []chartCacheEntry
+	var totalSize int64
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			continue
+		}
+		entryPath := filepath.Join(cacheDir, de.Name())
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		entry := chartCacheEntry{path: entryPath, lastAccess: info.ModTime()}
+		filepath.Walk(entryPath, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				entry.size += fi.Size()
+			}
+			return nil
+		})
+		totalSize += entry.size
+		cacheEntries = append(cacheEntries, entry)
+	}
+
+	sort.Slice(cacheEntries, func(i, j int) bool {
+		return cacheEntries[i].lastAccess.Before(cacheEntries[j].lastAccess)
+	})
+	for i := 0; totalSize > maxSizeBytes && i < len(cacheEntries); i++ {
+		sugar.Debug("Evicting chart cache entry ", cacheEntries[i].path)
+		os.RemoveAll(cacheEntries[i].path)
+		totalSize -= cacheEntries[i].size
+	}
+}
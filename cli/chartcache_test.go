@@ -0,0 +1,118 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+)
+
+func TestEvictChartCacheRemovesLeastRecentlyUsed(t *testing.T) {
+	cacheDir := t.TempDir()
+	now := time.Now()
+	for i, entryName := range []string{"oldest", "middle", "newest"} {
+		entryPath := filepath.Join(cacheDir, entryName)
+		os.MkdirAll(entryPath, 0700)
+		os.WriteFile(filepath.Join(entryPath, "chart.tgz"), make([]byte, 100), 0600)
+		accessTime := now.Add(time.Duration(i-3) * time.Hour)
+		os.Chtimes(entryPath, accessTime, accessTime)
+	}
+
+	evictChartCache(cacheDir, 250)
+
+	for entryName, expectedExists := range map[string]bool{"oldest": false, "middle": true, "newest": true} {
+		_, err := os.Stat(filepath.Join(cacheDir, entryName))
+		if (err == nil) != expectedExists {
+			t.Fatalf("entry %s: expected exists = %v, stat err = %v", entryName, expectedExists, err)
+		}
+	}
+}
+
+func TestChartCacheKeyDependsOnVersion(t *testing.T) {
+	helmRepoInfo := HelmRepoInfo{ChartName: "app", RepoUri: "https://charts.example.com"}
+	if chartCacheKey(helmRepoInfo, "1.0.0") == chartCacheKey(helmRepoInfo, "1.0.1") {
+		t.Fatal("cache keys of different versions must differ")
+	}
+}
+
+// writeTestChart packages a minimal chart my-app into dir/my-app-1.2.3.tgz and returns its sha256 digest
+func writeTestChart(t *testing.T, dir string, description string) string {
+	t.Helper()
+	chartDir := filepath.Join(t.TempDir(), "my-app")
+	os.MkdirAll(chartDir, 0700)
+	os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: my-app\nversion: 1.2.3\ndescription: "+description+"\n"), 0600)
+	archivePath := filepath.Join(dir, "my-app-1.2.3.tgz")
+	out, err := exec.Command("tar", "-czf", archivePath, "-C", filepath.Dir(chartDir), "my-app").CombinedOutput()
+	if err != nil {
+		t.Fatal(err, string(out))
+	}
+	archive, _ := os.ReadFile(archivePath)
+	digest := sha256.Sum256(archive)
+	return hex.EncodeToString(digest[:])
+}
+
+// fakeHelmPull copies pulled.tgz from the stub tools directory into the destination given with -d
+var fakeHelmPull = map[string]string{
+	"helm": `dir="$(dirname $0)/.."
+if [ "$1" = "pull" ]; then
+  while [ $# -gt 0 ]; do [ "$1" = "-d" ] && cp "$dir/pulled.tgz" "$2/my-app-1.2.3.tgz"; shift; done
+fi`,
+}
+
+func TestCorruptedCacheEntryIsReplaced(t *testing.T) {
+	toolsPath := fakeTools(t, fakeHelmPull)
+	pulledDigest := writeTestChart(t, toolsPath, "pulled")
+	os.Rename(filepath.Join(toolsPath, "my-app-1.2.3.tgz"), filepath.Join(toolsPath, "pulled.tgz"))
+	rd, pa, helmInfo := testResourceDeployment()
+	rd.ArtHash = cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: pulledDigest}
+
+	prevCacheConfig := chartCacheConfig
+	prevVerificationConfig := verificationConfig
+	chartCacheConfig = ChartCacheConfig{Enabled: true, Dir: t.TempDir(), MaxSizeBytes: 1024 * 1024}
+	verificationConfig = VerificationConfig{DigestVerification: DigestVerificationEnforce}
+	defer func() {
+		chartCacheConfig = prevCacheConfig
+		verificationConfig = prevVerificationConfig
+	}()
+
+	entryPath := filepath.Join(chartCacheConfig.Dir, chartCacheKey(helmInfo, rd.ArtVersion))
+	os.MkdirAll(entryPath, 0700)
+	writeTestChart(t, entryPath, "tampered")
+
+	groupPath := t.TempDir() + "/"
+	err := DownloadHelmChart(groupPath, &rd, &pa, helmInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fakeToolCalls(t, toolsPath, "helm pull")) != 1 {
+		t.Error("expected chart to be pulled after cached copy failed verification")
+	}
+	cached, _ := os.ReadFile(filepath.Join(entryPath, "my-app-1.2.3.tgz"))
+	cachedDigest := sha256.Sum256(cached)
+	if hex.EncodeToString(cachedDigest[:]) != pulledDigest {
+		t.Error("expected corrupted cache entry to be replaced with pulled chart")
+	}
+	if _, err := os.Stat(groupPath + "my-app/Chart.yaml"); err != nil {
+		t.Error("expected pulled chart to be extracted")
+	}
+}
@@ -17,16 +17,14 @@ package cli
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"regexp"
-	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
 	cdx "github.com/CycloneDX/cyclonedx-go"
@@ -50,6 +48,8 @@ var (
 	argoInfo         ArgoInfo
 	EnvMode          string
 	DryRun           bool
+	// toolsDir is the working directory of shelled out commands, where tools are located
+	toolsDir = "/app"
 )
 
 const (
@@ -98,6 +98,24 @@ func init() {
 		DryRun = true
 	}
 
+	initApplyConfig()
+	initApprovalConfig()
+	initDriftConfig()
+	initVerificationConfig()
+	initChartCacheConfig()
+	initAirgapConfig()
+	initRegistryConfig()
+	initSecretBackendConfig()
+	initSealedCertCheckConfig()
+	initOrphanGcConfig()
+	initDeletionProtectionConfig()
+	initNamespaceConfig()
+	initTargetClustersConfig()
+	initArgoApplicationConfig()
+	initArgoStatusConfig()
+	initApplicationSetConfig()
+	initMetricsConfig()
+
 	if DryRun {
 		sugar.Info("DRY_RUN mode is enabled - mutating helm/kubectl commands will be logged but not executed")
 	}
@@ -115,6 +133,11 @@ func init() {
 		panic("Mode is set to `" + EnvMode + "` but no argo installation detected on the cluster!")
 	}
 
+	if argoInfo.IsArgoEnabled && len(argoInfo.ArgoNamespace) < 1 {
+		sugar.Error("Could not locate argocd namespace, set ARGO_NAMESPACE")
+		panic("Could not locate argocd namespace, set ARGO_NAMESPACE")
+	}
+
 	if argoInfo.IsArgoEnabled {
 		SecretsNamespace = argoInfo.ArgoNamespace
 	}
@@ -124,7 +147,7 @@ func shellout(command string) (string, string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	cmd := exec.Command(ShellToUse, "-c", command)
-	cmd.Dir = "/app" // Set working directory to /app where tools are located
+	cmd.Dir = toolsDir
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err := cmd.Run()
@@ -145,7 +168,7 @@ func dryRunShellout(command string) (string, string, error) {
 }
 
 func SetSealedCertificateOnTheHub(cert string) {
-	certPath := "workspace/sealedCert.pem"
+	certPath := sealedCertPath
 	doSet := false
 	existingCert, err := os.ReadFile(certPath)
 	if err != nil && os.IsNotExist(err) {
@@ -207,6 +230,18 @@ func resolveDeploymentNameFromString(origName string) string {
 	return rdName
 }
 
+// parseNamespaceList parses comma-separated list of namespaces into a set
+func parseNamespaceList(namespaceList string) map[string]bool {
+	namespaces := make(map[string]bool)
+	for _, ns := range strings.Split(namespaceList, ",") {
+		ns = strings.TrimSpace(ns)
+		if len(ns) > 0 {
+			namespaces[ns] = true
+		}
+	}
+	return namespaces
+}
+
 // dockerTagSafeVersion converts a version string to be Docker tag safe
 // by replacing characters that are not allowed in Docker tags with underscores.
 // Docker tags must match: [\w][\w.-]{0,127}
@@ -274,12 +309,15 @@ func ParseInstanceCycloneDXIntoDeployments(cyclonedxManifest string) []RelizaDep
 
 	if nil != bom.Components && len(*bom.Components) > 0 {
 		for _, comp := range *bom.Components {
-			if comp.MIMEType == HelmMimeType {
+			deploymentType := resolveDeploymentTypeFromMimeType(comp.MIMEType)
+			if len(deploymentType) > 0 {
 				var rd RelizaDeployment
+				rd.Type = deploymentType
 				rd.Name = resolveDeploymentNameFromString(comp.Group)
 				namespaceBundle := strings.Split(comp.Group, "---")
 				rd.Namespace = namespaceBundle[0]
 				rd.Bundle = namespaceBundle[1]
+				rd.Cluster = resolveTargetCluster(rd.Namespace, rd.Bundle)
 				rd.ArtUri = comp.Name
 				rd.ArtVersion = comp.Version
 				appConfig := appConfigMap[rd.Name]
@@ -297,8 +335,8 @@ func ParseInstanceCycloneDXIntoDeployments(cyclonedxManifest string) []RelizaDep
 					hashes := *comp.Hashes
 					rd.ArtHash = hashes[0]
 				} else {
-					// Helm charts may not have hashes - use empty hash for public repos
-					sugar.Debug("No hash found for Helm artifact = " + rd.ArtUri + ", assuming public repository")
+					// Helm charts and manifests may not have hashes - use empty hash for public repos
+					sugar.Debug("No hash found for artifact = " + rd.ArtUri + ", assuming public repository")
 					rd.ArtHash = cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: ""}
 				}
 				rlzDeployments = append(rlzDeployments, rd)
@@ -317,190 +355,109 @@ func GetProjectAuthByArtifactDigest(artDigest, releaseNamespace string) ProjectA
 	return projectAuth["artifactDownloadSecrets"]
 }
 
-func ProduceSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string, helmInfo HelmRepoInfo) {
-	secretTmpl :=
-		`apiVersion: bitnami.com/v1alpha1
-kind: SealedSecret
-metadata:
-  name: {{.Name}}
-  namespace: {{.Namespace}}
-  annotations:
-    sealedsecrets.bitnami.com/namespace-wide: "true"
-  labels:
-    reliza.io/type: cdresource
-    reliza.io/name: {{.Name}}
-    
-spec:
-  encryptedData:
-    username: {{.Username}}
-    password: {{.Password}}
-  template:
-    data:
-      url: {{.Url}}
-      name: {{.Name}}
-      type: helm
-      enableOCI: {{printf "%q" .EnableOci}}
-    metadata:
-      labels:
-        reliza.io/type: cdresource
-        reliza.io/name: {{.Name}}
-        argocd.argoproj.io/secret-type: repository`
-
-	var secTmplRes SecretTemplateResolver
-	secTmplRes.Name = rd.Name
-	secTmplRes.Namespace = namespace
-	secTmplRes.Username = projAuth.Login
-	secTmplRes.Password = projAuth.Password
-	secTmplRes.Url = helmInfo.RepoHost
-	secTmplRes.EnableOci = strconv.FormatBool(helmInfo.UseOci)
-	if helmInfo.UseOci {
-		secTmplRes.Url = helmInfo.RepoHost
-	} else {
-		secTmplRes.Url = helmInfo.RepoUri
-	}
-	tmpl, err := template.New("secrettmpl").Parse(secretTmpl)
-	if err != nil {
-		panic(err)
-	}
-
-	err = tmpl.Execute(w, secTmplRes)
-	if err != nil {
-		panic(err)
-	}
+// ProduceSecretYaml produces Argo CD helm repository secret as SealedSecret with credentials sealed by the Hub
+func ProduceSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string, helmInfo HelmRepoInfo) error {
+	templateLabels := cdResourceLabels(rd.Name)
+	templateLabels["argocd.argoproj.io/secret-type"] = "repository"
+	secret := sealedSecret{
+		ApiVersion: "bitnami.com/v1alpha1",
+		Kind:       "SealedSecret",
+		Metadata: objectMetadata{
+			Name:        rd.Name,
+			Namespace:   namespace,
+			Annotations: sealedSecretAnnotations(rd),
+			Labels:      cdResourceLabels(rd.Name),
+		},
+		Spec: sealedSecretSpec{
+			EncryptedData: sealedCredentialsData(projAuth),
+			Template: sealedSecretTemplate{
+				Data:     repositorySecretData(rd, helmInfo),
+				Metadata: objectMetadata{Labels: templateLabels, Annotations: cdResourceAnnotations(rd)},
+			},
+		},
+	}
+	return writeYaml(w, secret)
 }
 
-func ProducePlainSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string, helmInfo HelmRepoInfo) {
+// ProducePlainSecretYaml produces Argo CD helm repository secret with plain credentials, i.e. short-lived registry tokens
+func ProducePlainSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string, helmInfo HelmRepoInfo) error {
 	sugar.Debug("ProducePlainSecretYaml - helmInfo: ", helmInfo)
-	secretTmpl :=
-		`apiVersion: v1
-kind: Secret
-metadata:
-  labels:
-    argocd.argoproj.io/secret-type: repository
-    reliza.io/type: cdresource
-    reliza.io/name: {{.Name}}
-  name: {{.Name}}
-  namespace: {{.Namespace}}
-type: Opaque
-data:
-  type: aGVsbQ==
-  url: {{.Url}}
-  name: {{.NameBase64}}
-  username: {{.Username}}
-  password: {{.Password}}
-  enableOCI: {{printf "%q" .EnableOci}}`
-	sugar.Debug("ProducePlainSecretYaml - EnableOci: ", helmInfo.UseOci)
-	sugar.Debug("ProducePlainSecretYaml - Url: ", helmInfo.RepoHost)
-	var secTmplRes SecretTemplateResolver
-	secTmplRes.Name = rd.Name
-	secTmplRes.NameBase64 = base64.StdEncoding.EncodeToString([]byte(rd.Name))
-	secTmplRes.Namespace = namespace
-	secTmplRes.Username = base64.StdEncoding.EncodeToString([]byte(projAuth.Login))
-	secTmplRes.Password = base64.StdEncoding.EncodeToString([]byte(projAuth.Password))
-	secTmplRes.EnableOci = base64.StdEncoding.EncodeToString([]byte(strconv.FormatBool(helmInfo.UseOci)))
-	if helmInfo.UseOci {
-		secTmplRes.Url = base64.StdEncoding.EncodeToString([]byte(helmInfo.RepoHost))
-	} else {
-		secTmplRes.Url = base64.StdEncoding.EncodeToString([]byte(helmInfo.RepoUri))
-	}
-	tmpl, err := template.New("secrettmpl").Parse(secretTmpl)
-	if err != nil {
-		panic(err)
-	}
-
-	err = tmpl.Execute(w, secTmplRes)
-	if err != nil {
-		panic(err)
-	}
+	secretData := repositorySecretData(rd, helmInfo)
+	secretData["username"] = projAuth.Login
+	secretData["password"] = projAuth.Password
+	return writeYaml(w, produceRepositorySecret(rd, namespace, secretData))
 }
 
-func ProduceNoCredSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string, helmInfo HelmRepoInfo) {
-	secretTmpl :=
-		`apiVersion: v1
-kind: Secret
-metadata:
-  labels:
-    argocd.argoproj.io/secret-type: repository
-    reliza.io/type: cdresource
-    reliza.io/name: {{.Name}}
-  name: {{.Name}}
-  namespace: {{.Namespace}}
-type: Opaque
-data:
-  type: aGVsbQ==
-  url: {{.Url}}
-  name: {{.NameBase64}}
-  enableOCI: {{printf "%q" .EnableOci}}`
-
-	var secTmplRes SecretTemplateResolver
-	secTmplRes.Name = rd.Name
-	secTmplRes.NameBase64 = base64.StdEncoding.EncodeToString([]byte(rd.Name))
-	secTmplRes.Namespace = namespace
-	secTmplRes.Username = base64.StdEncoding.EncodeToString([]byte(projAuth.Login))
-	secTmplRes.Password = base64.StdEncoding.EncodeToString([]byte(projAuth.Password))
-	secTmplRes.EnableOci = base64.StdEncoding.EncodeToString([]byte(strconv.FormatBool(helmInfo.UseOci)))
-	if helmInfo.UseOci {
-		secTmplRes.Url = base64.StdEncoding.EncodeToString([]byte(helmInfo.RepoHost))
-	} else {
-		secTmplRes.Url = base64.StdEncoding.EncodeToString([]byte(helmInfo.RepoUri))
-	}
+// ProduceNoCredSecretYaml produces Argo CD helm repository secret for public repositories
+func ProduceNoCredSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string, helmInfo HelmRepoInfo) error {
+	return writeYaml(w, produceRepositorySecret(rd, namespace, repositorySecretData(rd, helmInfo)))
+}
 
-	tmpl, err := template.New("secrettmpl").Parse(secretTmpl)
-	if err != nil {
-		panic(err)
-	}
+func sealedSecretAnnotations(rd *RelizaDeployment) map[string]string {
+	annotations := cdResourceAnnotations(rd)
+	annotations["sealedsecrets.bitnami.com/namespace-wide"] = "true"
+	return annotations
+}
 
-	err = tmpl.Execute(w, secTmplRes)
-	if err != nil {
-		panic(err)
+func produceRepositorySecret(rd *RelizaDeployment, namespace string, secretData map[string]string) k8sSecret {
+	secretLabels := cdResourceLabels(rd.Name)
+	secretLabels["argocd.argoproj.io/secret-type"] = "repository"
+	return k8sSecret{
+		ApiVersion: "v1",
+		Kind:       "Secret",
+		Metadata: objectMetadata{
+			Name:        rd.Name,
+			Namespace:   namespace,
+			Annotations: cdResourceAnnotations(rd),
+			Labels:      secretLabels,
+		},
+		Type: "Opaque",
+		Data: base64Data(secretData),
 	}
 }
 
-func ProduceEcrSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string) {
-	secretTmpl :=
-		`apiVersion: bitnami.com/v1alpha1
-kind: SealedSecret
-metadata:
-  name: {{.Name}}
-  namespace: {{.Namespace}}
-  annotations:
-    sealedsecrets.bitnami.com/namespace-wide: "true"
-  labels:
-    reliza.io/type: cdresource
-    reliza.io/name: {{.Name}}
-spec:
-  encryptedData:
-    username: {{.Username}}
-    password: {{.Password}}
-  template:
-    data:
-      url: {{.Url}}
-    metadata:
-      labels:
-        reliza.io/name: {{.Name}}
-        reliza.io/type: cdresource`
-
-	var secTmplRes SecretTemplateResolver
-	secTmplRes.Name = "ecr-" + rd.Name
-	secTmplRes.Namespace = namespace
-	secTmplRes.Username = projAuth.Login
-	secTmplRes.Password = projAuth.Password
-	secTmplRes.Url = rd.ArtUri
-
-	tmpl, err := template.New("secrettmpl").Parse(secretTmpl)
-	if err != nil {
-		panic(err)
-	}
+// ProduceRegistryCredentialsSecretYaml produces sealed secret with long-lived cloud credentials, which are exchanged for registry tokens
+func ProduceRegistryCredentialsSecretYaml(w io.Writer, rd *RelizaDeployment, projAuth ProjectAuth, namespace string, secretName string) error {
+	secret := sealedSecret{
+		ApiVersion: "bitnami.com/v1alpha1",
+		Kind:       "SealedSecret",
+		Metadata: objectMetadata{
+			Name:        secretName,
+			Namespace:   namespace,
+			Annotations: sealedSecretAnnotations(rd),
+			Labels:      cdResourceLabels(secretName),
+		},
+		Spec: sealedSecretSpec{
+			EncryptedData: sealedCredentialsData(projAuth),
+			Template: sealedSecretTemplate{
+				Data:     map[string]string{"url": rd.ArtUri},
+				Metadata: objectMetadata{Labels: cdResourceLabels(secretName), Annotations: cdResourceAnnotations(rd)},
+			},
+		},
+	}
+	return writeYaml(w, secret)
+}
 
-	err = tmpl.Execute(w, secTmplRes)
-	if err != nil {
-		panic(err)
-	}
+func IsSecretPresent(name string, namespace string) bool {
+	_, _, err := shellout(KubectlApp + " get secret " + name + " -n " + namespace)
+	return err == nil
 }
 
-func WaitUntilSecretCreated(name string, namespace string) {
-	secretWaitCmd := "while ! " + KubectlApp + " get secret " + name + " -n " + namespace + "; do sleep 1; done"
-	shellout(secretWaitCmd)
+// WaitUntilSecretCreated waits for secret to appear in the namespace, i.e. after its SealedSecret or ExternalSecret is applied,
+// for up to SECRET_WAIT_TIMEOUT seconds
+func WaitUntilSecretCreated(name string, namespace string) error {
+	deadline := time.Now().Add(secretWaitTimeout)
+	for !IsSecretPresent(name, namespace) {
+		if time.Now().After(deadline) {
+			sugar.Errorw("Timed out waiting for secret to be created",
+				"secret", name,
+				"namespace", namespace,
+				"timeout", secretWaitTimeout.String())
+			return errors.New("timed out waiting for secret " + name + " in namespace " + namespace)
+		}
+		time.Sleep(secretWaitPollInterval)
+	}
+	return nil
 }
 
 func IsFirstInstallDone(rd *RelizaDeployment) bool {
@@ -520,24 +477,19 @@ func IsFirstInstallDone(rd *RelizaDeployment) bool {
 func InstallApplication(groupPath string, rd *RelizaDeployment) error {
 	var err error
 
-	if argoInfo.IsArgoEnabled {
+	if IsApplicationSetMode() {
+		err = recordApplicationSetElement(groupPath, rd)
+	} else if argoInfo.IsArgoEnabled {
 		err = installArgoApplication(groupPath, rd, argoInfo.ArgoNamespace)
+	} else if IsFirstHelmInstallDone(rd) && isCanaryRollout(rd) {
+		// canary only makes sense when there is a main release to promote into
+		err = InstallHelmChartWithCanary(groupPath, rd)
 	} else {
 		err = InstallHelmChart(groupPath, rd)
 	}
 	return err
 }
 
-type SecretTemplateResolver struct {
-	Name       string
-	Namespace  string
-	Username   string
-	Password   string
-	Url        string
-	NameBase64 string
-	EnableOci  string
-}
-
 type RelizaDeployment struct {
 	Name       string
 	Namespace  string
@@ -547,6 +499,8 @@ type RelizaDeployment struct {
 	ArtHash    cdx.Hash
 	ConfigFile string
 	AppVersion string
+	Type       string
+	Cluster    string
 }
 
 type ProjectAuth struct {
@@ -0,0 +1,349 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	clustersDir              = "clusters"
+	defaultKubeconfigKey     = "kubeconfig"
+	argoClusterSecretPrefix  = "reliza-cluster-"
+	argoClusterSecretTypeKey = "argocd.argoproj.io/secret-type"
+)
+
+type TargetClustersConfig struct {
+	Clusters []TargetCluster `yaml:"clusters"`
+}
+
+// TargetCluster is a cluster deployments are sent to instead of the one reliza-cd runs in. Deployments whose namespace
+// or bundle matches one of the glob patterns target the first matching cluster.
+type TargetCluster struct {
+	Name             string   `yaml:"name"`
+	KubeconfigSecret string   `yaml:"kubeconfigSecret"`
+	KubeconfigKey    string   `yaml:"kubeconfigKey"`
+	Namespaces       []string `yaml:"namespaces"`
+	Bundles          []string `yaml:"bundles"`
+}
+
+// kubeconfig is the subset of kubeconfig file needed to register a cluster in Argo CD
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTlsVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Username              string `yaml:"username"`
+			Password              string `yaml:"password"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+type argoClusterTlsConfig struct {
+	Insecure bool   `json:"insecure,omitempty"`
+	CaData   string `json:"caData,omitempty"`
+	CertData string `json:"certData,omitempty"`
+	KeyData  string `json:"keyData,omitempty"`
+}
+
+type argoClusterConfig struct {
+	BearerToken     string               `json:"bearerToken,omitempty"`
+	Username        string               `json:"username,omitempty"`
+	Password        string               `json:"password,omitempty"`
+	TlsClientConfig argoClusterTlsConfig `json:"tlsClientConfig"`
+}
+
+var (
+	targetClustersConfig TargetClustersConfig
+	syncedKubeconfigs    = map[string]string{}
+)
+
+func initTargetClustersConfig() {
+	targetClustersFile := os.Getenv("TARGET_CLUSTERS_FILE")
+	if len(targetClustersFile) < 1 {
+		return
+	}
+	targetClustersBytes, err := os.ReadFile(targetClustersFile)
+	if err == nil {
+		err = yaml.Unmarshal(targetClustersBytes, &targetClustersConfig)
+	}
+	if err != nil {
+		sugar.Error("Failed to read TARGET_CLUSTERS_FILE: ", err)
+		return
+	}
+	for i := range targetClustersConfig.Clusters {
+		if len(targetClustersConfig.Clusters[i].KubeconfigKey) < 1 {
+			targetClustersConfig.Clusters[i].KubeconfigKey = defaultKubeconfigKey
+		}
+	}
+	sugar.Info("Loaded target clusters configuration with ", len(targetClustersConfig.Clusters), " clusters")
+}
+
+// resolveTargetCluster returns name of the first cluster whose namespace or bundle patterns match, empty for in-cluster deployments
+func resolveTargetCluster(namespace string, bundle string) string {
+	for _, cluster := range targetClustersConfig.Clusters {
+		if matchesAnyPattern(namespace, cluster.Namespaces) || matchesAnyPattern(bundle, cluster.Bundles) {
+			return cluster.Name
+		}
+	}
+	return ""
+}
+
+func matchesAnyPattern(value string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func clusterKubeconfigPath(clusterName string) string {
+	return filepath.Join(clustersDir, clusterName+".kubeconfig")
+}
+
+// ClusterFlags returns helm and kubectl flags targeting the cluster of rd
+func ClusterFlags(rd *RelizaDeployment) string {
+	return clusterFlags(rd.Cluster)
+}
+
+// clusterFlags returns helm and kubectl flags targeting the named cluster, empty for the cluster reliza-cd runs in
+func clusterFlags(cluster string) string {
+	if len(cluster) < 1 {
+		return ""
+	}
+	return " --kubeconfig " + clusterKubeconfigPath(cluster)
+}
+
+// clusterNamespace identifies namespace in its cluster, namespaces of the cluster reliza-cd runs in are identified by name only
+func clusterNamespace(cluster string, namespace string) string {
+	if len(cluster) < 1 {
+		return namespace
+	}
+	return cluster + "." + namespace
+}
+
+// splitClusterNamespace returns cluster and namespace of clusterNamespace, namespace names may not contain dots
+func splitClusterNamespace(clusterNs string) (string, string) {
+	sepIndex := strings.LastIndex(clusterNs, ".")
+	if sepIndex < 0 {
+		return "", clusterNs
+	}
+	return clusterNs[:sepIndex], clusterNs[sepIndex+1:]
+}
+
+// recordedDeploymentCluster returns target cluster recorded for the workspace deployment when it was last installed
+func recordedDeploymentCluster(name string) string {
+	recordedData, err := os.ReadFile("workspace/" + name + "/" + RecordedDeloyedData)
+	if err != nil {
+		return ""
+	}
+	var rd RelizaDeployment
+	json.Unmarshal(recordedData, &rd)
+	return rd.Cluster
+}
+
+// SyncClusterKubeconfigs writes kubeconfigs of target clusters from their secrets in reliza-cd namespace into clusters directory,
+// in Argo CD modes changed kubeconfigs are also registered as Argo CD clusters
+func SyncClusterKubeconfigs() {
+	for _, cluster := range targetClustersConfig.Clusters {
+		encodedKubeconfig, _, err := shellout(KubectlApp + " get secret " + cluster.KubeconfigSecret + " -n " + RelizaNamespace + " -o jsonpath='{.data." + strings.ReplaceAll(cluster.KubeconfigKey, ".", "\\.") + "}'")
+		var kubeconfigBytes []byte
+		if err == nil {
+			kubeconfigBytes, err = base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKubeconfig))
+		}
+		if err == nil && len(kubeconfigBytes) < 1 {
+			err = errors.New("kubeconfig key " + cluster.KubeconfigKey + " is empty")
+		}
+		if err != nil {
+			sugar.Errorw("Failed to read kubeconfig of target cluster",
+				"cluster", cluster.Name,
+				"secret", cluster.KubeconfigSecret,
+				"error", err)
+			continue
+		}
+		if syncedKubeconfigs[cluster.Name] == string(kubeconfigBytes) {
+			continue
+		}
+		os.MkdirAll(clustersDir, 0700)
+		err = os.WriteFile(clusterKubeconfigPath(cluster.Name), kubeconfigBytes, 0600)
+		if err == nil && argoInfo.IsArgoEnabled {
+			err = registerArgoCluster(cluster.Name, kubeconfigBytes)
+		}
+		if err != nil {
+			sugar.Errorw("Failed to sync target cluster", "cluster", cluster.Name, "error", err)
+			continue
+		}
+		syncedKubeconfigs[cluster.Name] = string(kubeconfigBytes)
+		sugar.Info("Synced kubeconfig of target cluster ", cluster.Name)
+	}
+	removeDroppedClusters()
+}
+
+// removeDroppedClusters removes kubeconfigs and, in Argo CD modes, Argo CD cluster secrets of clusters which are no longer
+// in TARGET_CLUSTERS_FILE. Cluster secrets are listed from the cluster, so that clusters dropped while reliza-cd was not running are found.
+func removeDroppedClusters() {
+	configuredClusters := map[string]bool{}
+	for _, cluster := range targetClustersConfig.Clusters {
+		configuredClusters[cluster.Name] = true
+	}
+	kubeconfigPaths, _ := filepath.Glob(filepath.Join(clustersDir, "*.kubeconfig"))
+	for _, kubeconfigPath := range kubeconfigPaths {
+		clusterName := strings.TrimSuffix(filepath.Base(kubeconfigPath), ".kubeconfig")
+		if configuredClusters[clusterName] {
+			continue
+		}
+		os.Remove(kubeconfigPath)
+		os.Remove(filepath.Join(clustersDir, clusterName+"-argo-cluster.yaml"))
+		delete(syncedKubeconfigs, clusterName)
+		sugar.Info("Removed kubeconfig of cluster dropped from TARGET_CLUSTERS_FILE ", clusterName)
+	}
+	if !argoInfo.IsArgoEnabled {
+		return
+	}
+	selector := argoClusterSecretTypeKey + "=cluster,reliza.io/managed-by=" + FieldManager
+	if len(instanceId) > 0 {
+		selector += ",reliza.io/instance=" + instanceId
+	}
+	secretNames, _, err := shellout(KubectlApp + " get secret -l '" + selector + "' -n " + SecretsNamespace + " -o jsonpath='{.items[*].metadata.name}'")
+	if err != nil {
+		return
+	}
+	for _, secretName := range strings.Fields(secretNames) {
+		clusterName := strings.TrimPrefix(secretName, argoClusterSecretPrefix)
+		if !strings.HasPrefix(secretName, argoClusterSecretPrefix) || configuredClusters[clusterName] {
+			continue
+		}
+		_, stderr, err := dryRunShellout(KubectlApp + " delete secret " + secretName + " -n " + SecretsNamespace + " --ignore-not-found")
+		if err != nil {
+			sugar.Errorw("Failed to remove Argo CD cluster dropped from TARGET_CLUSTERS_FILE",
+				"cluster", clusterName,
+				"stderr", stderr,
+				"error", err)
+			continue
+		}
+		sugar.Info("Removed Argo CD cluster dropped from TARGET_CLUSTERS_FILE ", clusterName)
+	}
+}
+
+func registerArgoCluster(clusterName string, kubeconfigBytes []byte) error {
+	var clusterSecretYaml bytes.Buffer
+	err := ProduceArgoClusterSecretYaml(&clusterSecretYaml, clusterName, kubeconfigBytes, SecretsNamespace)
+	if err != nil {
+		return err
+	}
+	clusterSecretPath := filepath.Join(clustersDir, clusterName+"-argo-cluster.yaml")
+	err = os.WriteFile(clusterSecretPath, clusterSecretYaml.Bytes(), 0600)
+	if err == nil {
+		err = KubectlApply(clusterSecretPath)
+	}
+	return err
+}
+
+// ProduceArgoClusterSecretYaml produces declarative Argo CD cluster secret from server and credentials of current context of the kubeconfig
+func ProduceArgoClusterSecretYaml(w io.Writer, clusterName string, kubeconfigBytes []byte, namespace string) error {
+	var kc kubeconfig
+	err := yaml.Unmarshal(kubeconfigBytes, &kc)
+	if err != nil {
+		return err
+	}
+	contextCluster, contextUser := "", ""
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext || len(kc.CurrentContext) < 1 {
+			contextCluster, contextUser = c.Context.Cluster, c.Context.User
+			break
+		}
+	}
+	var server string
+	var clusterConfig argoClusterConfig
+	for _, c := range kc.Clusters {
+		if c.Name == contextCluster {
+			server = c.Cluster.Server
+			clusterConfig.TlsClientConfig.CaData = c.Cluster.CertificateAuthorityData
+			clusterConfig.TlsClientConfig.Insecure = c.Cluster.InsecureSkipTlsVerify
+		}
+	}
+	if len(server) < 1 {
+		return errors.New("no server found for current context of kubeconfig of cluster " + clusterName)
+	}
+	for _, u := range kc.Users {
+		if u.Name == contextUser {
+			clusterConfig.BearerToken = u.User.Token
+			clusterConfig.Username = u.User.Username
+			clusterConfig.Password = u.User.Password
+			clusterConfig.TlsClientConfig.CertData = u.User.ClientCertificateData
+			clusterConfig.TlsClientConfig.KeyData = u.User.ClientKeyData
+		}
+	}
+	clusterConfigJson, err := json.Marshal(clusterConfig)
+	if err != nil {
+		return err
+	}
+	labels := namespaceOwnershipLabels()
+	labels[argoClusterSecretTypeKey] = "cluster"
+	clusterSecret := k8sSecret{
+		ApiVersion: "v1",
+		Kind:       "Secret",
+		Metadata: objectMetadata{
+			Name:      argoClusterSecretPrefix + clusterName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Type: "Opaque",
+		Data: base64Data(map[string]string{
+			"name":   clusterName,
+			"server": server,
+			"config": string(clusterConfigJson),
+		}),
+	}
+	return writeYaml(w, clusterSecret)
+}
+
+// resolveArgoDestination targets registered cluster by name for deployments mapped to a target cluster, otherwise the cluster Argo CD runs in
+func resolveArgoDestination(rd *RelizaDeployment) argoDestination {
+	if len(rd.Cluster) > 0 {
+		return argoDestination{Namespace: rd.Namespace, Name: rd.Cluster}
+	}
+	return argoDestination{Namespace: rd.Namespace, Server: "https://kubernetes.default.svc"}
+}
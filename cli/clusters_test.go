@@ -0,0 +1,121 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: eu-prod
+contexts:
+  - name: other
+    context:
+      cluster: other
+      user: other
+  - name: eu-prod
+    context:
+      cluster: eu-prod
+      user: deployer
+clusters:
+  - name: other
+    cluster:
+      server: https://other.example.com
+  - name: eu-prod
+    cluster:
+      server: https://eu-prod.example.com:6443
+      certificate-authority-data: Y2EtZGF0YQ==
+users:
+  - name: other
+    user:
+      token: other-token
+  - name: deployer
+    user:
+      token: deployer-token
+`
+
+func TestResolveTargetCluster(t *testing.T) {
+	targetClustersConfig = TargetClustersConfig{Clusters: []TargetCluster{
+		{Name: "eu-prod", Namespaces: []string{"prod-eu-*"}},
+		{Name: "payments", Bundles: []string{"payments*"}},
+	}}
+	defer func() { targetClustersConfig = TargetClustersConfig{} }()
+
+	testCases := map[[2]string]string{
+		{"prod-eu-1", "payments-api"}: "eu-prod",
+		{"prod-us", "payments-api"}:   "payments",
+		{"prod-us", "shop"}:           "",
+	}
+	for nsBundle, expected := range testCases {
+		actual := resolveTargetCluster(nsBundle[0], nsBundle[1])
+		if actual != expected {
+			t.Errorf("cluster of %v: expected %q, got %q", nsBundle, expected, actual)
+		}
+	}
+	if flags := ClusterFlags(&RelizaDeployment{Cluster: "eu-prod"}); flags != " --kubeconfig clusters/eu-prod.kubeconfig" {
+		t.Errorf("unexpected cluster flags %q", flags)
+	}
+}
+
+func TestProduceArgoClusterSecretYamlGolden(t *testing.T) {
+	var clusterSecretYaml bytes.Buffer
+	err := ProduceArgoClusterSecretYaml(&clusterSecretYaml, "eu-prod", []byte(testKubeconfig), "argocd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "argo-cluster-secret.yaml", clusterSecretYaml.Bytes())
+}
+
+func TestRemoveDroppedClusters(t *testing.T) {
+	t.Chdir(t.TempDir())
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *'get secret'*) echo 'reliza-cluster-eu-prod reliza-cluster-old';; esac",
+	})
+	prevArgoEnabled := argoInfo.IsArgoEnabled
+	t.Cleanup(func() {
+		argoInfo.IsArgoEnabled = prevArgoEnabled
+		targetClustersConfig = TargetClustersConfig{}
+		syncedKubeconfigs = map[string]string{}
+	})
+	argoInfo.IsArgoEnabled = true
+	targetClustersConfig = TargetClustersConfig{Clusters: []TargetCluster{{Name: "eu-prod"}}}
+	os.MkdirAll(clustersDir, 0700)
+	for _, clusterName := range []string{"eu-prod", "old"} {
+		os.WriteFile(clusterKubeconfigPath(clusterName), []byte(testKubeconfig), 0600)
+		syncedKubeconfigs[clusterName] = testKubeconfig
+	}
+
+	removeDroppedClusters()
+	if _, err := os.Stat(clusterKubeconfigPath("old")); !os.IsNotExist(err) {
+		t.Error("expected kubeconfig of dropped cluster to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(clustersDir, "eu-prod.kubeconfig")); err != nil {
+		t.Error("expected kubeconfig of configured cluster to be kept")
+	}
+	if _, synced := syncedKubeconfigs["old"]; synced {
+		t.Error("expected dropped cluster to be forgotten")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete secret reliza-cluster-old")) != 1 {
+		t.Error("expected Argo CD cluster secret of dropped cluster to be deleted")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete secret reliza-cluster-eu-prod")) != 0 {
+		t.Error("expected Argo CD cluster secret of configured cluster to be kept")
+	}
+}
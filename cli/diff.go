@@ -0,0 +1,334 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ValuesChanges    = "values-changes.yaml"
+	RenderedManifest = "rendered-manifest.yaml"
+	DeployedManifest = "deployed-manifest.yaml"
+	ManifestDiff     = "manifest.diff"
+	// DeployedValuesDiff holds values for diff of the installed change, values changes are computed against it
+	DeployedValuesDiff  = "deployed-values-diff.yaml"
+	PendingValuesChange = "pending-values-changes.yaml"
+	PendingManifestDiff = "pending-manifest.diff"
+	ValueChangeAdd      = "added"
+	ValueChangeRemove   = "removed"
+	ValueChangeModify   = "changed"
+)
+
+type ValueChange struct {
+	Path     string `yaml:"path"`
+	Change   string `yaml:"change"`
+	OldValue string `yaml:"old,omitempty"`
+	NewValue string `yaml:"new,omitempty"`
+}
+
+// ProduceDeploymentDiff records why a deployment is being (re)installed: a structured diff of values for diff
+// against the deployed values is written to values-changes.yaml and, in standalone mode, a diff of the rendered chart
+// against the deployed release manifest is written to manifest.diff. Both are logged.
+// For manifests and kustomize deployments only manifest.diff of rendered against applied manifests is produced.
+func ProduceDeploymentDiff(groupPath string, rd *RelizaDeployment) error {
+	if !IsHelmDeployment(rd) {
+		return produceManifestsDiff(groupPath, rd)
+	}
+	prevVal, err := os.ReadFile(groupPath + DeployedValuesDiff)
+	if err != nil && os.IsNotExist(err) {
+		// deployed before values for diff were recorded on install
+		prevVal, err = os.ReadFile(groupPath + ValuesDiffPrev)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		sugar.Error(err)
+		return err
+	}
+	newVal, err := os.ReadFile(groupPath + ValuesDiff)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+
+	valueChanges, err := ComputeValuesChanges(prevVal, newVal)
+	if err != nil {
+		sugar.Error("Failed to compute values diff: ", err)
+		return err
+	}
+	valueChangesYaml, err := yaml.Marshal(valueChanges)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	err = os.WriteFile(groupPath+ValuesChanges, valueChangesYaml, 0600)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	sugar.Infow("Values changes detected",
+		"bundle", rd.Bundle,
+		"version", rd.ArtVersion,
+		"namespace", rd.Namespace,
+		"changeCount", len(valueChanges))
+	for _, vc := range valueChanges {
+		sugar.Infow("Values change",
+			"bundle", rd.Bundle,
+			"path", vc.Path,
+			"change", vc.Change,
+			"old", vc.OldValue,
+			"new", vc.NewValue)
+	}
+
+	if !argoInfo.IsArgoEnabled {
+		err = produceManifestDiff(groupPath, rd)
+	}
+	return err
+}
+
+// recordDeployedValuesForDiff keeps values for diff of the installed change, so that diffs of later changes
+// are computed against what is deployed rather than against the previous loop.
+func recordDeployedValuesForDiff(groupPath string) {
+	valuesForDiff, err := os.ReadFile(groupPath + ValuesDiff)
+	if err != nil {
+		// manifests deployments have no values
+		return
+	}
+	err = os.WriteFile(groupPath+DeployedValuesDiff, valuesForDiff, 0600)
+	if err != nil {
+		sugar.Error(err)
+	}
+}
+
+// persistPendingDiff copies diffs produced for a newly detected change next to the pending change,
+// so that they stay available for review until the change is approved.
+func persistPendingDiff(groupPath string) {
+	for diffFile, pendingFile := range map[string]string{ValuesChanges: PendingValuesChange, ManifestDiff: PendingManifestDiff} {
+		os.Remove(groupPath + pendingFile)
+		diffData, err := os.ReadFile(groupPath + diffFile)
+		if err != nil {
+			continue
+		}
+		err = os.WriteFile(groupPath+pendingFile, diffData, 0600)
+		if err != nil {
+			sugar.Error(err)
+		}
+	}
+}
+
+func produceManifestDiff(groupPath string, rd *RelizaDeployment) error {
+	helmChartName := GetChartNameFromDeployment(rd)
+	rendered, stderr, err := shellout(HelmApp + " template " + helmChartName + " -n " + rd.Namespace + " -f " + groupPath + InstallValues + " " + groupPath + helmChartName)
+	if err != nil {
+		sugar.Error("Failed to render chart for diff: ", err, " stderr: ", stderr)
+		return err
+	}
+	deployed := ""
+	if IsFirstHelmInstallDone(rd) {
+		deployed, stderr, err = shellout(HelmApp + " get manifest " + helmChartName + " -n " + rd.Namespace + ClusterFlags(rd))
+		if err != nil {
+			sugar.Error("Failed to get deployed manifest for diff: ", err, " stderr: ", stderr)
+			return err
+		}
+	}
+
+	err = writeMaskedManifest(groupPath+RenderedManifest, rendered)
+	if err == nil {
+		err = writeMaskedManifest(groupPath+DeployedManifest, deployed)
+	}
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+
+	return writeManifestDiff(groupPath, rd, groupPath+DeployedManifest, groupPath+RenderedManifest)
+}
+
+func produceManifestsDiff(groupPath string, rd *RelizaDeployment) error {
+	applied, err := os.ReadFile(groupPath + ManifestsApplied)
+	if err != nil && !os.IsNotExist(err) {
+		sugar.Error(err)
+		return err
+	}
+	rendered, err := os.ReadFile(groupPath + ManifestsRendered)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	err = writeMaskedManifest(groupPath+RenderedManifest, string(rendered))
+	if err == nil {
+		err = writeMaskedManifest(groupPath+DeployedManifest, string(applied))
+	}
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	return writeManifestDiff(groupPath, rd, groupPath+DeployedManifest, groupPath+RenderedManifest)
+}
+
+func writeManifestDiff(groupPath string, rd *RelizaDeployment, deployedPath string, renderedPath string) error {
+	// diff exits with 1 when files differ, which is the expected case here
+	manifestDiff, _, err := shellout("diff -u " + deployedPath + " " + renderedPath + " > " + groupPath + ManifestDiff + "; cat " + groupPath + ManifestDiff)
+	if err != nil {
+		return err
+	}
+	added, removed := countDiffLines(manifestDiff)
+	sugar.Infow("Manifest diff against deployed release",
+		"bundle", rd.Bundle,
+		"version", rd.ArtVersion,
+		"namespace", rd.Namespace,
+		"linesAdded", added,
+		"linesRemoved", removed,
+		"diffFile", groupPath+ManifestDiff)
+	sugar.Debug("Manifest diff:\n", manifestDiff)
+	return nil
+}
+
+func countDiffLines(unifiedDiff string) (int, int) {
+	added := 0
+	removed := 0
+	for _, line := range strings.Split(unifiedDiff, "\n") {
+		if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
+			added++
+		} else if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func writeMaskedManifest(path string, manifest string) error {
+	var buf bytes.Buffer
+	err := maskSecretsInManifest(strings.NewReader(manifest), &buf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// maskSecretsInManifest re-encodes a multi-document manifest replacing values of Secret data and stringData
+// with their digests, so that manifest diffs can be stored and logged without exposing secret material.
+func maskSecretsInManifest(r io.Reader, w io.Writer) error {
+	decoder := yaml.NewDecoder(r)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	for {
+		var doc map[string]interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if doc == nil {
+			continue
+		}
+		if doc["kind"] == "Secret" {
+			for _, dataKey := range []string{"data", "stringData"} {
+				if data, ok := doc[dataKey].(map[string]interface{}); ok {
+					for k, v := range data {
+						digest := sha256.Sum256([]byte(fmt.Sprint(v)))
+						data[k] = "masked-sha256:" + hex.EncodeToString(digest[:])
+					}
+				}
+			}
+		}
+		err = encoder.Encode(doc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ComputeValuesChanges compares two values yaml documents and returns added, removed and changed leaf values
+// sorted by path.
+func ComputeValuesChanges(prevValues []byte, newValues []byte) ([]ValueChange, error) {
+	prevFlat, err := flattenValues(prevValues)
+	if err != nil {
+		return nil, err
+	}
+	newFlat, err := flattenValues(newValues)
+	if err != nil {
+		return nil, err
+	}
+
+	valueChanges := []ValueChange{}
+	for path, newVal := range newFlat {
+		prevVal, exists := prevFlat[path]
+		if !exists {
+			valueChanges = append(valueChanges, ValueChange{Path: path, Change: ValueChangeAdd, NewValue: newVal})
+		} else if prevVal != newVal {
+			valueChanges = append(valueChanges, ValueChange{Path: path, Change: ValueChangeModify, OldValue: prevVal, NewValue: newVal})
+		}
+	}
+	for path, prevVal := range prevFlat {
+		if _, exists := newFlat[path]; !exists {
+			valueChanges = append(valueChanges, ValueChange{Path: path, Change: ValueChangeRemove, OldValue: prevVal})
+		}
+	}
+	sort.Slice(valueChanges, func(i, j int) bool {
+		return valueChanges[i].Path < valueChanges[j].Path
+	})
+	return valueChanges, nil
+}
+
+func flattenValues(values []byte) (map[string]string, error) {
+	flat := make(map[string]string)
+	var parsed interface{}
+	err := yaml.Unmarshal(values, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	flattenValuesNode("", parsed, flat)
+	return flat, nil
+}
+
+func flattenValuesNode(path string, node interface{}, flat map[string]string) {
+	switch typedNode := node.(type) {
+	case map[string]interface{}:
+		for k, v := range typedNode {
+			childPath := k
+			if len(path) > 0 {
+				childPath = path + "." + k
+			}
+			flattenValuesNode(childPath, v, flat)
+		}
+	case []interface{}:
+		for i, v := range typedNode {
+			flattenValuesNode(path+"["+strconv.Itoa(i)+"]", v, flat)
+		}
+	case nil:
+		if len(path) > 0 {
+			flat[path] = "null"
+		}
+	default:
+		// scalar root document, i.e. placeholder of ResolvePreviousDiffFile, carries no values
+		if len(path) > 0 {
+			flat[path] = fmt.Sprint(typedNode)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestComputeValuesChanges(t *testing.T) {
+	prevValues := []byte("image:\n  tag: 1.0.0\n  pullPolicy: Always\nreplicas: 1\nports:\n- 80\n")
+	newValues := []byte("image:\n  tag: 1.0.1\n  pullPolicy: Always\nports:\n- 80\n- 443\nresources: {}\n")
+	valueChanges, err := ComputeValuesChanges(prevValues, newValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ValueChange{
+		{Path: "image.tag", Change: ValueChangeModify, OldValue: "1.0.0", NewValue: "1.0.1"},
+		{Path: "ports[1]", Change: ValueChangeAdd, NewValue: "443"},
+		{Path: "replicas", Change: ValueChangeRemove, OldValue: "1"},
+	}
+	if len(valueChanges) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), valueChanges)
+	}
+	for i := range expected {
+		if valueChanges[i] != expected[i] {
+			t.Fatalf("change %d: expected %v, got %v", i, expected[i], valueChanges[i])
+		}
+	}
+}
+
+func TestComputeValuesChangesFromPlaceholder(t *testing.T) {
+	valueChanges, err := ComputeValuesChanges([]byte("no prev values file present yet\n"), []byte("replicas: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(valueChanges) != 1 || valueChanges[0].Change != ValueChangeAdd {
+		t.Fatalf("expected single added value, got %v", valueChanges)
+	}
+}
+
+func TestMaskSecretsInManifest(t *testing.T) {
+	manifest := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: c2VjcmV0\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\ndata:\n  key: visible\n"
+	var out bytes.Buffer
+	err := maskSecretsInManifest(strings.NewReader(manifest), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "c2VjcmV0") {
+		t.Fatalf("secret value was not masked: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "masked-sha256:") || !strings.Contains(out.String(), "visible") {
+		t.Fatalf("unexpected masked manifest: %s", out.String())
+	}
+}
+
+func TestDiffIsKeptWithPendingChange(t *testing.T) {
+	fakeTools(t, map[string]string{"reliza-cli": "echo '{\"properties\":[]}'"})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	prevArgoEnabled := argoInfo.IsArgoEnabled
+	argoInfo.IsArgoEnabled = true
+	defer func() { argoInfo.IsArgoEnabled = prevArgoEnabled }()
+
+	// values of previous loop already match the change, diff is computed against the deployed values
+	os.WriteFile(groupPath+DeployedValuesDiff, []byte("replicas: 1\n"), 0600)
+	os.WriteFile(groupPath+ValuesDiffPrev, []byte("replicas: 2\n"), 0600)
+	os.WriteFile(groupPath+ValuesDiff, []byte("replicas: 2\n"), 0600)
+	err := ProduceDeploymentDiff(groupPath, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = IsChangeApproved(groupPath, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(groupPath+ValuesChanges, []byte("[]\n"), 0600)
+	pendingChanges, err := os.ReadFile(groupPath + PendingValuesChange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(pendingChanges), "path: replicas") {
+		t.Errorf("expected replicas change to be kept with pending change, got %s", pendingChanges)
+	}
+	pendingYaml, _ := os.ReadFile(groupPath + PendingChangeYaml)
+	if !strings.Contains(string(pendingYaml), "valuesChanges:") {
+		t.Errorf("expected values changes in pending change ConfigMap, got %s", pendingYaml)
+	}
+}
+
+func TestManifestsDiffAndDigest(t *testing.T) {
+	fakeTools(t, nil)
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	rd.Type = DeploymentTypeKustomize
+
+	os.WriteFile(groupPath+ManifestsApplied, []byte("kind: ConfigMap\ndata:\n  key: old\n"), 0600)
+	os.WriteFile(groupPath+ManifestsRendered, []byte("kind: ConfigMap\ndata:\n  key: new\n"), 0600)
+	err := ProduceDeploymentDiff(groupPath, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestDiff, _ := os.ReadFile(groupPath + ManifestDiff)
+	if !strings.Contains(string(manifestDiff), "-  key: old") || !strings.Contains(string(manifestDiff), "+  key: new") {
+		t.Errorf("unexpected manifest diff:\n%s", manifestDiff)
+	}
+
+	digest, err := ComputeChangeDigest(groupPath, &rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(groupPath+ManifestsRendered, []byte("kind: ConfigMap\ndata:\n  key: newer\n"), 0600)
+	newDigest, _ := ComputeChangeDigest(groupPath, &rd)
+	if newDigest == digest {
+		t.Error("expected digest to change with rendered manifests")
+	}
+}
@@ -0,0 +1,280 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RecordedReleaseState = "recorded-release-state.json"
+	DriftReport          = "drift-report.json"
+	DriftPolicyReport    = "report"
+	DriftPolicyHeal      = "heal"
+)
+
+var (
+	driftPolicies      map[string]string
+	driftCheckInterval time.Duration
+	lastDriftChecks    = map[string]time.Time{}
+)
+
+type ReleaseState struct {
+	Chart        string `json:"chart"`
+	Revision     int    `json:"revision"`
+	ValuesHash   string `json:"valuesHash"`
+	ManifestHash string `json:"manifestHash"`
+}
+
+type DriftResult struct {
+	Name         string       `json:"name"`
+	Namespace    string       `json:"namespace"`
+	Bundle       string       `json:"bundle"`
+	Policy       string       `json:"policy"`
+	Reasons      []string     `json:"reasons"`
+	DetectedAt   string       `json:"detectedAt"`
+	Recorded     ReleaseState `json:"recorded"`
+	Live         ReleaseState `json:"live"`
+	LiveModified bool         `json:"liveModified"`
+}
+
+type helmListEntry struct {
+	Name     string `json:"name"`
+	Revision string `json:"revision"`
+	Chart    string `json:"chart"`
+}
+
+func initDriftConfig() {
+	driftPolicies = parseNamespacePolicies(os.Getenv("DRIFT_DETECTION"))
+	driftCheckInterval = 5 * time.Minute
+	if len(os.Getenv("DRIFT_CHECK_INTERVAL")) > 0 {
+		intervalSeconds, err := strconv.Atoi(os.Getenv("DRIFT_CHECK_INTERVAL"))
+		if err != nil {
+			sugar.Error("Failed to parse DRIFT_CHECK_INTERVAL, using default: ", err)
+		} else {
+			driftCheckInterval = time.Duration(intervalSeconds) * time.Second
+		}
+	}
+}
+
+// parseNamespacePolicies parses comma-separated list of namespace:policy pairs, i.e. "prod:report,dev:heal,*:report"
+func parseNamespacePolicies(policyList string) map[string]string {
+	policies := make(map[string]string)
+	for _, nsPolicy := range strings.Split(policyList, ",") {
+		nsPolicySplit := strings.SplitN(strings.TrimSpace(nsPolicy), ":", 2)
+		if len(nsPolicySplit) == 2 && len(nsPolicySplit[0]) > 0 {
+			policies[nsPolicySplit[0]] = strings.ToLower(strings.TrimSpace(nsPolicySplit[1]))
+		}
+	}
+	return policies
+}
+
+func getDriftPolicy(namespace string) string {
+	policy, exists := driftPolicies[namespace]
+	if !exists {
+		policy = driftPolicies["*"]
+	}
+	return policy
+}
+
+// IsDriftCheckDue returns true if drift detection is enabled for the namespace of rd and
+// DRIFT_CHECK_INTERVAL has passed since the last check. Drift detection of helm releases only applies in standalone mode,
+// manifests and kustomize deployments are applied by reliza-cd in all modes.
+func IsDriftCheckDue(rd *RelizaDeployment) bool {
+	if argoInfo.IsArgoEnabled && IsHelmDeployment(rd) {
+		return false
+	}
+	policy := getDriftPolicy(rd.Namespace)
+	if policy != DriftPolicyReport && policy != DriftPolicyHeal {
+		return false
+	}
+	return time.Since(lastDriftChecks[rd.Name]) >= driftCheckInterval
+}
+
+// CheckDrift compares the live helm release of rd with the state recorded at install time and
+// with the live cluster objects. Drift is written to drift-report.json, logged and reported to Reliza Hub.
+// Returns true if drift was found and namespace policy requires the release to be re-applied.
+func CheckDrift(groupPath string, rd *RelizaDeployment) bool {
+	lastDriftChecks[rd.Name] = time.Now()
+	if !IsHelmDeployment(rd) {
+		return checkManifestsDrift(groupPath, rd)
+	}
+
+	recordedStateBytes, err := os.ReadFile(groupPath + RecordedReleaseState)
+	if err != nil {
+		// nothing recorded yet, release was not installed by this version of reliza-cd
+		sugar.Debug("No recorded release state for ", rd.Name, ", skipping drift check")
+		return false
+	}
+	var recorded ReleaseState
+	err = json.Unmarshal(recordedStateBytes, &recorded)
+	if err != nil {
+		sugar.Error(err)
+		return false
+	}
+
+	live, err := resolveReleaseState(rd)
+	if err != nil {
+		return false
+	}
+
+	var driftResult DriftResult
+	if live.Chart != recorded.Chart {
+		driftResult.Reasons = append(driftResult.Reasons, "chart changed from "+recorded.Chart+" to "+live.Chart)
+	}
+	if live.ValuesHash != recorded.ValuesHash {
+		driftResult.Reasons = append(driftResult.Reasons, "release values changed")
+	}
+	if live.ManifestHash != recorded.ManifestHash {
+		driftResult.Reasons = append(driftResult.Reasons, "release manifest changed")
+	}
+	if live.Revision != recorded.Revision {
+		driftResult.Reasons = append(driftResult.Reasons, "release revision changed from "+strconv.Itoa(recorded.Revision)+" to "+strconv.Itoa(live.Revision))
+	}
+	driftResult.LiveModified = isLiveObjectsModified(rd)
+	if driftResult.LiveModified {
+		driftResult.Reasons = append(driftResult.Reasons, "live objects differ from release manifest")
+	}
+
+	if len(driftResult.Reasons) < 1 {
+		os.Remove(groupPath + DriftReport)
+		return false
+	}
+
+	driftResult.Recorded = recorded
+	driftResult.Live = live
+	return reportDrift(groupPath, rd, driftResult)
+}
+
+// checkManifestsDrift runs server-side kubectl diff of the last applied manifests against live objects,
+// with the same field manager that was used to apply them.
+func checkManifestsDrift(groupPath string, rd *RelizaDeployment) bool {
+	if _, err := os.Stat(groupPath + ManifestsApplied); err != nil {
+		return false
+	}
+	// kubectl diff exits with 1 when there are differences and with >1 on errors
+	exitCode, _, _ := shellout(KubectlApp + " diff --server-side --field-manager=" + FieldManager + " -n " + rd.Namespace + ClusterFlags(rd) + " -f " + groupPath + ManifestsApplied + " > /dev/null 2>&1; echo $?")
+	var driftResult DriftResult
+	driftResult.LiveModified = strings.TrimSpace(exitCode) == "1"
+	if !driftResult.LiveModified {
+		os.Remove(groupPath + DriftReport)
+		return false
+	}
+	driftResult.Reasons = append(driftResult.Reasons, "live objects differ from applied manifests")
+	return reportDrift(groupPath, rd, driftResult)
+}
+
+// reportDrift records drift of rd, returns true if namespace policy requires the deployment to be re-applied
+func reportDrift(groupPath string, rd *RelizaDeployment, driftResult DriftResult) bool {
+	driftResult.Name = rd.Name
+	driftResult.Namespace = rd.Namespace
+	driftResult.Bundle = rd.Bundle
+	driftResult.Policy = getDriftPolicy(rd.Namespace)
+	driftResult.DetectedAt = time.Now().UTC().Format(time.RFC3339)
+
+	drJson, err := json.Marshal(driftResult)
+	if err != nil {
+		sugar.Error(err)
+	} else {
+		os.WriteFile(groupPath+DriftReport, drJson, 0600)
+	}
+	reportToHub(DriftReportType, groupPath, rd, driftResult)
+
+	sugar.Warnw("Drift detected on reliza-managed release",
+		"bundle", rd.Bundle,
+		"version", rd.ArtVersion,
+		"namespace", rd.Namespace,
+		"policy", driftResult.Policy,
+		"reasons", strings.Join(driftResult.Reasons, "; "))
+
+	return driftResult.Policy == DriftPolicyHeal
+}
+
+// RecordReleaseState stores chart, revision, values and manifest hashes of the deployed helm release
+// to be used as a baseline for drift detection.
+func RecordReleaseState(groupPath string, rd *RelizaDeployment) {
+	if argoInfo.IsArgoEnabled || DryRun || !IsHelmDeployment(rd) {
+		return
+	}
+	releaseState, err := resolveReleaseState(rd)
+	if err != nil {
+		return
+	}
+	rsJson, err := json.Marshal(releaseState)
+	if err != nil {
+		sugar.Error(err)
+		return
+	}
+	err = os.WriteFile(groupPath+RecordedReleaseState, rsJson, 0600)
+	if err != nil {
+		sugar.Error(err)
+	}
+	os.Remove(groupPath + DriftReport)
+}
+
+func resolveReleaseState(rd *RelizaDeployment) (ReleaseState, error) {
+	var releaseState ReleaseState
+	helmChartName := GetChartNameFromDeployment(rd)
+
+	helmListOut, _, err := shellout(HelmApp + " list -f \"^" + helmChartName + "$\" -n " + rd.Namespace + ClusterFlags(rd) + " -o json")
+	if err != nil {
+		return releaseState, err
+	}
+	var helmList []helmListEntry
+	err = json.Unmarshal([]byte(helmListOut), &helmList)
+	if err != nil {
+		sugar.Error(err)
+		return releaseState, err
+	}
+	if len(helmList) > 0 {
+		releaseState.Chart = helmList[0].Chart
+		releaseState.Revision, _ = strconv.Atoi(helmList[0].Revision)
+	}
+
+	values, _, err := shellout(HelmApp + " get values " + helmChartName + " -n " + rd.Namespace + ClusterFlags(rd) + " -o json")
+	if err != nil {
+		return releaseState, err
+	}
+	releaseState.ValuesHash = hashString(values)
+
+	manifest, _, err := shellout(HelmApp + " get manifest " + helmChartName + " -n " + rd.Namespace + ClusterFlags(rd))
+	if err != nil {
+		return releaseState, err
+	}
+	releaseState.ManifestHash = hashString(manifest)
+	return releaseState, nil
+}
+
+// isLiveObjectsModified runs kubectl diff of the release manifest against live objects, which catches manual kubectl edits.
+// Diff is computed server-side as helm field manager, so only fields set by the release are compared and
+// defaults or fields managed by other controllers are not reported as drift.
+func isLiveObjectsModified(rd *RelizaDeployment) bool {
+	helmChartName := GetChartNameFromDeployment(rd)
+	// kubectl diff exits with 1 when there are differences and with >1 on errors
+	exitCode, _, _ := shellout(HelmApp + " get manifest " + helmChartName + " -n " + rd.Namespace + ClusterFlags(rd) + " | " + KubectlApp + " diff --server-side --field-manager=helm --force-conflicts -n " + rd.Namespace + ClusterFlags(rd) + " -f - > /dev/null 2>&1; echo $?")
+	return strings.TrimSpace(exitCode) == "1"
+}
+
+func hashString(s string) string {
+	digest := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
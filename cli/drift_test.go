@@ -0,0 +1,103 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeHelmRelease serves a helm release from files next to the stub tools, kubectl diff exits with the code stored in diff-exit
+var fakeHelmRelease = map[string]string{
+	"helm": `dir="$(dirname $0)/.."
+case "$*" in
+list*) echo '[{"name":"my-app","revision":"1","chart":"my-app-1.2.3"}]';;
+"get values"*) cat "$dir/values.json";;
+"get manifest"*) cat "$dir/manifest.yaml";;
+esac`,
+	"kubectl": `cat > /dev/null; exit $(cat "$(dirname $0)/../diff-exit" 2>/dev/null || echo 0)`,
+}
+
+func TestCheckDrift(t *testing.T) {
+	toolsPath := fakeTools(t, fakeHelmRelease)
+	os.WriteFile(filepath.Join(toolsPath, "values.json"), []byte(`{"replicas":1}`), 0600)
+	os.WriteFile(filepath.Join(toolsPath, "manifest.yaml"), []byte("kind: Deployment\n"), 0600)
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	prevPolicies := driftPolicies
+	driftPolicies = map[string]string{"prod": DriftPolicyHeal}
+	defer func() { driftPolicies = prevPolicies }()
+
+	RecordReleaseState(groupPath, &rd)
+	if CheckDrift(groupPath, &rd) {
+		t.Fatal("expected no drift right after install")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl diff --server-side --field-manager=helm")) != 1 {
+		t.Error("expected live objects to be compared with server-side diff as helm field manager")
+	}
+	if len(fakeToolCalls(t, toolsPath, "--sender reliza-cd-drift-")) != 0 {
+		t.Error("expected no drift report without drift")
+	}
+
+	// live object edited with kubectl
+	os.WriteFile(filepath.Join(toolsPath, "diff-exit"), []byte("1"), 0600)
+	if !CheckDrift(groupPath, &rd) {
+		t.Fatal("expected drift of live objects to be healed")
+	}
+	if _, err := os.Stat(groupPath + DriftReport); err != nil {
+		t.Error("expected drift report to be written")
+	}
+	if len(fakeToolCalls(t, toolsPath, "reliza-cli instdata", "--namespace prod --sender reliza-cd-drift-prod---my-app")) != 1 {
+		t.Error("expected drift to be reported to the Hub")
+	}
+
+	// release values changed with helm upgrade outside of reliza-cd, diff of live objects failing is not drift
+	os.WriteFile(filepath.Join(toolsPath, "diff-exit"), []byte("2"), 0600)
+	os.WriteFile(filepath.Join(toolsPath, "values.json"), []byte(`{"replicas":2}`), 0600)
+	driftPolicies = map[string]string{"prod": DriftPolicyReport}
+	if CheckDrift(groupPath, &rd) {
+		t.Error("expected drift not to be healed with report policy")
+	}
+	if len(fakeToolCalls(t, toolsPath, "--sender reliza-cd-drift-")) != 2 {
+		t.Error("expected values drift to be reported to the Hub")
+	}
+}
+
+func TestCheckManifestsDrift(t *testing.T) {
+	toolsPath := fakeTools(t, fakeHelmRelease)
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	rd.Type = DeploymentTypeManifests
+	prevPolicies := driftPolicies
+	driftPolicies = map[string]string{"*": DriftPolicyHeal}
+	defer func() { driftPolicies = prevPolicies }()
+
+	if CheckDrift(groupPath, &rd) {
+		t.Fatal("expected no drift before manifests are applied")
+	}
+	os.WriteFile(groupPath+ManifestsApplied, []byte("kind: ConfigMap\n"), 0600)
+	os.WriteFile(filepath.Join(toolsPath, "diff-exit"), []byte("1"), 0600)
+	if !CheckDrift(groupPath, &rd) {
+		t.Fatal("expected drift of live objects to be healed")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl diff --server-side --field-manager=reliza-cd -n prod -f "+groupPath+ManifestsApplied)) != 1 {
+		t.Error("expected applied manifests to be compared with live objects")
+	}
+	if len(fakeToolCalls(t, toolsPath, "--sender reliza-cd-drift-")) != 1 {
+		t.Error("expected drift to be reported to the Hub")
+	}
+}
@@ -0,0 +1,321 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OrphanGcPolicyOff    = "off"
+	OrphanGcPolicyReport = "report"
+	OrphanGcPolicyDelete = "delete"
+	helmReleaseKind      = "helmrelease"
+)
+
+var (
+	orphanGcPolicy   string
+	orphanGcInterval time.Duration
+	lastOrphanGc     time.Time
+	// credsSecretPrefixes prefix names of sealed cloud credentials secrets, which are labelled with their own name
+	credsSecretPrefixes = []string{"ecr-", "acr-", "gar-"}
+)
+
+// ManagedResource is a reliza-managed cluster object, Owner is the name of the deployment it belongs to. Cluster is set
+// for helm releases in target clusters.
+type ManagedResource struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Cluster   string
+	Owner     string
+	Instance  string
+	Protected bool
+}
+
+func initOrphanGcConfig() {
+	orphanGcPolicy = strings.ToLower(os.Getenv("ORPHAN_GC"))
+	if orphanGcPolicy != OrphanGcPolicyOff && orphanGcPolicy != OrphanGcPolicyDelete {
+		orphanGcPolicy = OrphanGcPolicyReport
+	}
+	orphanGcInterval = 10 * time.Minute
+	if len(os.Getenv("ORPHAN_GC_INTERVAL")) > 0 {
+		intervalSeconds, err := strconv.Atoi(os.Getenv("ORPHAN_GC_INTERVAL"))
+		if err != nil {
+			sugar.Error("Failed to parse ORPHAN_GC_INTERVAL, using default: ", err)
+		} else {
+			orphanGcInterval = time.Duration(intervalSeconds) * time.Second
+		}
+	}
+}
+
+// helmReleaseLabels returns labels set on helm release secrets of rd, so that releases can be traced back to their deployment
+// and to the instance which installed them
+func helmReleaseLabels(rd *RelizaDeployment) string {
+	labels := "reliza.io/managed-by=" + FieldManager + ",reliza.io/name=" + rd.Name
+	if len(instanceId) > 0 {
+		labels += ",reliza.io/instance=" + instanceId
+	}
+	return labels
+}
+
+func IsOrphanGcDue() bool {
+	return orphanGcPolicy != OrphanGcPolicyOff && time.Since(lastOrphanGc) >= orphanGcInterval
+}
+
+// GarbageCollectOrphans finds reliza-managed cluster objects which belong to neither current nor workspace-recorded
+// deployments, i.e. left behind after workspace volume was lost, and reports or deletes them depending on ORPHAN_GC policy.
+// Deployments known from the workspace are cleaned up by DeleteObsoleteDeployment instead. Deletions are subject to the same
+// safeguards as deletions of obsolete deployments: an orphan must be found on DELETION_GRACE_LOOPS passes and for
+// DELETION_GRACE_PERIOD, deletions count towards MAX_DELETIONS_PER_LOOP and need confirmation in PROTECTED_NAMESPACES.
+func GarbageCollectOrphans(knownDeployments map[string]bool) {
+	now := time.Now()
+	lastOrphanGc = now
+	if orphanGcPolicy == OrphanGcPolicyDelete && !loadAbsences() {
+		return
+	}
+	resources, err := listManagedResources()
+	if err != nil {
+		return
+	}
+	orphans := findOrphans(resources, knownDeployments, instanceId)
+	orphanKeys := map[string]bool{}
+	var candidates []string
+	candidateOrphans := map[string]ManagedResource{}
+	protectedNamespaces := map[string]bool{}
+	for _, orphan := range orphans {
+		sugar.Warnw("Found orphaned reliza-managed resource",
+			"kind", orphan.Kind,
+			"name", orphan.Name,
+			"namespace", orphan.Namespace,
+			"owner", orphan.Owner,
+			"protected", orphan.Protected,
+			"policy", orphanGcPolicy)
+		if orphanGcPolicy != OrphanGcPolicyDelete || orphan.Protected || isOrphanNamespaceProtected(orphan, protectedNamespaces) {
+			continue
+		}
+		key := orphanAbsenceKey(orphan)
+		orphanKeys[key] = true
+		if trackAbsence(key, now) {
+			candidates = append(candidates, key)
+			candidateOrphans[key] = orphan
+		} else {
+			sugar.Infow("Waiting for grace period before deleting orphaned resource",
+				"kind", orphan.Kind,
+				"name", orphan.Name,
+				"namespace", orphan.Namespace,
+				"foundOnPasses", absentDeployments[key].Loops)
+		}
+	}
+	pruneAbsences(orphanAbsencePrefix, orphanKeys)
+	sortByAbsence(candidates)
+	for _, key := range candidates {
+		orphan := candidateOrphans[key]
+		if isOrphanInProtectedNamespace(orphan) && !isDeletionConfirmed(key) {
+			continue
+		}
+		if !takeDeletionSlot(key) {
+			break
+		}
+		if deleteManagedResource(orphan) {
+			clearAbsence(key)
+		}
+	}
+}
+
+// orphanAbsenceKey identifies orphan in absence tracking and names its pending deletion ConfigMap
+func orphanAbsenceKey(res ManagedResource) string {
+	return orphanAbsencePrefix + res.Kind + "." + clusterNamespace(res.Cluster, res.Namespace) + "." + res.Name
+}
+
+// orphanNamespaces returns cluster namespaces of the release and of the owner deployment. Owner namespace of sealed cloud
+// credentials secrets is derived from the owner name with or without the credentials prefix, its cluster is resolved from
+// namespace patterns of target clusters as the bundle of the deployment is not known.
+func orphanNamespaces(res ManagedResource) []string {
+	var clusterNamespaces []string
+	if res.Kind == helmReleaseKind {
+		clusterNamespaces = append(clusterNamespaces, clusterNamespace(res.Cluster, res.Namespace))
+	}
+	owners := []string{res.Owner}
+	for _, prefix := range credsSecretPrefixes {
+		if strings.HasPrefix(res.Owner, prefix) {
+			owners = append(owners, strings.TrimPrefix(res.Owner, prefix))
+		}
+	}
+	for _, owner := range owners {
+		ownerNamespace := getNamespaceFromDeploymentName(owner)
+		ownerCluster := res.Cluster
+		if res.Kind != helmReleaseKind {
+			ownerCluster = resolveTargetCluster(ownerNamespace, "")
+		}
+		clusterNamespaces = append(clusterNamespaces, clusterNamespace(ownerCluster, ownerNamespace))
+	}
+	return clusterNamespaces
+}
+
+func isOrphanInProtectedNamespace(res ManagedResource) bool {
+	for _, clusterNs := range orphanNamespaces(res) {
+		if _, ns := splitClusterNamespace(clusterNs); deletionProtectionConfig.ProtectedNamespaces[ns] {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrphanNamespaceProtected returns true if any of the orphan namespaces is annotated with reliza.io/protect: "true",
+// checked namespaces are cached in protectedNamespaces for the current pass
+func isOrphanNamespaceProtected(res ManagedResource, protectedNamespaces map[string]bool) bool {
+	for _, clusterNs := range orphanNamespaces(res) {
+		isProtected, isChecked := protectedNamespaces[clusterNs]
+		if !isChecked {
+			cluster, ns := splitClusterNamespace(clusterNs)
+			isProtected = isNamespaceProtected(ns, cluster)
+			protectedNamespaces[clusterNs] = isProtected
+		}
+		if isProtected {
+			sugar.Warnw("Namespace of orphaned resource is protected from deletion, skipping",
+				"kind", res.Kind,
+				"name", res.Name,
+				"namespace", clusterNs)
+			return true
+		}
+	}
+	return false
+}
+
+// findOrphans returns resources whose owner deployment is not known. If instance is set, resources not labelled with it,
+// including those without instance label, are owned by another instance and left alone.
+func findOrphans(resources []ManagedResource, knownDeployments map[string]bool, instance string) []ManagedResource {
+	var orphans []ManagedResource
+	for _, res := range resources {
+		if len(res.Owner) < 1 || (len(instance) > 0 && res.Instance != instance) {
+			continue
+		}
+		if !isKnownOwner(res.Owner, knownDeployments) {
+			orphans = append(orphans, res)
+		}
+	}
+	return orphans
+}
+
+// isKnownOwner also matches sealed cloud credentials secrets, which are labelled with their own prefixed name
+func isKnownOwner(owner string, knownDeployments map[string]bool) bool {
+	if _, known := knownDeployments[owner]; known {
+		return true
+	}
+	for _, prefix := range credsSecretPrefixes {
+		if _, known := knownDeployments[strings.TrimPrefix(owner, prefix)]; known && strings.HasPrefix(owner, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func listManagedResources() ([]ManagedResource, error) {
+	kinds := []string{"secret", "configmap"}
+	if IsSecretBackendUsed(SecretBackendSealed) {
+		kinds = append(kinds, "sealedsecret")
+	}
+	if IsSecretBackendUsed(SecretBackendExternalSecrets) {
+		kinds = append(kinds, "externalsecret")
+	}
+	if argoInfo.IsArgoEnabled {
+		kinds = append(kinds, "application")
+	}
+	var resources []ManagedResource
+	for _, kind := range kinds {
+		out, _, err := shellout(KubectlApp + " get " + kind + " -l 'reliza.io/type=cdresource' -n " + SecretsNamespace +
+			" -o jsonpath='{range .items[*]}{.metadata.namespace}{\"\\t\"}{.metadata.name}{\"\\t\"}{.metadata.labels.reliza\\.io/name}{\"\\t\"}{.metadata.labels.reliza\\.io/instance}{\"\\t\"}{.metadata.annotations.reliza\\.io/protect}{\"\\n\"}{end}'")
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, parseManagedResources(kind, out)...)
+	}
+	if !argoInfo.IsArgoEnabled {
+		for _, cluster := range gcClusters() {
+			out, stderr, err := shellout(KubectlApp + " get secret -A" + clusterFlags(cluster) + " -l 'owner=helm,reliza.io/managed-by=" + FieldManager + "'" +
+				" -o jsonpath='{range .items[*]}{.metadata.namespace}{\"\\t\"}{.metadata.labels.name}{\"\\t\"}{.metadata.labels.reliza\\.io/name}{\"\\t\"}{.metadata.labels.reliza\\.io/instance}{\"\\t\"}{.metadata.annotations.reliza\\.io/protect}{\"\\n\"}{end}'")
+			if err != nil && len(cluster) > 0 {
+				// releases of an unreachable target cluster are not collected on this pass
+				sugar.Warnw("Failed to list helm releases of target cluster", "cluster", cluster, "stderr", stderr, "error", err)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, res := range parseManagedResources(helmReleaseKind, out) {
+				res.Cluster = cluster
+				resources = append(resources, res)
+			}
+		}
+	}
+	return resources, nil
+}
+
+// gcClusters returns the cluster reliza-cd runs in, as empty name, and target clusters whose kubeconfigs are synced
+func gcClusters() []string {
+	clusters := []string{""}
+	for _, cluster := range targetClustersConfig.Clusters {
+		if len(syncedKubeconfigs[cluster.Name]) > 0 {
+			clusters = append(clusters, cluster.Name)
+		}
+	}
+	return clusters
+}
+
+// parseManagedResources parses tab-separated namespace, name, reliza.io/name, reliza.io/instance and reliza.io/protect lines,
+// helm releases are reported once even though each revision is stored in its own secret
+func parseManagedResources(kind string, out string) []ManagedResource {
+	var resources []ManagedResource
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) < 3 || seen[fields[0]+"/"+fields[1]] {
+			continue
+		}
+		seen[fields[0]+"/"+fields[1]] = true
+		res := ManagedResource{Kind: kind, Namespace: fields[0], Name: fields[1], Owner: fields[2]}
+		if len(fields) > 3 {
+			res.Instance = fields[3]
+		}
+		if len(fields) > 4 {
+			res.Protected = strings.ToLower(fields[4]) == "true"
+		}
+		resources = append(resources, res)
+	}
+	return resources
+}
+
+func deleteManagedResource(res ManagedResource) bool {
+	var err error
+	if res.Kind == helmReleaseKind {
+		_, _, err = dryRunShellout(HelmApp + " uninstall " + res.Name + " -n " + res.Namespace + clusterFlags(res.Cluster))
+	} else {
+		_, _, err = dryRunShellout(KubectlApp + " delete " + res.Kind + " " + res.Name + " -n " + res.Namespace + " --ignore-not-found")
+	}
+	if err == nil {
+		sugar.Infow("Deleted orphaned reliza-managed resource",
+			"kind", res.Kind,
+			"name", res.Name,
+			"namespace", res.Namespace,
+			"cluster", res.Cluster,
+			"owner", res.Owner)
+	}
+	return err == nil
+}
@@ -0,0 +1,182 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFindOrphans(t *testing.T) {
+	out := "reliza\tprod---app\tprod---app\tinst1\n" +
+		"reliza\tecr-prod---app\tecr-prod---app\tinst1\n" +
+		"reliza\tgar-dev---old\tgar-dev---old\tinst1\n" +
+		"reliza\tdev---old\tdev---old\t\n" +
+		"reliza\tdev---other\tdev---other\tinst2\n"
+	resources := parseManagedResources("secret", out)
+	resources = append(resources, parseManagedResources(helmReleaseKind,
+		"dev\tapp\tdev---old\tinst1\ndev\tapp\tdev---old\tinst1\nprod\tapp\tprod---app\tinst1\ndev\tmanual\t\t\n")...)
+
+	orphans := findOrphans(resources, map[string]bool{"prod---app": true}, "inst1")
+	expected := []ManagedResource{
+		{Kind: "secret", Namespace: "reliza", Name: "gar-dev---old", Owner: "gar-dev---old", Instance: "inst1"},
+		{Kind: helmReleaseKind, Namespace: "dev", Name: "app", Owner: "dev---old", Instance: "inst1"},
+	}
+	if len(orphans) != len(expected) {
+		t.Fatalf("expected %d orphans, got %+v", len(expected), orphans)
+	}
+	for i := range expected {
+		if orphans[i] != expected[i] {
+			t.Errorf("orphan %d: expected %+v, got %+v", i, expected[i], orphans[i])
+		}
+	}
+}
+
+func fakeOrphans(t *testing.T) string {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	os.MkdirAll("workspace", 0700)
+	prevPolicy, prevConfig := orphanGcPolicy, deletionProtectionConfig
+	t.Cleanup(func() {
+		orphanGcPolicy, deletionProtectionConfig = prevPolicy, prevConfig
+		absentDeployments = map[string]*deploymentAbsence{}
+		absencesLoaded = false
+	})
+	orphanGcPolicy = OrphanGcPolicyDelete
+	return fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in\n" +
+			"*'get secret -l'*) printf 'reliza\\tdev---old\\tdev---old\\t\\t\\nreliza\\tprotected---app\\tprotected---app\\t\\t\\n';;\n" +
+			"*'get secret -A'*) printf 'dev\\tapp\\tdev---old\\t\\t\\n';;\n" +
+			"*'get namespace protected'*) printf 'true';;\n" +
+			"*orphan.helmrelease*confirm-deletion*) cat \"$(dirname $0)/../confirmed-id\" 2>/dev/null;;\n" +
+			"esac",
+	})
+}
+
+func TestGarbageCollectionSafeguards(t *testing.T) {
+	toolsPath := fakeOrphans(t)
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 2, MaxDeletionsPerLoop: 1}
+
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if len(fakeToolCalls(t, toolsPath, "uninstall")) != 0 || len(fakeToolCalls(t, toolsPath, "kubectl delete secret")) != 0 {
+		t.Fatal("expected orphans not to be deleted before grace loops elapsed")
+	}
+
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if len(fakeToolCalls(t, toolsPath, "helm uninstall app -n dev")) != 1 {
+		t.Fatal("expected orphaned release to be deleted after grace loops")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete secret dev---old")) != 0 {
+		t.Fatal("expected second orphan to be deferred by MAX_DELETIONS_PER_LOOP")
+	}
+
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete secret dev---old")) != 1 {
+		t.Fatal("expected deferred orphan to be deleted on the next loop")
+	}
+}
+
+func TestGarbageCollectionInProtectedNamespace(t *testing.T) {
+	toolsPath := fakeOrphans(t)
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 1, ProtectedNamespaces: map[string]bool{"dev": true}}
+
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if len(fakeToolCalls(t, toolsPath, "uninstall")) != 0 || len(fakeToolCalls(t, toolsPath, "kubectl delete secret")) != 0 {
+		t.Fatal("expected orphans in protected namespace not to be deleted without confirmation")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl apply", PendingDeletionPrefix+"orphan.helmrelease.dev.app")) != 1 {
+		t.Fatal("expected pending deletion of orphaned release to be recorded")
+	}
+
+	deletionId := []byte(strconv.FormatInt(absentDeployments["orphan.helmrelease.dev.app"].Since.Unix(), 10))
+	os.WriteFile(filepath.Join(toolsPath, "confirmed-id"), deletionId, 0600)
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if len(fakeToolCalls(t, toolsPath, "helm uninstall app -n dev")) != 1 {
+		t.Fatal("expected confirmed orphan to be deleted")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete secret")) != 0 {
+		t.Fatal("expected unconfirmed orphan to be kept")
+	}
+}
+
+func TestGarbageCollectionHonoursNamespaceProtection(t *testing.T) {
+	toolsPath := fakeOrphans(t)
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 1}
+
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete secret dev---old")) != 1 {
+		t.Fatal("expected orphan in unprotected namespace to be deleted")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete secret protected---app")) != 0 {
+		t.Fatal("expected orphan of deployment in namespace annotated with reliza.io/protect to be kept")
+	}
+}
+
+func TestGarbageCollectionInTargetCluster(t *testing.T) {
+	fakeOrphans(t)
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *'get secret -A --kubeconfig clusters/eu-prod.kubeconfig'*) printf 'dev\\tapp\\tdev---gone\\t\\t\\n';; esac",
+	})
+	t.Cleanup(func() {
+		targetClustersConfig = TargetClustersConfig{}
+		syncedKubeconfigs = map[string]string{}
+	})
+	targetClustersConfig = TargetClustersConfig{Clusters: []TargetCluster{{Name: "eu-prod"}, {Name: "unsynced"}}}
+	syncedKubeconfigs["eu-prod"] = testKubeconfig
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 1}
+
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if len(fakeToolCalls(t, toolsPath, "get namespace dev --kubeconfig clusters/eu-prod.kubeconfig")) != 1 {
+		t.Error("expected protection of release namespace to be checked in its cluster")
+	}
+	if len(fakeToolCalls(t, toolsPath, "helm uninstall app -n dev --kubeconfig clusters/eu-prod.kubeconfig")) != 1 {
+		t.Fatal("expected orphaned release to be uninstalled from its cluster")
+	}
+	if len(fakeToolCalls(t, toolsPath, "unsynced")) != 0 {
+		t.Error("expected target cluster without synced kubeconfig to be skipped")
+	}
+}
+
+func TestGarbageCollectionWithTwoInstancesInCluster(t *testing.T) {
+	fakeOrphans(t)
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *'get secret -A'*) printf 'dev\\tapp\\tdev---old\\tinst2\\t\\ndev\\tweb\\tdev---gone\\tinst1\\t\\ndev\\tlegacy\\tdev---legacy\\t\\t\\n';; esac",
+	})
+	prevInstanceId := instanceId
+	t.Cleanup(func() { instanceId = prevInstanceId })
+	instanceId = "inst1"
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 1}
+
+	rd := RelizaDeployment{Name: "dev---web", Namespace: "dev"}
+	if labels := helmReleaseLabels(&rd); labels != "reliza.io/managed-by=reliza-cd,reliza.io/name=dev---web,reliza.io/instance=inst1" {
+		t.Fatalf("expected helm releases to be labelled with the instance, got %s", labels)
+	}
+	ResetDeletionBudget()
+	GarbageCollectOrphans(map[string]bool{})
+	if calls := fakeToolCalls(t, toolsPath, "helm uninstall"); len(calls) != 1 || !strings.Contains(calls[0], "uninstall web -n dev") {
+		t.Fatalf("expected only orphaned release of this instance to be uninstalled, got %v", calls)
+	}
+}
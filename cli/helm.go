@@ -57,27 +57,49 @@ func ResolveHelmAuthSecret(secretName string) ProjectAuth {
 	return pa
 }
 
-func KubectlApply(path string) {
-	dryRunShellout(KubectlApp + " apply -f " + path)
-}
-
 func cleanupHelmChart(helmChartPath string) {
 	shellout("rm -rf " + helmChartPath + "/")
 	shellout("rm -rf " + helmChartPath + "*.tgz")
 }
 
 func GetHelmRepoInfoFromDeployment(rd *RelizaDeployment) HelmRepoInfo {
+	// Apply mirror rewrites first, so that OCI detection is done on the mirror uri
+	artUri := rewriteArtUri(rd.ArtUri)
+	chartName := GetChartNameFromDeployment(rd)
+
+	registryType := ""
+	registryEntry, uriRemainder := matchRegistryConfig(artUri)
+	if registryEntry != nil {
+		registryType = registryEntry.Type
+	}
+
+	helmRepoInfo := resolveHelmRepoInfo(artUri, chartName, registryType)
+	if registryEntry != nil {
+		helmRepoInfo.CredentialsSecret = registryEntry.CredentialsSecret
+		helmRepoInfo.SecretBackend = registryEntry.SecretBackend
+		helmRepoInfo.Mirrors = resolveMirrorRepoInfos(uriRemainder, chartName, registryEntry)
+	}
+	return helmRepoInfo
+}
+
+// resolveHelmRepoInfo resolves repository coordinates of the chart. If registryType is not set to oci or http explicitly,
+// OCI is detected by oci:// prefix or by known OCI registry domains.
+func resolveHelmRepoInfo(artUri string, chartName string, registryType string) HelmRepoInfo {
 	var helmRepoInfo HelmRepoInfo
 
-	helmRepoInfo.ChartName = GetChartNameFromDeployment(rd)
-	helmRepoInfo.RepoUri = strings.Replace(rd.ArtUri, "/"+helmRepoInfo.ChartName, "", -1)
+	helmRepoInfo.ChartName = chartName
+	helmRepoInfo.RepoUri = strings.Replace(artUri, "/"+helmRepoInfo.ChartName, "", -1)
 
-	// Determine if this is an OCI registry based on domain patterns or oci:// prefix
+	// Determine if this is an OCI registry based on registry configuration, domain patterns or oci:// prefix
 	helmRepoInfo.UseOci = false
-	if strings.Contains(rd.ArtUri, "oci://") {
+	if strings.Contains(artUri, "oci://") {
+		helmRepoInfo.UseOci = true
+		helmRepoInfo.OciUri = artUri
+	} else if registryType == RegistryTypeOci {
 		helmRepoInfo.UseOci = true
-		helmRepoInfo.OciUri = rd.ArtUri
-	} else if strings.Contains(rd.ArtUri, "azurecr.io") || strings.Contains(rd.ArtUri, ".ecr.") || strings.Contains(rd.ArtUri, ".pkg.dev") || (strings.Contains(rd.ArtUri, ".relizahub.com") && !strings.Contains(rd.ArtUri, "/chartrepo/")) {
+	} else if registryType == RegistryTypeHttp {
+		helmRepoInfo.UseOci = false
+	} else if strings.Contains(artUri, "azurecr.io") || strings.Contains(artUri, ".ecr.") || strings.Contains(artUri, ".pkg.dev") || (strings.Contains(artUri, ".relizahub.com") && !strings.Contains(artUri, "/chartrepo/")) {
 		helmRepoInfo.UseOci = true
 	}
 
@@ -106,24 +128,86 @@ func GetHelmRepoInfoFromDeployment(rd *RelizaDeployment) HelmRepoInfo {
 }
 
 type HelmRepoInfo struct {
-	ChartName string
-	RepoUri   string
-	RepoHost  string
-	UseOci    bool
-	OciUri    string
+	ChartName         string
+	RepoUri           string
+	RepoHost          string
+	UseOci            bool
+	OciUri            string
+	CredentialsSecret string
+	// SecretBackend overrides SECRET_BACKEND for the registry when set in registry configuration
+	SecretBackend string
+	Mirrors       []HelmRepoInfo
 }
 
 func DownloadHelmChart(path string, rd *RelizaDeployment, pa *ProjectAuth, helmRepoInfo HelmRepoInfo) error {
 	var err error
 	cleanupHelmChart(path + helmRepoInfo.ChartName)
 
+	pullDigest, isCached := restoreChartFromCache(path, helmRepoInfo, rd.ArtVersion)
+	if isCached {
+		sugar.Info("Using cached copy of chart ", helmRepoInfo.ChartName, " version ", rd.ArtVersion)
+		err = VerifyHelmChart(path, rd, pa, helmRepoInfo, pullDigest, ChartSourceCache)
+		if err != nil {
+			sugar.Warnw("Cached chart failed verification, removing it from cache and downloading again",
+				"bundle", rd.Bundle,
+				"version", rd.ArtVersion,
+				"chartName", helmRepoInfo.ChartName,
+				"error", err)
+			removeChartFromCache(helmRepoInfo, rd.ArtVersion)
+			cleanupHelmChart(path + helmRepoInfo.ChartName)
+			isCached = false
+			err = nil
+		}
+	}
+	isOffline := false
+	if !isCached {
+		pullDigest, isOffline = restoreChartFromOfflineDir(path, helmRepoInfo, rd.ArtVersion)
+	}
+	if isOffline {
+		err = VerifyHelmChart(path, rd, pa, helmRepoInfo, pullDigest, ChartSourceOffline)
+	} else if !isCached {
+		pullDigest, err = pullHelmChart(path, rd, pa, helmRepoInfo)
+		for i := 0; err != nil && i < len(helmRepoInfo.Mirrors); i++ {
+			mirrorInfo := helmRepoInfo.Mirrors[i]
+			sugar.Warnw("Failed to download helm chart, falling back to mirror",
+				"bundle", rd.Bundle,
+				"version", rd.ArtVersion,
+				"chartName", helmRepoInfo.ChartName,
+				"mirrorUri", mirrorInfo.RepoUri)
+			cleanupHelmChart(path + helmRepoInfo.ChartName)
+			mirrorPa := resolveMirrorAuth(mirrorInfo)
+			pullDigest, err = pullHelmChart(path, rd, &mirrorPa, mirrorInfo)
+		}
+		if err == nil {
+			storeChartInCache(path, helmRepoInfo, rd.ArtVersion, pullDigest)
+		}
+	}
+	if err == nil {
+		_, _, err = shellout("tar -xzvf " + path + "*.tgz -C " + path)
+	}
+	if err != nil {
+		sugar.Errorw("Failed to download helm chart",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"chartName", helmRepoInfo.ChartName,
+			"namespace", rd.Namespace,
+			"repoUri", helmRepoInfo.RepoUri,
+			"error", err)
+	}
+	return err
+}
+
+// pullHelmChart pulls chart archive from the repository into path and verifies it, returns OCI manifest digest reported by helm pull if any
+func pullHelmChart(path string, rd *RelizaDeployment, pa *ProjectAuth, helmRepoInfo HelmRepoInfo) (string, error) {
+	var err error
+	var pullOut, pullErrOut string
 	if helmRepoInfo.UseOci {
 
 		if pa.Type != "NOCREDS" {
 			_, _, err = shellout(HelmApp + " registry login " + helmRepoInfo.RepoHost + " --username " + pa.Login + " --password " + pa.Password)
 		}
 		if err == nil {
-			_, _, err = shellout(HelmApp + " pull " + helmRepoInfo.OciUri + " --version " + rd.ArtVersion + " -d " + path)
+			pullOut, pullErrOut, err = shellout(HelmApp + " pull " + helmRepoInfo.OciUri + " --version " + rd.ArtVersion + " -d " + path)
 		}
 	} else {
 		if pa.Type != "NOCREDS" {
@@ -133,47 +217,51 @@ func DownloadHelmChart(path string, rd *RelizaDeployment, pa *ProjectAuth, helmR
 		}
 		if err == nil {
 			shellout(HelmApp + " repo update " + helmRepoInfo.ChartName)
-			shellout(HelmApp + " pull " + helmRepoInfo.ChartName + "/" + helmRepoInfo.ChartName + " --version " + rd.ArtVersion + " -d " + path)
+			pullOut, pullErrOut, err = shellout(HelmApp + " pull " + helmRepoInfo.ChartName + "/" + helmRepoInfo.ChartName + " --version " + rd.ArtVersion + " -d " + path + helmProvenanceFlags())
 		}
 	}
+	pullDigest := extractPullDigest(pullOut + "\n" + pullErrOut)
 	if err == nil {
-		_, _, err = shellout("tar -xzvf " + path + "*.tgz -C " + path)
+		err = VerifyHelmChart(path, rd, pa, helmRepoInfo, pullDigest, ChartSourceRegistry)
 	}
+	return pullDigest, err
+}
+
+// GetInstancePropertyForBundle resolves a single instance property scoped to the namespace and bundle of rd.
+// Returns an empty string if the property is not set on Reliza Hub.
+func GetInstancePropertyForBundle(rd *RelizaDeployment, property string) (string, error) {
+	propCmd := RelizaCliApp + " instprops --property " + property + " --usenamespacebundle=true --namespace " + rd.Namespace + " --bundle '" + rd.Bundle + "'"
+	sugar.Debug("Fetching ", property, " for bundle: ", rd.Bundle, " namespace: ", rd.Namespace)
+	sugar.Debug("Command: ", propCmd)
+	propsFromCli, stderr, err := shellout(propCmd)
 	if err != nil {
-		sugar.Errorw("Failed to download helm chart",
-			"bundle", rd.Bundle,
-			"version", rd.ArtVersion,
-			"chartName", helmRepoInfo.ChartName,
-			"namespace", rd.Namespace,
-			"repoUri", helmRepoInfo.RepoUri,
-			"error", err)
+		sugar.Error("Failed to fetch ", property, ": ", err)
+		sugar.Error("stderr: ", stderr)
+		return "", err
 	}
-	return err
+	sugar.Debug(property, " response = ", propsFromCli)
+	var secretPropsResp SecretPropsCliResponse
+	err = json.Unmarshal([]byte(propsFromCli), &secretPropsResp)
+	if err != nil {
+		sugar.Error("Failed to unmarshal ", property, " response: ", err)
+		return "", err
+	}
+
+	propValue := ""
+	if len(secretPropsResp.Properties) > 0 {
+		propValue = secretPropsResp.Properties[0].Value
+	}
+	return propValue, nil
 }
 
 func resolveCustomValuesFromHub(groupPath string, rd *RelizaDeployment) bool {
 	present := false
-	custValCmd := RelizaCliApp + " instprops --property CUSTOM_VALUES --usenamespacebundle=true --namespace " + rd.Namespace + " --bundle '" + rd.Bundle + "'"
-	sugar.Debug("Fetching CUSTOM_VALUES for bundle: ", rd.Bundle, " namespace: ", rd.Namespace)
-	sugar.Debug("Command: ", custValCmd)
-	propsFromCli, stderr, err := shellout(custValCmd)
+	custValues, err := GetInstancePropertyForBundle(rd, "CUSTOM_VALUES")
 	if err != nil {
-		sugar.Error("Failed to fetch CUSTOM_VALUES: ", err)
-		sugar.Error("stderr: ", stderr)
-		return false
-	}
-	sugar.Debug("custValues response = ", propsFromCli)
-	var secretPropsResp SecretPropsCliResponse
-	unmarshalErr := json.Unmarshal([]byte(propsFromCli), &secretPropsResp)
-	if unmarshalErr != nil {
-		sugar.Error("Failed to unmarshal CUSTOM_VALUES response: ", unmarshalErr)
 		return false
 	}
 
-	custValues := ""
-	if len(secretPropsResp.Properties) > 0 {
-		prop := secretPropsResp.Properties[0]
-		custValues = prop.Value
+	if len(custValues) > 0 {
 		sugar.Debug("CUSTOM_VALUES found, length: ", len(custValues), " bytes")
 	} else {
 		sugar.Debug("No CUSTOM_VALUES found for bundle: ", rd.Bundle, " namespace: ", rd.Namespace)
@@ -278,7 +366,7 @@ func IsValuesDiff(groupPath string) bool {
 func IsFirstHelmInstallDone(rd *RelizaDeployment) bool {
 	isFirstInstallDone := false
 	helmChartName := GetChartNameFromDeployment(rd)
-	helmListOut, _, _ := shellout(HelmApp + " list -f \"^" + helmChartName + "$\" -n " + rd.Namespace + " | wc -l")
+	helmListOut, _, _ := shellout(HelmApp + " list -f \"^" + helmChartName + "$\" -n " + rd.Namespace + ClusterFlags(rd) + " | wc -l")
 	helmListOut = strings.Replace(helmListOut, "\n", "", -1)
 	helmListOutInt, err := strconv.Atoi(helmListOut)
 	if err != nil {
@@ -301,7 +389,7 @@ func SetHelmChartAppVersion(groupPath string, rd *RelizaDeployment) error {
 func InstallHelmChart(groupPath string, rd *RelizaDeployment) error {
 	helmChartName := GetChartNameFromDeployment(rd)
 	sugar.Info("Installing chart ", helmChartName, " for namespace ", rd.Namespace)
-	helmCmd := HelmApp + " upgrade --install " + helmChartName + " --create-namespace -n " + rd.Namespace + " -f " + groupPath + InstallValues + " " + groupPath + helmChartName
+	helmCmd := HelmApp + " upgrade --install " + helmChartName + " --create-namespace -n " + rd.Namespace + ClusterFlags(rd) + " --labels " + helmReleaseLabels(rd) + " -f " + groupPath + InstallValues + " " + groupPath + helmChartName
 	sugar.Info("Helm install command: ", helmCmd)
 	sugar.Info("Using values file: ", groupPath+InstallValues)
 	stdout, stderr, err := dryRunShellout(helmCmd)
@@ -326,6 +414,8 @@ func RecordDeployedData(groupPath string, rd *RelizaDeployment) {
 	}
 	rdFile.Write(rdJson)
 	rdFile.Close()
+	recordDeployedValuesForDiff(groupPath)
+	RecordReleaseState(groupPath, rd)
 }
 
 func RecordHelmChartVersion(groupPath string, rd *RelizaDeployment) {
@@ -424,14 +514,15 @@ func GetChartNameFromDeployment(rd *RelizaDeployment) string {
 	return helmChartSplit[len(helmChartSplit)-1]
 }
 
-func CreateNamespaceIfMissing(namespace string) {
-	nsListOut, _, _ := shellout(KubectlApp + " get ns " + namespace + " | wc -l")
+// CreateNamespaceIfMissing creates namespace in the cluster selected by clusterFlags, see ClusterFlags
+func CreateNamespaceIfMissing(namespace string, clusterFlags string) {
+	nsListOut, _, _ := shellout(KubectlApp + " get ns " + namespace + clusterFlags + " | wc -l")
 	nsListOut = strings.Replace(nsListOut, "\n", "", -1)
 	nsListOutInt, err := strconv.Atoi(nsListOut)
 	if err != nil {
 		sugar.Error(err)
 	} else if nsListOutInt < 2 {
-		dryRunShellout(KubectlApp + " create ns " + namespace)
+		dryRunShellout(KubectlApp + " create ns " + namespace + clusterFlags)
 	}
 }
 
@@ -454,17 +545,33 @@ func DeleteObsoleteDeployment(groupPath string) {
 		var rd RelizaDeployment
 		json.Unmarshal(recordedData, &rd)
 		helmChartName := GetChartNameFromDeployment(&rd)
-		if !argoInfo.IsArgoEnabled {
+		if !IsHelmDeployment(&rd) {
+			DeleteManifests(groupPath, &rd)
+		} else if !argoInfo.IsArgoEnabled {
 			sugar.Info("Uninstalling chart ", helmChartName, " from namespace ", rd.Namespace)
-			dryRunShellout(HelmApp + " uninstall " + helmChartName + " -n " + rd.Namespace)
+			dryRunShellout(HelmApp + " uninstall " + helmChartName + " -n " + rd.Namespace + ClusterFlags(&rd))
+			dryRunShellout(HelmApp + " uninstall " + helmChartName + CanaryReleaseSuffix + " -n " + rd.Namespace + ClusterFlags(&rd) + " --ignore-not-found")
+		} else if IsApplicationSetMode() {
+			// Argo CD prunes the Application once its element is gone, otherwise deletion is retried on the next loop
+			if !removeApplicationSetElement(groupPath) {
+				return
+			}
+			forgetArgoApplication(&rd)
 		} else {
 			sugar.Info("Uninstalling argo application for release", rd.Name, " from namespace ", rd.Namespace)
 			dryRunShellout(KubectlApp + " delete application -l 'reliza.io/type=cdresource' -l 'reliza.io/name=" + rd.Name + "' -n " + SecretsNamespace)
+			forgetArgoApplication(&rd)
 		}
 
 		dryRunShellout(KubectlApp + " delete sealedsecret -l 'reliza.io/type=cdresource' -l 'reliza.io/name=" + rd.Name + "' -n " + SecretsNamespace)
-		dryRunShellout(KubectlApp + " delete sealedsecret -l 'reliza.io/type=cdresource' -l 'reliza.io/name=ecr-" + rd.Name + "' -n " + SecretsNamespace)
+		for _, credsPrefix := range credsSecretPrefixes {
+			dryRunShellout(KubectlApp + " delete sealedsecret -l 'reliza.io/type=cdresource' -l 'reliza.io/name=" + credsPrefix + rd.Name + "' -n " + SecretsNamespace)
+		}
+		if IsSecretBackendUsed(SecretBackendExternalSecrets) {
+			dryRunShellout(KubectlApp + " delete externalsecret -l 'reliza.io/type=cdresource' -l 'reliza.io/name=" + rd.Name + "' -n " + SecretsNamespace)
+		}
 		dryRunShellout(KubectlApp + " delete secret -l 'reliza.io/type=cdresource' -l 'reliza.io/name=" + rd.Name + "' -n " + SecretsNamespace)
+		dryRunShellout(KubectlApp + " delete configmap -l 'reliza.io/type=cdresource' -l 'reliza.io/name=" + rd.Name + "' -n " + SecretsNamespace)
 		os.RemoveAll(groupPath)
 	}
 }
@@ -0,0 +1,77 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+const (
+	PendingChangeReport = "PENDING_CHANGE"
+	DriftReportType     = "DRIFT"
+	ArgoStatusReport    = "ARGO_STATUS"
+)
+
+// reportToHub sends a report of reportType for the bundle of rd to Reliza Hub through reliza-cli.
+// The report is written to the workspace of the deployment. Reliza-cli shipped with Reliza CD can not upload reports,
+// so the Hub receives the report as instance data of a sender dedicated to the report type and deployment,
+// holding the digest which identifies the reported state, see hubReportDigest.
+// Reports are informational, so failure to deliver one is logged and returned but does not block deployment.
+func reportToHub(reportType string, groupPath string, rd *RelizaDeployment, report interface{}) error {
+	reportJson, err := json.Marshal(report)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	reportPath := groupPath + "hub-report-" + strings.ToLower(reportType) + ".json"
+	err = os.WriteFile(reportPath, reportJson, 0600)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	reportCmd := RelizaCliApp + " instdata --images \"" + hubReportDigest(report, reportJson) + "\" --namespace " + rd.Namespace + " --sender " + hubReportSender(reportType, rd)
+	_, stderr, err := shellout(reportCmd)
+	if err != nil {
+		sugar.Warnw("Failed to send report to Reliza Hub",
+			"reportType", reportType,
+			"bundle", rd.Bundle,
+			"namespace", rd.Namespace,
+			"error", err,
+			"stderr", stderr)
+	}
+	return err
+}
+
+// hubReportDigest returns the change digest for pending changes, so that it can be approved from the Hub,
+// and no digest once the change was installed or superseded. Other reports are identified by sha256 of their json.
+func hubReportDigest(report interface{}, reportJson []byte) string {
+	if pendingChange, ok := report.(PendingChange); ok {
+		if pendingChange.Status != PendingChangeStatusPending {
+			return " " // required otherwise cli looks for images in file
+		}
+		return pendingChange.Digest
+	}
+	digest := sha256.Sum256(reportJson)
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
+
+func hubReportSender(reportType string, rd *RelizaDeployment) string {
+	return "reliza-cd-" + strings.ReplaceAll(strings.ToLower(reportType), "_", "-") + "-" + rd.Name
+}
@@ -0,0 +1,59 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+func TestReportToHubCommandLine(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+
+	pendingChange := PendingChange{Digest: "sha256:abc", Name: rd.Name, Status: PendingChangeStatusPending}
+	if err := reportToHub(PendingChangeReport, groupPath, &rd, pendingChange); err != nil {
+		t.Fatal(err)
+	}
+	pendingChange.Status = PendingChangeStatusInstalled
+	reportToHub(PendingChangeReport, groupPath, &rd, pendingChange)
+	driftResult := DriftResult{Name: rd.Name, Reasons: []string{"values differ"}}
+	reportToHub(DriftReportType, groupPath, &rd, driftResult)
+
+	driftJson, err := os.ReadFile(groupPath + "hub-report-drift.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driftDigest := sha256.Sum256(driftJson)
+	expectedCalls := []string{
+		"reliza-cli instdata --images sha256:abc --namespace prod --sender reliza-cd-pending-change-prod---my-app",
+		"reliza-cli instdata --images   --namespace prod --sender reliza-cd-pending-change-prod---my-app",
+		"reliza-cli instdata --images sha256:" + hex.EncodeToString(driftDigest[:]) + " --namespace prod --sender reliza-cd-drift-prod---my-app",
+	}
+	calls := fakeToolCalls(t, toolsPath, "reliza-cli")
+	if len(calls) != len(expectedCalls) {
+		t.Fatalf("expected %d reports, got %v", len(expectedCalls), calls)
+	}
+	for i, call := range calls {
+		if call != expectedCalls[i] {
+			t.Errorf("expected %q, got %q", expectedCalls[i], call)
+		}
+	}
+}
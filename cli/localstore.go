@@ -0,0 +1,191 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+const (
+	localStorePath        = "workspace/credentials-store.enc"
+	localStorePasswordEnv = "LOCAL_STORE_PASSWORD"
+	// local store is kept in openssl enc format, i.e. it can be decrypted with
+	// openssl enc -d -aes-256-cbc -a -pbkdf2 -iter 600000 -pass env:LOCAL_STORE_PASSWORD
+	localStoreKdfIterations = 600000
+	localStoreSaltHeader    = "Salted__"
+)
+
+// localCredentials holds repository credentials received from the Hub in the local secret backend, keyed by artifact digest and namespace
+var localCredentials = make(map[string]ProjectAuth)
+
+// IsLocalSecretsBackend returns true when repository credentials are kept by reliza-cd itself and used directly for helm registry logins,
+// without producing Kubernetes secrets
+func IsLocalSecretsBackend() bool {
+	return secretBackend == SecretBackendLocal
+}
+
+func initLocalStore() {
+	if len(os.Getenv(localStorePasswordEnv)) < 1 {
+		sugar.Warn(localStorePasswordEnv + " is not set, credentials of the local secret backend are kept in memory only")
+		return
+	}
+	encryptedStore, err := os.ReadFile(localStorePath)
+	if err != nil {
+		return
+	}
+	storeBytes, err := decryptLocalStore(encryptedStore, os.Getenv(localStorePasswordEnv))
+	if err == nil {
+		err = json.Unmarshal(storeBytes, &localCredentials)
+	}
+	if err != nil {
+		sugar.Error("Failed to read local credentials store: ", err)
+		return
+	}
+	sugar.Info("Loaded ", len(localCredentials), " credentials from local credentials store")
+}
+
+func persistLocalStore() {
+	if len(os.Getenv(localStorePasswordEnv)) < 1 {
+		return
+	}
+	storeBytes, err := json.Marshal(localCredentials)
+	var encryptedStore []byte
+	if err == nil {
+		encryptedStore, err = encryptLocalStore(storeBytes, os.Getenv(localStorePasswordEnv))
+	}
+	if err == nil {
+		err = os.WriteFile(localStorePath, encryptedStore, 0600)
+	}
+	if err != nil {
+		sugar.Error("Failed to write local credentials store: ", err)
+	}
+}
+
+// deriveLocalStoreKey derives AES-256 key and IV from the store password the same way as openssl enc -pbkdf2
+func deriveLocalStoreKey(password string, salt []byte) ([]byte, []byte, error) {
+	keyIv, err := pbkdf2.Key(sha256.New, password, salt, localStoreKdfIterations, 48)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyIv[:32], keyIv[32:], nil
+}
+
+// encryptLocalStore encrypts plaintext in memory with AES-256-CBC, producing base64 encoded openssl enc output
+func encryptLocalStore(plaintext []byte, password string) ([]byte, error) {
+	salt := make([]byte, 8)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	key, iv, err := deriveLocalStoreKey(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	encoded := base64.StdEncoding.EncodeToString(append(append([]byte(localStoreSaltHeader), salt...), ciphertext...))
+	var wrapped strings.Builder
+	for len(encoded) > 64 {
+		wrapped.WriteString(encoded[:64] + "\n")
+		encoded = encoded[64:]
+	}
+	wrapped.WriteString(encoded + "\n")
+	return []byte(wrapped.String()), nil
+}
+
+// decryptLocalStore decrypts base64 encoded openssl enc output in memory
+func decryptLocalStore(encrypted []byte, password string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(encrypted)), ""))
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(localStoreSaltHeader) + 8
+	if len(decoded) < headerLen+aes.BlockSize || string(decoded[:len(localStoreSaltHeader)]) != localStoreSaltHeader ||
+		(len(decoded)-headerLen)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed local credentials store")
+	}
+	key, iv, err := deriveLocalStoreKey(password, decoded[len(localStoreSaltHeader):headerLen])
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(decoded)-headerLen)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, decoded[headerLen:])
+	padding := int(plaintext[len(plaintext)-1])
+	if padding < 1 || padding > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("failed to decrypt local credentials store, wrong " + localStorePasswordEnv + "?")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// isSealedCiphertext returns true if value looks like raw output of kubeseal - base64 encoded 2-byte length of RSA encrypted
+// session key, followed by the session key and AES-GCM encrypted data. Such values are received from the Hub when
+// a Sealed Secrets certificate of the instance is still set on the Hub and must not be used as credentials.
+func isSealedCiphertext(value string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(decoded) < 2 {
+		return false
+	}
+	sessionKeyLen := int(binary.BigEndian.Uint16(decoded[:2]))
+	return (sessionKeyLen == 256 || sessionKeyLen == 384 || sessionKeyLen == 512) && len(decoded) > 2+sessionKeyLen
+}
+
+// GetLocalProjectAuth returns credentials for the artifact from the Hub, recording them in the local store.
+// If the Hub does not return credentials, i.e. while it is unreachable, previously stored credentials are used.
+// Fails if the Hub returns sealed credentials, since the local backend cannot unseal them.
+func GetLocalProjectAuth(artDigest, releaseNamespace string) (ProjectAuth, error) {
+	storeKey := artDigest + "|" + releaseNamespace
+	projectAuth := GetProjectAuthByArtifactDigest(artDigest, releaseNamespace)
+	if isSealedCiphertext(projectAuth.Login) || isSealedCiphertext(projectAuth.Password) {
+		sugar.Errorw("Reliza Hub returned credentials sealed with a Sealed Secrets certificate, which the local secret backend cannot use. "+
+			"Remove the sealed certificate of this instance on Reliza Hub or use the sealed secret backend",
+			"artifactDigest", artDigest,
+			"namespace", releaseNamespace)
+		return ProjectAuth{}, errors.New("sealed credentials received from Reliza Hub with " + SecretBackendLocal + " secret backend")
+	}
+	storedAuth, isStored := localCredentials[storeKey]
+	if len(projectAuth.Type) < 1 {
+		if isStored {
+			sugar.Warn("No credentials received from the Hub for artifact ", artDigest, ", using stored credentials")
+		}
+		return storedAuth, nil
+	}
+	if !isStored || storedAuth != projectAuth {
+		localCredentials[storeKey] = projectAuth
+		persistLocalStore()
+	}
+	return projectAuth, nil
+}
@@ -0,0 +1,104 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreRoundtrip(t *testing.T) {
+	plaintext := []byte(`{"sha256:abc|prod":{"login":"user","password":"secret","type":"HELM","url":"registry.example.com"}}`)
+	encrypted, err := encryptLocalStore(plaintext, "store-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, []byte("secret")) {
+		t.Fatal("encrypted store contains plaintext password")
+	}
+	decrypted, err := decryptLocalStore(encrypted, "store-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("decrypted store %q, want %q", decrypted, plaintext)
+	}
+	if _, err := decryptLocalStore(encrypted, "wrong-password"); err == nil {
+		t.Fatal("expected error decrypting with wrong password")
+	}
+}
+
+func TestLocalStoreIsOpensslCompatible(t *testing.T) {
+	opensslPath, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl is not available")
+	}
+	t.Setenv(localStorePasswordEnv, "store-password")
+	plaintext := []byte(`{"key":"value"}`)
+	encryptedPath := filepath.Join(t.TempDir(), "store.enc")
+
+	encrypted, err := encryptLocalStore(plaintext, "store-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(encryptedPath, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := exec.Command(opensslPath, "enc", "-d", "-aes-256-cbc", "-a", "-pbkdf2", "-iter", "600000",
+		"-pass", "env:"+localStorePasswordEnv, "-in", encryptedPath).Output()
+	if err != nil {
+		t.Fatalf("openssl failed to decrypt store: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("openssl decrypted %q, want %q", decrypted, plaintext)
+	}
+
+	cmd := exec.Command(opensslPath, "enc", "-aes-256-cbc", "-a", "-pbkdf2", "-iter", "600000", "-salt",
+		"-pass", "env:"+localStorePasswordEnv)
+	cmd.Stdin = bytes.NewReader(plaintext)
+	encrypted, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("openssl failed to encrypt store: %v", err)
+	}
+	decrypted, err = decryptLocalStore(encrypted, "store-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("decrypted %q, want %q", decrypted, plaintext)
+	}
+}
+
+func TestIsSealedCiphertext(t *testing.T) {
+	sealed := make([]byte, 2+256+32)
+	binary.BigEndian.PutUint16(sealed, 256)
+	if !isSealedCiphertext(base64.StdEncoding.EncodeToString(sealed)) {
+		t.Fatal("expected kubeseal output to be detected as sealed")
+	}
+	for _, value := range []string{"", "user", "s3cr3t-Passw0rd", base64.StdEncoding.EncodeToString([]byte("plain password")),
+		strings.Repeat("A", 40)} {
+		if isSealedCiphertext(value) {
+			t.Fatalf("expected %q not to be detected as sealed", value)
+		}
+	}
+}
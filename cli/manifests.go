@@ -0,0 +1,329 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ManifestsMimeType       = "application/vnd.reliza.manifests.v1.tar+gzip"
+	KustomizeMimeType       = "application/vnd.reliza.kustomize.v1.tar+gzip"
+	DeploymentTypeHelm      = "HELM"
+	DeploymentTypeManifests = "MANIFESTS"
+	DeploymentTypeKustomize = "KUSTOMIZE"
+	ManifestsOverlayDir     = "overlay"
+	ManifestsRendered       = "rendered-manifests.yaml"
+	ManifestsApplied        = "applied-manifests.yaml"
+)
+
+type kustomizationLabels struct {
+	Pairs            map[string]string `yaml:"pairs"`
+	IncludeSelectors bool              `yaml:"includeSelectors"`
+}
+
+type kustomization struct {
+	ApiVersion string                `yaml:"apiVersion"`
+	Kind       string                `yaml:"kind"`
+	Namespace  string                `yaml:"namespace"`
+	Resources  []string              `yaml:"resources"`
+	Labels     []kustomizationLabels `yaml:"labels"`
+}
+
+// IsHelmDeployment returns true for helm chart deployments, which is also assumed for data recorded before deployment types were introduced
+func IsHelmDeployment(rd *RelizaDeployment) bool {
+	return rd.Type == "" || rd.Type == DeploymentTypeHelm
+}
+
+func resolveDeploymentTypeFromMimeType(mimeType string) string {
+	deploymentType := ""
+	switch mimeType {
+	case HelmMimeType:
+		deploymentType = DeploymentTypeHelm
+	case ManifestsMimeType:
+		deploymentType = DeploymentTypeManifests
+	case KustomizeMimeType:
+		deploymentType = DeploymentTypeKustomize
+	}
+	return deploymentType
+}
+
+// DownloadManifestsArtifact pulls OCI-packaged manifests or kustomize bundle of rd and extracts it into the workspace
+func DownloadManifestsArtifact(groupPath string, rd *RelizaDeployment, pa *ProjectAuth, helmRepoInfo HelmRepoInfo) error {
+	artifactPath := groupPath + helmRepoInfo.ChartName
+	cleanupHelmChart(artifactPath)
+
+	registryHostAndPath := strings.SplitN(helmRepoInfo.RepoHost, "/", 2)
+	repository := helmRepoInfo.ChartName
+	if len(registryHostAndPath) > 1 {
+		repository = registryHostAndPath[1] + "/" + helmRepoInfo.ChartName
+	}
+	login := ""
+	password := ""
+	if pa.Type != "NOCREDS" {
+		login = pa.Login
+		password = pa.Password
+	}
+	ociClient := NewOciRegistryClient(registryHostAndPath[0], login, password)
+	layerDigest, manifestDigest, err := ociClient.PullArtifact(repository, rd.ArtVersion, artifactPath+".tgz")
+	if err == nil {
+		err = verifyManifestsArtifactDigest(rd.ArtHash, layerDigest, manifestDigest)
+	}
+	if err == nil {
+		err = os.MkdirAll(artifactPath, 0700)
+	}
+	if err == nil {
+		_, _, err = shellout("tar -xzf " + artifactPath + ".tgz -C " + artifactPath)
+	}
+	if err != nil {
+		sugar.Errorw("Failed to download manifests artifact",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"artifactName", helmRepoInfo.ChartName,
+			"type", rd.Type,
+			"namespace", rd.Namespace,
+			"repoUri", helmRepoInfo.RepoUri,
+			"expectedDigest", ExtractRlzDigestFromCdxDigest(rd.ArtHash),
+			"error", err)
+	}
+	return err
+}
+
+// verifyManifestsArtifactDigest checks pulled artifact against ArtHash of the CycloneDX component,
+// which may be either the digest of the archive layer or the digest of the OCI manifest
+func verifyManifestsArtifactDigest(artHash cdx.Hash, layerDigest string, manifestDigest string) error {
+	if len(artHash.Value) < 1 {
+		return nil
+	}
+	if artHash.Algorithm != cdx.HashAlgoSHA256 {
+		sugar.Warn("Skipping manifests artifact digest verification, unsupported hash algorithm: ", artHash.Algorithm)
+		return nil
+	}
+	expectedDigest := ExtractRlzDigestFromCdxDigest(artHash)
+	if strings.EqualFold(layerDigest, expectedDigest) || strings.EqualFold(manifestDigest, expectedDigest) {
+		return nil
+	}
+	return errors.New("manifests artifact digest mismatch, layer digest = " + layerDigest + ", manifest digest = " + manifestDigest + ", expected = " + expectedDigest)
+}
+
+// RenderManifests renders extracted artifact of rd into rendered-manifests.yaml via a generated kustomize overlay,
+// which sets target namespace and adds reliza.io labels used for pruning.
+// For kustomize bundles CONFIGURATION property of the component may point to a sub-directory with the kustomization to use.
+func RenderManifests(groupPath string, rd *RelizaDeployment) error {
+	artifactName := GetChartNameFromDeployment(rd)
+	overlayPath := groupPath + ManifestsOverlayDir + "/"
+	os.RemoveAll(overlayPath)
+	err := os.MkdirAll(overlayPath, 0700)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+
+	var resources []string
+	if rd.Type == DeploymentTypeKustomize {
+		kustomizePath := "../" + artifactName
+		if len(rd.ConfigFile) > 0 && rd.ConfigFile != "values.yaml" {
+			kustomizePath += "/" + strings.TrimPrefix(rd.ConfigFile, "/")
+		}
+		resources = append(resources, kustomizePath)
+	} else {
+		resources, err = listManifestFiles(groupPath+artifactName, "../"+artifactName)
+		if err != nil {
+			sugar.Error(err)
+			return err
+		}
+		if len(resources) < 1 {
+			return errors.New("no manifests found in artifact " + rd.ArtUri + ":" + rd.ArtVersion)
+		}
+	}
+
+	overlay := kustomization{
+		ApiVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Namespace:  rd.Namespace,
+		Resources:  resources,
+		Labels: []kustomizationLabels{{
+			Pairs: map[string]string{
+				"reliza.io/name":       rd.Name,
+				"reliza.io/managed-by": FieldManager,
+			},
+		}},
+	}
+	if len(instanceId) > 0 {
+		overlay.Labels[0].Pairs["reliza.io/instance"] = instanceId
+	}
+	overlayYaml, err := yaml.Marshal(overlay)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(overlayPath+"kustomization.yaml", overlayYaml, 0600)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+
+	_, stderr, err := shellout(KubectlApp + " kustomize " + overlayPath + " -o " + groupPath + ManifestsRendered)
+	if err != nil {
+		sugar.Errorw("Failed to render manifests",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"namespace", rd.Namespace,
+			"stderr", stderr,
+			"error", err)
+	}
+	return err
+}
+
+func listManifestFiles(artifactPath string, relativePrefix string) ([]string, error) {
+	var manifestFiles []string
+	err := filepath.WalkDir(artifactPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !d.IsDir() && (ext == ".yaml" || ext == ".yml" || ext == ".json") {
+			relPath, _ := filepath.Rel(artifactPath, path)
+			manifestFiles = append(manifestFiles, relativePrefix+"/"+filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+	return manifestFiles, err
+}
+
+// IsManifestsDiff returns true if rendered manifests differ from the last successfully applied ones
+func IsManifestsDiff(groupPath string) bool {
+	applied, err := os.ReadFile(groupPath + ManifestsApplied)
+	if err != nil {
+		return true
+	}
+	rendered, err := os.ReadFile(groupPath + ManifestsRendered)
+	if err != nil {
+		sugar.Error(err)
+		return true
+	}
+	return string(applied) != string(rendered)
+}
+
+// ApplyManifests server-side applies rendered manifests of rd and prunes objects of the previously applied manifests
+// of the same deployment that are no longer present
+func ApplyManifests(groupPath string, rd *RelizaDeployment) error {
+	CreateNamespaceIfMissing(rd.Namespace, ClusterFlags(rd))
+	sugar.Info("Applying manifests ", rd.ArtUri, " version ", rd.ArtVersion, " to namespace ", rd.Namespace)
+	err := KubectlApplyWithFlags(groupPath+ManifestsRendered, " -n "+rd.Namespace+ClusterFlags(rd))
+	if err == nil {
+		err = pruneRemovedManifests(groupPath, rd)
+	}
+	if err == nil {
+		_, _, err = shellout("cp " + groupPath + ManifestsRendered + " " + groupPath + ManifestsApplied)
+		sugar.Info("Successfully applied manifests ", rd.ArtUri, " version ", rd.ArtVersion, " to namespace ", rd.Namespace)
+	} else {
+		sugar.Error("Failed to apply manifests: ", err)
+	}
+	return err
+}
+
+// manifestObject identifies an object of rendered manifests
+type manifestObject struct {
+	ApiVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// resource returns kind qualified with API group, as accepted by kubectl
+func (obj manifestObject) resource() string {
+	group, _, hasGroup := strings.Cut(obj.ApiVersion, "/")
+	if !hasGroup {
+		return obj.Kind
+	}
+	return obj.Kind + "." + group
+}
+
+func readManifestObjects(path string) ([]manifestObject, error) {
+	manifestsFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer manifestsFile.Close()
+	var objs []manifestObject
+	decoder := yaml.NewDecoder(manifestsFile)
+	for {
+		var obj manifestObject
+		err = decoder.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(obj.Kind) > 0 && len(obj.Metadata.Name) > 0 {
+			objs = append(objs, obj)
+		}
+	}
+}
+
+// pruneRemovedManifests deletes objects of the last applied manifests of rd which are not present in rendered manifests,
+// server-side apply has no pruning of its own
+func pruneRemovedManifests(groupPath string, rd *RelizaDeployment) error {
+	appliedObjs, err := readManifestObjects(groupPath + ManifestsApplied)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	var renderedObjs []manifestObject
+	if err == nil {
+		renderedObjs, err = readManifestObjects(groupPath + ManifestsRendered)
+	}
+	if err != nil {
+		sugar.Error("Failed to read manifests for pruning: ", err)
+		return err
+	}
+	rendered := map[manifestObject]bool{}
+	for _, obj := range renderedObjs {
+		rendered[obj] = true
+	}
+	for _, obj := range appliedObjs {
+		if rendered[obj] {
+			continue
+		}
+		namespace := obj.Metadata.Namespace
+		if len(namespace) < 1 {
+			namespace = rd.Namespace
+		}
+		sugar.Info("Pruning ", obj.Kind, " ", obj.Metadata.Name, " removed from manifests of ", rd.Name)
+		_, stderr, err := dryRunShellout(KubectlApp + " delete " + obj.resource() + " " + obj.Metadata.Name + " -n " + namespace + ClusterFlags(rd) + " --ignore-not-found")
+		if err != nil {
+			sugar.Errorw("Failed to prune object removed from manifests", "kind", obj.Kind, "name", obj.Metadata.Name, "stderr", stderr, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteManifests removes all objects of the last applied manifests from the cluster
+func DeleteManifests(groupPath string, rd *RelizaDeployment) {
+	sugar.Info("Deleting manifests ", rd.ArtUri, " from namespace ", rd.Namespace)
+	dryRunShellout(KubectlApp + " delete -n " + rd.Namespace + ClusterFlags(rd) + " -f " + groupPath + ManifestsApplied + " --ignore-not-found")
+}
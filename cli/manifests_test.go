@@ -0,0 +1,259 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+	"gopkg.in/yaml.v3"
+)
+
+func TestResolveDeploymentTypeFromMimeType(t *testing.T) {
+	cases := map[string]string{
+		HelmMimeType:               DeploymentTypeHelm,
+		ManifestsMimeType:          DeploymentTypeManifests,
+		KustomizeMimeType:          DeploymentTypeKustomize,
+		"application/octet-stream": "",
+	}
+	for mimeType, expected := range cases {
+		if deploymentType := resolveDeploymentTypeFromMimeType(mimeType); deploymentType != expected {
+			t.Errorf("expected %s for mime type %q, got %s", expected, mimeType, deploymentType)
+		}
+	}
+}
+
+func TestRenderManifestsOverlay(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	rd.Type = DeploymentTypeManifests
+	os.MkdirAll(groupPath+"my-app/apps", 0700)
+	os.WriteFile(groupPath+"my-app/configmap.yaml", []byte("kind: ConfigMap\n"), 0600)
+	os.WriteFile(groupPath+"my-app/apps/deployment.yml", []byte("kind: Deployment\n"), 0600)
+	os.WriteFile(groupPath+"my-app/README.md", []byte("readme\n"), 0600)
+
+	if err := RenderManifests(groupPath, &rd); err != nil {
+		t.Fatal(err)
+	}
+	overlay := readTestOverlay(t, groupPath)
+	if overlay.Namespace != "prod" {
+		t.Errorf("expected overlay to set namespace prod, got %s", overlay.Namespace)
+	}
+	expectedResources := []string{"../my-app/apps/deployment.yml", "../my-app/configmap.yaml"}
+	if !reflect.DeepEqual(overlay.Resources, expectedResources) {
+		t.Errorf("expected resources %v, got %v", expectedResources, overlay.Resources)
+	}
+	expectedLabels := map[string]string{"reliza.io/name": "prod---my-app", "reliza.io/managed-by": "reliza-cd"}
+	if len(overlay.Labels) != 1 || !reflect.DeepEqual(overlay.Labels[0].Pairs, expectedLabels) {
+		t.Errorf("expected labels %v, got %v", expectedLabels, overlay.Labels)
+	}
+	if calls := fakeToolCalls(t, toolsPath, "kubectl kustomize "+groupPath+"overlay/ -o "+groupPath+ManifestsRendered); len(calls) != 1 {
+		t.Fatalf("expected overlay to be rendered with kubectl kustomize, got %v", fakeToolCalls(t, toolsPath, "kubectl"))
+	}
+}
+
+func TestRenderKustomizeBundleWithConfigurationDirectory(t *testing.T) {
+	fakeTools(t, map[string]string{})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	rd.Type = DeploymentTypeKustomize
+	rd.ConfigFile = "/overlays/prod"
+
+	if err := RenderManifests(groupPath, &rd); err != nil {
+		t.Fatal(err)
+	}
+	overlay := readTestOverlay(t, groupPath)
+	if !reflect.DeepEqual(overlay.Resources, []string{"../my-app/overlays/prod"}) {
+		t.Fatalf("expected kustomization of configuration directory to be used, got %v", overlay.Resources)
+	}
+}
+
+func TestRenderManifestsFailsWithoutManifests(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	rd.Type = DeploymentTypeManifests
+	os.MkdirAll(groupPath+"my-app", 0700)
+
+	if err := RenderManifests(groupPath, &rd); err == nil {
+		t.Fatal("expected rendering of artifact without manifests to fail")
+	}
+	if calls := fakeToolCalls(t, toolsPath, "kubectl kustomize"); len(calls) > 0 {
+		t.Fatalf("expected nothing to be rendered, got %v", calls)
+	}
+}
+
+func readTestOverlay(t *testing.T, groupPath string) kustomization {
+	t.Helper()
+	overlayYaml, err := os.ReadFile(groupPath + ManifestsOverlayDir + "/kustomization.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var overlay kustomization
+	if err = yaml.Unmarshal(overlayYaml, &overlay); err != nil {
+		t.Fatal(err)
+	}
+	return overlay
+}
+
+func TestIsManifestsDiff(t *testing.T) {
+	groupPath := t.TempDir() + "/"
+	os.WriteFile(groupPath+ManifestsRendered, []byte("kind: ConfigMap\n"), 0600)
+	if !IsManifestsDiff(groupPath) {
+		t.Fatal("expected manifests which were never applied to differ")
+	}
+	os.WriteFile(groupPath+ManifestsApplied, []byte("kind: ConfigMap\n"), 0600)
+	if IsManifestsDiff(groupPath) {
+		t.Fatal("expected manifests equal to applied ones not to differ")
+	}
+	os.WriteFile(groupPath+ManifestsRendered, []byte("kind: Secret\n"), 0600)
+	if !IsManifestsDiff(groupPath) {
+		t.Fatal("expected changed manifests to differ")
+	}
+}
+
+// serveTestManifestsArtifact serves artifact registry.example.com/charts/my-app:1.2.3 holding configmap.yaml
+// and returns registry host and digest of its archive layer
+func serveTestManifestsArtifact(t *testing.T) (string, string) {
+	t.Helper()
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	content := []byte("kind: ConfigMap\n")
+	tarWriter.WriteHeader(&tar.Header{Name: "configmap.yaml", Mode: 0600, Size: int64(len(content))})
+	tarWriter.Write(content)
+	tarWriter.Close()
+	gzipWriter.Close()
+	layerDigestBytes := sha256.Sum256(archive.Bytes())
+	layerDigest := "sha256:" + hex.EncodeToString(layerDigestBytes[:])
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/charts/my-app/manifests/1.2.3":
+			w.Write([]byte(testOciManifest(layerDigest)))
+		case "/v2/charts/my-app/blobs/" + layerDigest:
+			w.Write(archive.Bytes())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	prevTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = prevTransport })
+	return strings.TrimPrefix(server.URL, "https://"), layerDigest
+}
+
+func TestDownloadManifestsArtifactVerifiesDigest(t *testing.T) {
+	fakeTools(t, map[string]string{})
+	registryHost, layerDigest := serveTestManifestsArtifact(t)
+	rd, _, helmInfo := testResourceDeployment()
+	rd.Type = DeploymentTypeManifests
+	helmInfo.RepoHost = registryHost + "/charts"
+	pa := ProjectAuth{Type: "NOCREDS"}
+
+	for _, expectedDigest := range []string{layerDigest, testOciManifestDigest(layerDigest)} {
+		groupPath := t.TempDir() + "/"
+		rd.ArtHash = cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: strings.TrimPrefix(expectedDigest, "sha256:")}
+		if err := DownloadManifestsArtifact(groupPath, &rd, &pa, helmInfo); err != nil {
+			t.Fatalf("expected artifact matching %s to be downloaded, got %v", expectedDigest, err)
+		}
+		if _, err := os.Stat(groupPath + "my-app/configmap.yaml"); err != nil {
+			t.Fatalf("expected artifact to be extracted, got %v", err)
+		}
+	}
+}
+
+func TestApplyManifestsPrunesRemovedObjects(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{})
+	groupPath := t.TempDir() + "/"
+	rd, _, _ := testResourceDeployment()
+	rd.Type = DeploymentTypeManifests
+	os.WriteFile(groupPath+ManifestsApplied, []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: prod
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  namespace: prod
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: prod
+`), 0600)
+	rendered := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: prod
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: prod
+`
+	os.WriteFile(groupPath+ManifestsRendered, []byte(rendered), 0600)
+
+	if err := ApplyManifests(groupPath, &rd); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fakeToolCalls(t, toolsPath, "kubectl apply --server-side --field-manager=reliza-cd -n prod -f "+groupPath+ManifestsRendered); len(calls) != 1 {
+		t.Fatalf("expected manifests to be server-side applied, got %v", fakeToolCalls(t, toolsPath, "kubectl apply"))
+	}
+	if calls := fakeToolCalls(t, toolsPath, "kubectl delete"); len(calls) != 1 || calls[0] != "kubectl delete Deployment.apps worker -n prod --ignore-not-found" {
+		t.Fatalf("expected only object removed from manifests to be pruned, got %v", calls)
+	}
+	if applied, _ := os.ReadFile(groupPath + ManifestsApplied); string(applied) != rendered {
+		t.Fatal("expected applied manifests to be recorded")
+	}
+}
+
+func TestDownloadManifestsArtifactFailsOnDigestMismatch(t *testing.T) {
+	fakeTools(t, map[string]string{})
+	registryHost, _ := serveTestManifestsArtifact(t)
+	rd, _, helmInfo := testResourceDeployment()
+	rd.Type = DeploymentTypeManifests
+	rd.ArtHash = cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: strings.Repeat("0", 64)}
+	helmInfo.RepoHost = registryHost + "/charts"
+	groupPath := t.TempDir() + "/"
+
+	err := DownloadManifestsArtifact(groupPath, &rd, &ProjectAuth{Type: "NOCREDS"}, helmInfo)
+	if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+	if _, err = os.Stat(groupPath + "my-app"); !os.IsNotExist(err) {
+		t.Fatal("expected artifact not to be extracted on digest mismatch")
+	}
+}
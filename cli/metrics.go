@@ -0,0 +1,162 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	metricArgoWaits        = "reliza_cd_argo_application_waits_total"
+	metricArgoWaitDuration = "reliza_cd_argo_application_wait_duration_seconds"
+	metricArgoSynced       = "reliza_cd_argo_application_synced"
+	metricArgoHealthy      = "reliza_cd_argo_application_healthy"
+)
+
+// metricFamily holds values of a metric by series, which is the label set formatted as in Prometheus text format,
+// i.e. {result="settled"}, prefixed with the suffix of the metric name for _sum and _count of summaries
+type metricFamily struct {
+	help       string
+	metricType string
+	series     map[string]float64
+}
+
+var (
+	metricsPort int
+	metrics     = map[string]*metricFamily{
+		metricArgoWaits:        {help: "Completed waits for Argo CD applications to sync by result.", metricType: "counter"},
+		metricArgoWaitDuration: {help: "Duration of completed waits for Argo CD applications to sync by result.", metricType: "summary"},
+		metricArgoSynced:       {help: "Whether the Argo CD application of the bundle is synced to the deployed version.", metricType: "gauge"},
+		metricArgoHealthy:      {help: "Whether the Argo CD application of the bundle is healthy.", metricType: "gauge"},
+	}
+	metricsLock sync.Mutex
+)
+
+func initMetricsConfig() {
+	metricsPort = parseIntEnv("METRICS_PORT", 0)
+}
+
+// StartMetricsServer serves metrics in Prometheus text format on /metrics of METRICS_PORT, if set
+func StartMetricsServer() {
+	if metricsPort <= 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	err := http.ListenAndServe(":"+strconv.Itoa(metricsPort), mux)
+	sugar.Error("Metrics server stopped: ", err)
+}
+
+// metricLabels formats label pairs name1, value1, name2, value2... as a Prometheus label set
+func metricLabels(pairs ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var labels []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, pairs[i]+`="`+escaper.Replace(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// addMetric adds value to counter or summary series of metric name
+func addMetric(name string, labels string, value float64) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	family := metrics[name]
+	if family.series == nil {
+		family.series = map[string]float64{}
+	}
+	family.series[labels] += value
+}
+
+// setMetric sets gauge of metric name with labels to value
+func setMetric(name string, labels string, value float64) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	family := metrics[name]
+	if family.series == nil {
+		family.series = map[string]float64{}
+	}
+	family.series[labels] = value
+}
+
+// deleteMetric removes series of metric name with labels, i.e. once the deployment it describes is deleted
+func deleteMetric(name string, labels string) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	delete(metrics[name].series, labels)
+}
+
+// recordArgoWaitMetrics counts completed wait for an Argo CD application, result is settled, failed or timeout
+func recordArgoWaitMetrics(result string, seconds float64) {
+	labels := metricLabels("result", result)
+	addMetric(metricArgoWaits, labels, 1)
+	addMetric(metricArgoWaitDuration, "_sum"+labels, seconds)
+	addMetric(metricArgoWaitDuration, "_count"+labels, 1)
+}
+
+// recordArgoStatusMetrics sets sync and health gauges of Argo CD application from appStatus
+func recordArgoStatusMetrics(appStatus ArgoApplicationStatus) {
+	labels := metricLabels("name", appStatus.Name, "namespace", appStatus.Namespace, "bundle", appStatus.Bundle)
+	synced := 0.0
+	if appStatus.SyncStatus == "Synced" && appStatus.SyncRevision == appStatus.Version {
+		synced = 1
+	}
+	healthy := 0.0
+	if appStatus.HealthStatus == "Healthy" {
+		healthy = 1
+	}
+	setMetric(metricArgoSynced, labels, synced)
+	setMetric(metricArgoHealthy, labels, healthy)
+}
+
+// deleteArgoStatusMetrics removes sync and health gauges of Argo CD application of rd
+func deleteArgoStatusMetrics(rd *RelizaDeployment) {
+	labels := metricLabels("name", rd.Name, "namespace", rd.Namespace, "bundle", rd.Bundle)
+	deleteMetric(metricArgoSynced, labels)
+	deleteMetric(metricArgoHealthy, labels)
+}
+
+func writeMetrics(w io.Writer) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := metrics[name]
+		io.WriteString(w, "# HELP "+name+" "+family.help+"\n")
+		io.WriteString(w, "# TYPE "+name+" "+family.metricType+"\n")
+		series := make([]string, 0, len(family.series))
+		for seriesKey := range family.series {
+			series = append(series, seriesKey)
+		}
+		sort.Strings(series)
+		for _, seriesKey := range series {
+			io.WriteString(w, name+seriesKey+" "+strconv.FormatFloat(family.series[seriesKey], 'g', -1, 64)+"\n")
+		}
+	}
+}
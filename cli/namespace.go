@@ -0,0 +1,383 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	NamespaceLabelsProperty        = "NAMESPACE_LABELS"
+	NamespaceAnnotationsProperty   = "NAMESPACE_ANNOTATIONS"
+	NamespaceResourceQuotaProperty = "NAMESPACE_RESOURCE_QUOTA"
+	NamespaceLimitRangeProperty    = "NAMESPACE_LIMIT_RANGE"
+	NamespaceYaml                  = "namespace.yaml"
+	NamespacePolicyName            = "reliza-default"
+)
+
+// NamespaceConfig holds namespace metadata and default policies, quota and limit range are specs of the respective objects
+type NamespaceConfig struct {
+	Labels        map[string]string
+	Annotations   map[string]string
+	ResourceQuota map[string]interface{}
+	LimitRange    map[string]interface{}
+}
+
+var (
+	defaultResourceQuota      map[string]interface{}
+	defaultLimitRange         map[string]interface{}
+	deleteEmptyNamespaces     bool
+	appliedNamespaces         = map[string]string{}
+	pendingNamespaceDeletions = map[string]bool{}
+	namespaceConfigCache      = map[string]cachedNamespaceConfig{}
+	namespaceConfigTtl        time.Duration
+)
+
+func initNamespaceConfig() {
+	defaultResourceQuota = parseNamespaceSpec("DEFAULT_NAMESPACE_RESOURCE_QUOTA", os.Getenv("DEFAULT_NAMESPACE_RESOURCE_QUOTA"))
+	defaultLimitRange = parseNamespaceSpec("DEFAULT_NAMESPACE_LIMIT_RANGE", os.Getenv("DEFAULT_NAMESPACE_LIMIT_RANGE"))
+	deleteEmptyNamespaces = strings.ToLower(os.Getenv("DELETE_EMPTY_NAMESPACES")) == "true"
+	namespaceConfigTtl = time.Duration(parseIntEnv("NAMESPACE_CONFIG_TTL", 300)) * time.Second
+}
+
+func parseNamespaceSpec(source string, specYaml string) map[string]interface{} {
+	if len(strings.TrimSpace(specYaml)) < 1 {
+		return nil
+	}
+	var spec map[string]interface{}
+	err := yaml.Unmarshal([]byte(specYaml), &spec)
+	if err != nil {
+		sugar.Error("Failed to parse "+source+": ", err)
+		return nil
+	}
+	return spec
+}
+
+func parseNamespaceMetadata(source string, metadataYaml string) map[string]string {
+	if len(strings.TrimSpace(metadataYaml)) < 1 {
+		return nil
+	}
+	var metadata map[string]string
+	err := yaml.Unmarshal([]byte(metadataYaml), &metadata)
+	if err != nil {
+		sugar.Error("Failed to parse "+source+": ", err)
+		return nil
+	}
+	return metadata
+}
+
+// cachedNamespaceConfig is namespace configuration resolved from instance properties for the bundle
+type cachedNamespaceConfig struct {
+	Bundle     string
+	Config     NamespaceConfig
+	ResolvedAt time.Time
+}
+
+// NamespaceDeployments returns one deployment per namespace of each target cluster, sorted by namespace, for which namespace configuration is resolved.
+// When several bundles are deployed to a namespace, the alphabetically first bundle wins, so that the configuration does not
+// depend on the order of deployments in the instance.
+func NamespaceDeployments(rlzDeployments []RelizaDeployment) []RelizaDeployment {
+	nsDeployments := map[string]RelizaDeployment{}
+	for _, rd := range rlzDeployments {
+		clusterNs := clusterNamespace(rd.Cluster, rd.Namespace)
+		nsRd, exists := nsDeployments[clusterNs]
+		if !exists || rd.Bundle < nsRd.Bundle {
+			nsDeployments[clusterNs] = rd
+		}
+	}
+	var namespaceDeployments []RelizaDeployment
+	for _, rd := range nsDeployments {
+		namespaceDeployments = append(namespaceDeployments, rd)
+	}
+	sort.Slice(namespaceDeployments, func(i, j int) bool {
+		return clusterNamespace(namespaceDeployments[i].Cluster, namespaceDeployments[i].Namespace) <
+			clusterNamespace(namespaceDeployments[j].Cluster, namespaceDeployments[j].Namespace)
+	})
+	return namespaceDeployments
+}
+
+// getNamespaceConfig returns namespace configuration of rd, resolved from instance properties at most once per NAMESPACE_CONFIG_TTL.
+// If properties cannot be fetched, previously resolved configuration is kept.
+func getNamespaceConfig(rd *RelizaDeployment, now time.Time) NamespaceConfig {
+	clusterNs := clusterNamespace(rd.Cluster, rd.Namespace)
+	cached, isCached := namespaceConfigCache[clusterNs]
+	if isCached && cached.Bundle == rd.Bundle && now.Sub(cached.ResolvedAt) < namespaceConfigTtl {
+		return cached.Config
+	}
+	nsConfig, err := resolveNamespaceConfig(rd)
+	if err != nil {
+		if isCached {
+			sugar.Warnw("Failed to resolve namespace configuration, keeping previous configuration",
+				"namespace", rd.Namespace,
+				"bundle", rd.Bundle,
+				"error", err)
+			return cached.Config
+		}
+		return nsConfig
+	}
+	namespaceConfigCache[clusterNs] = cachedNamespaceConfig{Bundle: rd.Bundle, Config: nsConfig, ResolvedAt: now}
+	return nsConfig
+}
+
+// resolveNamespaceConfig reads namespace configuration from instance properties scoped to the namespace and bundle of rd,
+// quota and limit range fall back to defaults from environment. Returns the first error fetching properties.
+func resolveNamespaceConfig(rd *RelizaDeployment) (NamespaceConfig, error) {
+	var nsConfig NamespaceConfig
+	var firstErr error
+	getProperty := func(property string) string {
+		value, err := GetInstancePropertyForBundle(rd, property)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	}
+	nsConfig.Labels = parseNamespaceMetadata(NamespaceLabelsProperty, getProperty(NamespaceLabelsProperty))
+	nsConfig.Annotations = parseNamespaceMetadata(NamespaceAnnotationsProperty, getProperty(NamespaceAnnotationsProperty))
+	nsConfig.ResourceQuota = defaultResourceQuota
+	quota := getProperty(NamespaceResourceQuotaProperty)
+	if len(strings.TrimSpace(quota)) > 0 {
+		nsConfig.ResourceQuota = parseNamespaceSpec(NamespaceResourceQuotaProperty, quota)
+	}
+	nsConfig.LimitRange = defaultLimitRange
+	limitRange := getProperty(NamespaceLimitRangeProperty)
+	if len(strings.TrimSpace(limitRange)) > 0 {
+		nsConfig.LimitRange = parseNamespaceSpec(NamespaceLimitRangeProperty, limitRange)
+	}
+	return nsConfig, firstErr
+}
+
+func namespaceOwnershipLabels() map[string]string {
+	labels := map[string]string{"reliza.io/managed-by": FieldManager}
+	if len(instanceId) > 0 {
+		labels["reliza.io/instance"] = instanceId
+	}
+	return labels
+}
+
+// EnsureNamespace creates namespace of rd if missing and applies labels, annotations, ResourceQuota and LimitRange
+// configured for it. Namespaces created by reliza-cd are labelled with reliza.io/managed-by, which makes them eligible
+// for deletion once empty. Configuration is re-applied only when it changes.
+func EnsureNamespace(rd *RelizaDeployment) {
+	nsConfig := getNamespaceConfig(rd, time.Now())
+	nsState, _, err := shellout(KubectlApp + " get namespace " + rd.Namespace + ClusterFlags(rd) + " --ignore-not-found -o jsonpath='{.metadata.name}{\" \"}{.metadata.labels.reliza\\.io/managed-by}'")
+	if err != nil {
+		return
+	}
+	nsStateFields := strings.Fields(nsState)
+	exists := len(nsStateFields) > 0
+	createdByReliza := !exists || (len(nsStateFields) > 1 && nsStateFields[1] == FieldManager)
+
+	var nsYaml bytes.Buffer
+	err = ProduceNamespaceYaml(&nsYaml, rd.Namespace, createdByReliza, nsConfig)
+	if err != nil {
+		sugar.Error(err)
+		return
+	}
+	clusterNs := clusterNamespace(rd.Cluster, rd.Namespace)
+	if exists && appliedNamespaces[clusterNs] == nsYaml.String() {
+		return
+	}
+
+	groupPath := "workspace/" + rd.Name + "/"
+	os.MkdirAll(groupPath, 0700)
+	err = os.WriteFile(groupPath+NamespaceYaml, nsYaml.Bytes(), 0600)
+	if err == nil {
+		err = KubectlApplyWithFlags(groupPath+NamespaceYaml, ClusterFlags(rd))
+	}
+	if err != nil {
+		sugar.Errorw("Failed to apply namespace configuration",
+			"namespace", rd.Namespace,
+			"bundle", rd.Bundle,
+			"error", err)
+		return
+	}
+	if nsConfig.ResourceQuota == nil {
+		dryRunShellout(KubectlApp + " delete resourcequota " + NamespacePolicyName + " -n " + rd.Namespace + ClusterFlags(rd) + " --ignore-not-found")
+	}
+	if nsConfig.LimitRange == nil {
+		dryRunShellout(KubectlApp + " delete limitrange " + NamespacePolicyName + " -n " + rd.Namespace + ClusterFlags(rd) + " --ignore-not-found")
+	}
+	appliedNamespaces[clusterNs] = nsYaml.String()
+	delete(pendingNamespaceDeletions, clusterNs)
+	sugar.Infow("Applied namespace configuration",
+		"namespace", rd.Namespace,
+		"createdByReliza", createdByReliza)
+}
+
+func ProduceNamespaceYaml(w io.Writer, namespace string, createdByReliza bool, nsConfig NamespaceConfig) error {
+	nsLabels := map[string]string{}
+	for k, v := range nsConfig.Labels {
+		nsLabels[k] = v
+	}
+	if createdByReliza {
+		for k, v := range namespaceOwnershipLabels() {
+			nsLabels[k] = v
+		}
+	}
+	objs := []interface{}{k8sNamespace{
+		ApiVersion: "v1",
+		Kind:       "Namespace",
+		Metadata: objectMetadata{
+			Name:        namespace,
+			Labels:      nsLabels,
+			Annotations: nsConfig.Annotations,
+		},
+	}}
+	if nsConfig.ResourceQuota != nil {
+		objs = append(objs, k8sSpecObject{
+			ApiVersion: "v1",
+			Kind:       "ResourceQuota",
+			Metadata:   objectMetadata{Name: NamespacePolicyName, Namespace: namespace, Labels: namespaceOwnershipLabels()},
+			Spec:       nsConfig.ResourceQuota,
+		})
+	}
+	if nsConfig.LimitRange != nil {
+		objs = append(objs, k8sSpecObject{
+			ApiVersion: "v1",
+			Kind:       "LimitRange",
+			Metadata:   objectMetadata{Name: NamespacePolicyName, Namespace: namespace, Labels: namespaceOwnershipLabels()},
+			Spec:       nsConfig.LimitRange,
+		})
+	}
+	return writeYamlDocuments(w, objs...)
+}
+
+// DeleteEmptyNamespaces deletes namespaces created by reliza-cd once no deployments remain in them, when DELETE_EMPTY_NAMESPACES
+// is true. Namespaces still holding helm releases or workloads, i.e. terminating pods, are retried on the next loops. Deletions are
+// subject to deletion protection: a namespace must be empty for DELETION_GRACE_LOOPS loops and DELETION_GRACE_PERIOD, deletions
+// count towards MAX_DELETIONS_PER_LOOP and need confirmation in PROTECTED_NAMESPACES. Namespaces are deleted in the target cluster
+// recorded for their deployments.
+func DeleteEmptyNamespaces(existingDeployments map[string]bool) {
+	if !deleteEmptyNamespaces || !loadAbsences() {
+		return
+	}
+	now := time.Now()
+	for _, clusterNs := range findEmptyNamespaces(existingDeployments, isWorkspacePresent, recordedDeploymentCluster) {
+		pendingNamespaceDeletions[clusterNs] = true
+	}
+	// namespaces found empty before a restart are known only from their persisted absences
+	for key := range absentDeployments {
+		if absenceKeyPrefix(key) == namespaceAbsencePrefix {
+			pendingNamespaceDeletions[strings.TrimPrefix(key, namespaceAbsencePrefix)] = true
+		}
+	}
+	namespaceKeys := map[string]bool{}
+	var candidates []string
+	for clusterNs := range pendingNamespaceDeletions {
+		if !isNamespaceEligibleForDeletion(clusterNs) {
+			continue
+		}
+		key := namespaceAbsencePrefix + clusterNs
+		namespaceKeys[key] = true
+		if trackAbsence(key, now) {
+			candidates = append(candidates, key)
+		} else {
+			sugar.Infow("Namespace is empty, waiting for grace period before deletion",
+				"namespace", clusterNs,
+				"emptyLoops", absentDeployments[key].Loops)
+		}
+	}
+	pruneAbsences(namespaceAbsencePrefix, namespaceKeys)
+	sortByAbsence(candidates)
+	for _, key := range candidates {
+		clusterNs := strings.TrimPrefix(key, namespaceAbsencePrefix)
+		cluster, ns := splitClusterNamespace(clusterNs)
+		if deletionProtectionConfig.ProtectedNamespaces[ns] && !isDeletionConfirmed(key) {
+			continue
+		}
+		if !takeDeletionSlot(key) {
+			break
+		}
+		_, _, err := dryRunShellout(KubectlApp + " delete namespace " + ns + clusterFlags(cluster) + " --ignore-not-found --wait=false")
+		if err == nil {
+			sugar.Infow("Deleted empty reliza-created namespace", "namespace", ns, "cluster", cluster)
+			clearAbsence(key)
+			delete(pendingNamespaceDeletions, clusterNs)
+			delete(appliedNamespaces, clusterNs)
+		}
+	}
+}
+
+func isWorkspacePresent(name string) bool {
+	_, err := os.Stat("workspace/" + name)
+	return err == nil
+}
+
+// findEmptyNamespaces returns namespaces of obsolete deployments in which no current or not yet deleted deployments remain,
+// as cluster namespaces of the cluster recorded for the deployment
+func findEmptyNamespaces(existingDeployments map[string]bool, isWorkspacePresent func(string) bool, deploymentCluster func(string) string) []string {
+	activeNamespaces := map[string]bool{}
+	obsoleteNamespaces := map[string]bool{}
+	for name, isPresent := range existingDeployments {
+		clusterNs := clusterNamespace(deploymentCluster(name), getNamespaceFromDeploymentName(name))
+		if isPresent || isWorkspacePresent(name) {
+			activeNamespaces[clusterNs] = true
+		} else {
+			obsoleteNamespaces[clusterNs] = true
+		}
+	}
+	for clusterNs := range pendingNamespaceDeletions {
+		if activeNamespaces[clusterNs] {
+			delete(pendingNamespaceDeletions, clusterNs)
+		}
+	}
+	var emptyNamespaces []string
+	for clusterNs := range obsoleteNamespaces {
+		if !activeNamespaces[clusterNs] && clusterNs != RelizaNamespace && clusterNs != SecretsNamespace {
+			emptyNamespaces = append(emptyNamespaces, clusterNs)
+		}
+	}
+	sort.Strings(emptyNamespaces)
+	return emptyNamespaces
+}
+
+// isNamespaceEligibleForDeletion returns true if cluster namespace was created by this reliza-cd instance, is not protected
+// and holds no helm releases or workloads
+func isNamespaceEligibleForDeletion(clusterNs string) bool {
+	cluster, ns := splitClusterNamespace(clusterNs)
+	nsState, _, err := shellout(KubectlApp + " get namespace " + ns + clusterFlags(cluster) + " --ignore-not-found -o jsonpath='{.metadata.labels.reliza\\.io/managed-by}{\" \"}{.metadata.annotations.reliza\\.io/protect}{\" \"}{.metadata.labels.reliza\\.io/instance}'")
+	if err != nil {
+		return false
+	}
+	nsStateFields := append(strings.Split(nsState, " "), "", "")
+	managedBy, protect, nsInstance := nsStateFields[0], nsStateFields[1], nsStateFields[2]
+	if managedBy != FieldManager || (len(nsInstance) > 0 && nsInstance != instanceId) {
+		// namespace is gone or was not created by this reliza-cd instance
+		delete(pendingNamespaceDeletions, clusterNs)
+		return false
+	}
+	if strings.ToLower(protect) == "true" {
+		sugar.Debug("Namespace ", clusterNs, " is protected, skipping deletion")
+		return false
+	}
+	releases, _, err := shellout(HelmApp + " list -q -a -n " + ns + clusterFlags(cluster))
+	if err != nil || len(strings.TrimSpace(releases)) > 0 {
+		return false
+	}
+	workloads, _, err := shellout(KubectlApp + " get all -n " + ns + clusterFlags(cluster) + " -o name")
+	if err != nil || len(strings.TrimSpace(workloads)) > 0 {
+		sugar.Debug("Namespace ", ns, " still has workloads, deferring deletion")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNamespaceDeployments(t *testing.T) {
+	rlzDeployments := []RelizaDeployment{
+		{Name: "prod---zeta", Namespace: "prod", Bundle: "Zeta"},
+		{Name: "dev---beta", Namespace: "dev", Bundle: "Beta"},
+		{Name: "prod---alpha", Namespace: "prod", Bundle: "Alpha"},
+	}
+	var names []string
+	for _, rd := range NamespaceDeployments(rlzDeployments) {
+		names = append(names, rd.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"dev---beta", "prod---alpha"}) {
+		t.Fatalf("expected alphabetically first bundle per namespace, got %v", names)
+	}
+}
+
+func TestNamespaceConfigIsCached(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		"reliza-cli": "[ -f \"$(dirname $0)/../hub-down\" ] && exit 1\n" +
+			"case \"$*\" in *NAMESPACE_LABELS*) echo '{\"properties\":[{\"key\":\"NAMESPACE_LABELS\",\"value\":\"team: payments\"}]}';;\n" +
+			"*) echo '{\"properties\":[]}';; esac",
+	})
+	prevTtl := namespaceConfigTtl
+	t.Cleanup(func() {
+		namespaceConfigTtl = prevTtl
+		namespaceConfigCache = map[string]cachedNamespaceConfig{}
+	})
+	namespaceConfigTtl = time.Minute
+	rd, _, _ := testResourceDeployment()
+	now := time.Unix(1760000000, 0)
+
+	nsConfig := getNamespaceConfig(&rd, now)
+	if nsConfig.Labels["team"] != "payments" {
+		t.Fatalf("expected namespace labels from instance properties, got %v", nsConfig.Labels)
+	}
+	getNamespaceConfig(&rd, now.Add(30*time.Second))
+	if calls := fakeToolCalls(t, toolsPath, "instprops"); len(calls) != 4 {
+		t.Fatalf("expected namespace properties to be fetched once within TTL, got %d calls", len(calls))
+	}
+
+	os.WriteFile(filepath.Join(toolsPath, "hub-down"), []byte{}, 0600)
+	nsConfig = getNamespaceConfig(&rd, now.Add(2*time.Minute))
+	if nsConfig.Labels["team"] != "payments" {
+		t.Fatal("expected previous namespace configuration to be kept while properties cannot be fetched")
+	}
+	if calls := fakeToolCalls(t, toolsPath, "instprops"); len(calls) != 8 {
+		t.Fatalf("expected namespace properties to be re-fetched after TTL, got %d calls", len(calls))
+	}
+}
+
+func TestDeleteEmptyNamespacesSafeguards(t *testing.T) {
+	fakePendingDeletions(t, "")
+	prevDelete := deleteEmptyNamespaces
+	t.Cleanup(func() {
+		deleteEmptyNamespaces = prevDelete
+		pendingNamespaceDeletions = map[string]bool{}
+	})
+	deleteEmptyNamespaces = true
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 2, ProtectedNamespaces: map[string]bool{"staging": true}}
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *'get namespace'*) printf 'reliza-cd  ';; esac",
+	})
+	existingDeployments := map[string]bool{"prod---app": true, "dev---old": false, "staging---old": false}
+
+	ResetDeletionBudget()
+	DeleteEmptyNamespaces(existingDeployments)
+	if len(fakeToolCalls(t, toolsPath, "delete namespace")) != 0 {
+		t.Fatal("expected empty namespaces not to be deleted before grace loops elapsed")
+	}
+	ResetDeletionBudget()
+	DeleteEmptyNamespaces(existingDeployments)
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete namespace dev")) != 1 {
+		t.Fatal("expected empty namespace to be deleted after grace loops")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete namespace staging")) != 0 {
+		t.Fatal("expected empty protected namespace not to be deleted without confirmation")
+	}
+}
+
+func TestDeleteEmptyNamespacesAfterRestart(t *testing.T) {
+	fakePendingDeletions(t, "")
+	prevDelete := deleteEmptyNamespaces
+	t.Cleanup(func() {
+		deleteEmptyNamespaces = prevDelete
+		pendingNamespaceDeletions = map[string]bool{}
+	})
+	deleteEmptyNamespaces = true
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 2}
+	// namespace found empty for one loop before the restart, its deployment is gone from the workspace since
+	since := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *type=pending-deletion*) printf 'namespace.dev\\t1\\t" + since + "\\n';;\n" +
+			"*'get namespace'*) printf 'reliza-cd  ';; esac",
+	})
+
+	ResetDeletionBudget()
+	DeleteEmptyNamespaces(map[string]bool{"prod---app": true})
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete namespace dev")) != 1 {
+		t.Fatal("expected namespace pending deletion before restart to be deleted once its grace loops elapsed")
+	}
+}
+
+func TestProduceNamespaceYamlGolden(t *testing.T) {
+	nsConfig := NamespaceConfig{
+		Labels:        map[string]string{"pod-security.kubernetes.io/enforce": "restricted", "istio-injection": "enabled"},
+		Annotations:   map[string]string{"scheduler.alpha.kubernetes.io/node-selector": "pool=apps"},
+		ResourceQuota: parseNamespaceSpec("test", "hard:\n  requests.cpu: \"4\"\n  requests.memory: 8Gi\n"),
+		LimitRange:    parseNamespaceSpec("test", "limits:\n  - type: Container\n    default:\n      cpu: 500m\n"),
+	}
+	var nsYaml bytes.Buffer
+	err := ProduceNamespaceYaml(&nsYaml, "prod", true, nsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "namespace.yaml", nsYaml.Bytes())
+}
+
+func TestFindEmptyNamespaces(t *testing.T) {
+	RelizaNamespace = "reliza"
+	SecretsNamespace = "reliza"
+	defer func() { pendingNamespaceDeletions = map[string]bool{} }()
+	pendingNamespaceDeletions["prod"] = true
+
+	existingDeployments := map[string]bool{
+		"prod---app":      true,
+		"prod---old":      false,
+		"dev---old":       false,
+		"staging---old":   false,
+		"staging---other": false,
+		"reliza---tool":   false,
+		"qa---remote":     false,
+		"qa---local":      true,
+	}
+	// staging---other deletion was deferred, so its workspace is still present
+	workspacePresent := func(name string) bool { return name == "staging---other" }
+	deploymentCluster := func(name string) string {
+		if name == "qa---remote" {
+			return "eu-prod"
+		}
+		return ""
+	}
+	emptyNamespaces := findEmptyNamespaces(existingDeployments, workspacePresent, deploymentCluster)
+	if !reflect.DeepEqual(emptyNamespaces, []string{"dev", "eu-prod.qa"}) {
+		t.Fatalf("expected dev namespace and qa namespace of eu-prod cluster to be empty, got %v", emptyNamespaces)
+	}
+	if pendingNamespaceDeletions["prod"] {
+		t.Fatal("expected pending deletion of active namespace to be discarded")
+	}
+}
@@ -0,0 +1,215 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	OciManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	DockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// OciRegistryClient pulls single-layer artifacts (i.e. packaged manifests) from an OCI distribution registry
+type OciRegistryClient struct {
+	BaseUrl    string
+	Login      string
+	Password   string
+	HttpClient *http.Client
+	authHeader string
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+type ociTokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+func NewOciRegistryClient(registryHost string, login string, password string) *OciRegistryClient {
+	return &OciRegistryClient{
+		BaseUrl:    "https://" + registryHost,
+		Login:      login,
+		Password:   password,
+		HttpClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// PullArtifact downloads the first layer of the artifact repository:tag into destPath,
+// verifying it against the layer digest. Returns the digest of the manifest layer and the digest of the manifest itself.
+func (c *OciRegistryClient) PullArtifact(repository string, tag string, destPath string) (string, string, error) {
+	manifestResp, err := c.get("/v2/"+repository+"/manifests/"+tag, OciManifestMediaType+", "+DockerManifestMediaType)
+	if err != nil {
+		return "", "", err
+	}
+	defer manifestResp.Body.Close()
+	manifestBytes, err := io.ReadAll(manifestResp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	manifestDigestBytes := sha256.Sum256(manifestBytes)
+	manifestDigest := "sha256:" + hex.EncodeToString(manifestDigestBytes[:])
+	var manifest ociManifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return "", "", err
+	}
+	if len(manifest.Layers) < 1 {
+		return "", "", errors.New("artifact " + repository + ":" + tag + " has no layers")
+	}
+	layer := manifest.Layers[0]
+
+	blobResp, err := c.get("/v2/"+repository+"/blobs/"+layer.Digest, "")
+	if err != nil {
+		return "", "", err
+	}
+	defer blobResp.Body.Close()
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer destFile.Close()
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(destFile, hasher), blobResp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	actualDigest := "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+	if actualDigest != layer.Digest {
+		return "", "", errors.New("digest mismatch for " + repository + ":" + tag + ", expected " + layer.Digest + ", got " + actualDigest)
+	}
+	return actualDigest, manifestDigest, nil
+}
+
+func (c *OciRegistryClient) get(path string, accept string) (*http.Response, error) {
+	resp, err := c.doGet(path, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && len(c.authHeader) < 1 {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		err = c.authorize(challenge)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = c.doGet(path, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New("registry returned " + resp.Status + " for " + path)
+	}
+	return resp, nil
+}
+
+func (c *OciRegistryClient) doGet(path string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseUrl+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", accept)
+	}
+	if len(c.authHeader) > 0 {
+		req.Header.Set("Authorization", c.authHeader)
+	}
+	return c.HttpClient.Do(req)
+}
+
+// authorize resolves Authorization header from registry challenge, supporting Basic and Bearer token schemes
+func (c *OciRegistryClient) authorize(challenge string) error {
+	if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+		req, _ := http.NewRequest(http.MethodGet, c.BaseUrl, nil)
+		req.SetBasicAuth(c.Login, c.Password)
+		c.authHeader = req.Header.Get("Authorization")
+		return nil
+	}
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer") {
+		return errors.New("unsupported registry auth challenge: " + challenge)
+	}
+
+	params := parseAuthChallengeParams(challenge[len("bearer"):])
+	realm := params["realm"]
+	if len(realm) < 1 {
+		return errors.New("registry auth challenge has no realm: " + challenge)
+	}
+	query := url.Values{}
+	if len(params["service"]) > 0 {
+		query.Set("service", params["service"])
+	}
+	if len(params["scope"]) > 0 {
+		query.Set("scope", params["scope"])
+	}
+	req, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if len(c.Login) > 0 {
+		req.SetBasicAuth(c.Login, c.Password)
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("registry token endpoint returned " + resp.Status)
+	}
+	var tokenResp ociTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	if err != nil {
+		return err
+	}
+	token := tokenResp.Token
+	if len(token) < 1 {
+		token = tokenResp.AccessToken
+	}
+	c.authHeader = "Bearer " + token
+	return nil
+}
+
+var authChallengeParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func parseAuthChallengeParams(paramsStr string) map[string]string {
+	params := make(map[string]string)
+	for _, match := range authChallengeParamRe.FindAllStringSubmatch(paramsStr, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	return params
+}
@@ -0,0 +1,90 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOciRegistryClientPullArtifactWithBearerToken(t *testing.T) {
+	blob := []byte("manifests-archive-content")
+	blobDigestBytes := sha256.Sum256(blob)
+	blobDigest := "sha256:" + hex.EncodeToString(blobDigestBytes[:])
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "robot" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:team/app-manifests:pull" {
+				t.Errorf("unexpected scope %s", r.URL.Query().Get("scope"))
+			}
+			w.Write([]byte(`{"token":"abc"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:team/app-manifests:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/team/app-manifests/manifests/1.2.3":
+			w.Write([]byte(testOciManifest(blobDigest)))
+		case "/v2/team/app-manifests/blobs/" + blobDigest:
+			w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewOciRegistryClient("unused", "robot", "secret")
+	client.BaseUrl = server.URL
+	destPath := filepath.Join(t.TempDir(), "app-manifests.tgz")
+	digest, manifestDigest, err := client.PullArtifact("team/app-manifests", "1.2.3", destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != blobDigest {
+		t.Fatalf("expected digest %s, got %s", blobDigest, digest)
+	}
+	if manifestDigest != testOciManifestDigest(blobDigest) {
+		t.Fatalf("expected manifest digest %s, got %s", testOciManifestDigest(blobDigest), manifestDigest)
+	}
+	pulled, err := os.ReadFile(destPath)
+	if err != nil || string(pulled) != string(blob) {
+		t.Fatalf("unexpected pulled content %q, err %v", pulled, err)
+	}
+}
+
+func testOciManifest(layerDigest string) string {
+	return `{"mediaType":"` + OciManifestMediaType + `","layers":[{"mediaType":"` + ManifestsMimeType + `","digest":"` + layerDigest + `","size":25}]}`
+}
+
+func testOciManifestDigest(layerDigest string) string {
+	digest := sha256.Sum256([]byte(testOciManifest(layerDigest)))
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
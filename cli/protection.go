@@ -0,0 +1,358 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relizaio/reliza-cd/utils"
+)
+
+const (
+	PendingDeletionPrefix      = "rlz-delete-"
+	ProtectAnnotation          = "reliza.io/protect"
+	ConfirmDeletionAnnotation  = "reliza.io/confirm-deletion"
+	defaultDeletionGraceLoops  = 3
+	defaultMaxDeletionsPerLoop = 5
+	pendingDeletionType        = "pending-deletion"
+	// absence records are keyed by deployment name, orphaned objects are keyed by orphanAbsencePrefix, kind, namespace and name,
+	// empty namespaces by namespaceAbsencePrefix and namespace name
+	deploymentAbsencePrefix = ""
+	orphanAbsencePrefix     = "orphan."
+	namespaceAbsencePrefix  = "namespace."
+)
+
+type DeletionProtectionConfig struct {
+	GraceLoops          int
+	GracePeriod         time.Duration
+	MaxDeletionsPerLoop int
+	ProtectedNamespaces map[string]bool
+}
+
+// deploymentAbsence tracks for how long a deployment with workspace directory has been missing from instance CycloneDX,
+// for how many garbage collection passes an orphaned object has been found or for how long a namespace has been empty.
+// Absences are persisted in pending deletion ConfigMaps, so that grace counters and deletion ids survive restarts.
+type deploymentAbsence struct {
+	Loops int
+	Since time.Time
+}
+
+var (
+	deletionProtectionConfig DeletionProtectionConfig
+	absentDeployments        = map[string]*deploymentAbsence{}
+	deletionsOnLoop          int
+	absencesLoaded           bool
+)
+
+func initDeletionProtectionConfig() {
+	deletionProtectionConfig.GraceLoops = parseIntEnv("DELETION_GRACE_LOOPS", defaultDeletionGraceLoops)
+	deletionProtectionConfig.GracePeriod = time.Duration(parseIntEnv("DELETION_GRACE_PERIOD", 0)) * time.Second
+	deletionProtectionConfig.MaxDeletionsPerLoop = parseIntEnv("MAX_DELETIONS_PER_LOOP", defaultMaxDeletionsPerLoop)
+	deletionProtectionConfig.ProtectedNamespaces = parseNamespaceList(os.Getenv("PROTECTED_NAMESPACES"))
+}
+
+func parseIntEnv(name string, defaultValue int) int {
+	if len(os.Getenv(name)) < 1 {
+		return defaultValue
+	}
+	parsedValue, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		sugar.Error("Failed to parse "+name+", using default: ", err)
+		return defaultValue
+	}
+	return parsedValue
+}
+
+// ResetDeletionBudget starts a new loop for MAX_DELETIONS_PER_LOOP, which is shared by deletions of obsolete deployments and orphans
+func ResetDeletionBudget() {
+	deletionsOnLoop = 0
+}
+
+// takeDeletionSlot returns false once MAX_DELETIONS_PER_LOOP deletions were made on the current loop
+func takeDeletionSlot(name string) bool {
+	if deletionProtectionConfig.MaxDeletionsPerLoop > 0 && deletionsOnLoop >= deletionProtectionConfig.MaxDeletionsPerLoop {
+		sugar.Warnw("Reached maximum number of deletions per loop, deferring deletion to next loops",
+			"name", name,
+			"maxDeletionsPerLoop", deletionProtectionConfig.MaxDeletionsPerLoop)
+		return false
+	}
+	deletionsOnLoop++
+	return true
+}
+
+// SelectDeploymentsForDeletion returns workspace deployments which may be deleted on this loop. existingDeployments maps
+// workspace deployment names to whether they are present in the current instance CycloneDX. An absent deployment is deleted
+// only once it was missing for DELETION_GRACE_LOOPS consecutive loops and DELETION_GRACE_PERIOD, it is not annotated with
+// reliza.io/protect and, in PROTECTED_NAMESPACES, deletion was confirmed. At most MAX_DELETIONS_PER_LOOP deployments are returned,
+// longest absent first.
+func SelectDeploymentsForDeletion(existingDeployments map[string]bool) []string {
+	if !loadAbsences() {
+		return nil
+	}
+	candidates := trackAbsences(existingDeployments, time.Now())
+	var selected []string
+	for _, name := range candidates {
+		namespace := getNamespaceFromDeploymentName(name)
+		cluster := recordedDeploymentCluster(name)
+		if isDeletionProtected(name, namespace, cluster) {
+			sugar.Warnw("Obsolete deployment is protected from deletion, skipping",
+				"deploymentName", name,
+				"namespace", namespace,
+				"cluster", cluster)
+			continue
+		}
+		if deletionProtectionConfig.ProtectedNamespaces[namespace] && !isDeletionConfirmed(name) {
+			continue
+		}
+		if !takeDeletionSlot(name) {
+			break
+		}
+		selected = append(selected, name)
+	}
+	return selected
+}
+
+// trackAbsences updates absence records from existingDeployments and returns absent deployments past the grace period, longest absent first
+func trackAbsences(existingDeployments map[string]bool, now time.Time) []string {
+	var candidates []string
+	absentNames := map[string]bool{}
+	for name, isPresent := range existingDeployments {
+		if isPresent {
+			clearAbsence(name)
+			continue
+		}
+		absentNames[name] = true
+		if trackAbsence(name, now) {
+			candidates = append(candidates, name)
+		} else {
+			sugar.Infow("Deployment is missing from instance, waiting for grace period before deletion",
+				"deploymentName", name,
+				"absentLoops", absentDeployments[name].Loops,
+				"absentSince", absentDeployments[name].Since.UTC().Format(time.RFC3339))
+		}
+	}
+	// names of deployments which are not tracked any more, i.e. deleted, are dropped
+	pruneAbsences(deploymentAbsencePrefix, absentNames)
+	sortByAbsence(candidates)
+	return candidates
+}
+
+// trackAbsence counts another loop for which the object identified by key is missing and returns true once it was missing
+// for DELETION_GRACE_LOOPS loops and DELETION_GRACE_PERIOD
+func trackAbsence(key string, now time.Time) bool {
+	absence, wasAbsent := absentDeployments[key]
+	if !wasAbsent {
+		absence = &deploymentAbsence{Since: now}
+		absentDeployments[key] = absence
+	}
+	absence.Loops++
+	persistAbsence(key, absence)
+	return absence.Loops >= deletionProtectionConfig.GraceLoops && now.Sub(absence.Since) >= deletionProtectionConfig.GracePeriod
+}
+
+// clearAbsence drops absence record of key, i.e. after the object returned or was deleted, together with its pending deletion
+func clearAbsence(key string) {
+	if _, wasAbsent := absentDeployments[key]; !wasAbsent {
+		return
+	}
+	delete(absentDeployments, key)
+	os.Remove(pendingDeletionPath(key))
+	dryRunShellout(KubectlApp + " delete configmap " + PendingDeletionPrefix + key + " -n " + SecretsNamespace + " --ignore-not-found")
+}
+
+func pendingDeletionPath(key string) string {
+	return "workspace/" + PendingDeletionPrefix + key + ".yaml"
+}
+
+// persistAbsence records absence of key in its pending deletion ConfigMap in the secrets namespace
+func persistAbsence(key string, absence *deploymentAbsence) {
+	pendingYamlPath := pendingDeletionPath(key)
+	pendingYamlFile := utils.CreateFile(pendingYamlPath)
+	err := ProducePendingDeletionYaml(pendingYamlFile, key, absence, SecretsNamespace)
+	pendingYamlFile.Close()
+	if err == nil {
+		err = KubectlApply(pendingYamlPath)
+	}
+	if err != nil {
+		sugar.Warnw("Failed to persist pending deletion, grace counters restart if reliza-cd restarts",
+			"name", key,
+			"error", err)
+	}
+}
+
+// loadAbsences restores absence records from pending deletion ConfigMaps once after start. Returns false if they could not
+// be read, in which case nothing is deleted, so that a restart during a transient error does not reset grace counters.
+func loadAbsences() bool {
+	if absencesLoaded {
+		return true
+	}
+	selector := "reliza.io/type=" + pendingDeletionType
+	if len(instanceId) > 0 {
+		selector += ",reliza.io/instance=" + instanceId
+	}
+	out, stderr, err := shellout(KubectlApp + " get configmap -l '" + selector + "' -n " + SecretsNamespace +
+		" -o jsonpath='{range .items[*]}{.data.name}{\"\\t\"}{.data.absentLoops}{\"\\t\"}{.data.absentSince}{\"\\n\"}{end}'")
+	if err != nil {
+		sugar.Errorw("Failed to read pending deletions, skipping deletions on this loop",
+			"stderr", stderr,
+			"error", err)
+		return false
+	}
+	for key, absence := range parsePendingDeletions(out) {
+		if _, tracked := absentDeployments[key]; !tracked {
+			absentDeployments[key] = absence
+		}
+	}
+	absencesLoaded = true
+	return true
+}
+
+// parsePendingDeletions parses tab-separated name, absent loops and absent since lines of pending deletion ConfigMaps
+func parsePendingDeletions(out string) map[string]*deploymentAbsence {
+	absences := map[string]*deploymentAbsence{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) < 3 || len(fields[0]) < 1 {
+			continue
+		}
+		loops, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		since, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			continue
+		}
+		absences[fields[0]] = &deploymentAbsence{Loops: loops, Since: since}
+	}
+	return absences
+}
+
+// pruneAbsences clears absence records of keys with prefix which were not seen on the current pass
+func pruneAbsences(prefix string, seenKeys map[string]bool) {
+	for key := range absentDeployments {
+		if absenceKeyPrefix(key) == prefix && !seenKeys[key] {
+			clearAbsence(key)
+		}
+	}
+}
+
+// absenceKeyPrefix returns prefix of absence key, deployment names have none as namespaces may not contain dots
+func absenceKeyPrefix(key string) string {
+	if strings.HasPrefix(key, orphanAbsencePrefix) {
+		return orphanAbsencePrefix
+	}
+	if strings.HasPrefix(key, namespaceAbsencePrefix) {
+		return namespaceAbsencePrefix
+	}
+	return deploymentAbsencePrefix
+}
+
+// sortByAbsence sorts keys longest absent first
+func sortByAbsence(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		since1 := absentDeployments[keys[i]].Since
+		since2 := absentDeployments[keys[j]].Since
+		if since1.Equal(since2) {
+			return keys[i] < keys[j]
+		}
+		return since1.Before(since2)
+	})
+}
+
+func getNamespaceFromDeploymentName(name string) string {
+	return strings.Split(name, "---")[0]
+}
+
+// isDeletionProtected returns true if the namespace in the target cluster or any reliza-managed object of the deployment
+// is annotated with reliza.io/protect: "true"
+func isDeletionProtected(name string, namespace string, cluster string) bool {
+	if isNamespaceProtected(namespace, cluster) {
+		return true
+	}
+	kinds := "secret,configmap"
+	if argoInfo.IsArgoEnabled {
+		kinds += ",application"
+	}
+	objProtect, _, _ := shellout(KubectlApp + " get " + kinds + " -l 'reliza.io/type=cdresource,reliza.io/name=" + name + "' -n " + SecretsNamespace + " -o jsonpath='{.items[*].metadata.annotations.reliza\\.io/protect}'")
+	for _, protect := range strings.Fields(objProtect) {
+		if strings.ToLower(protect) == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// isNamespaceProtected returns true if the namespace in the cluster is annotated with reliza.io/protect: "true"
+func isNamespaceProtected(namespace string, cluster string) bool {
+	nsProtect, _, _ := shellout(KubectlApp + " get namespace " + namespace + clusterFlags(cluster) + " --ignore-not-found -o jsonpath='{.metadata.annotations.reliza\\.io/protect}'")
+	return strings.ToLower(strings.TrimSpace(nsProtect)) == "true"
+}
+
+// isDeletionConfirmed checks whether pending deletion ConfigMap of the deployment, orphaned object or namespace identified by
+// absence key name was annotated with reliza.io/confirm-deletion matching the deletion id. Deletion id changes each time
+// the deployment goes missing, so confirmations of earlier absences do not apply.
+func isDeletionConfirmed(name string) bool {
+	deletionId := strconv.FormatInt(absentDeployments[name].Since.Unix(), 10)
+	pendingName := PendingDeletionPrefix + name
+	confirmedId, _, _ := shellout(KubectlApp + " get configmap " + pendingName + " -n " + SecretsNamespace + " -o jsonpath='{.metadata.annotations.reliza\\.io/confirm-deletion}'")
+	isConfirmed := strings.TrimSpace(confirmedId) == deletionId
+	if !isConfirmed {
+		sugar.Infow("Deletion in protected namespace is pending confirmation",
+			"name", name,
+			"deletionId", deletionId,
+			"confirmWith", KubectlApp+" annotate configmap "+pendingName+" -n "+SecretsNamespace+" --overwrite "+ConfirmDeletionAnnotation+"="+deletionId)
+	}
+	return isConfirmed
+}
+
+// ProducePendingDeletionYaml produces ConfigMap recording absence of the object identified by absence key name,
+// its deletion id is confirmed with reliza.io/confirm-deletion annotation in protected namespaces
+func ProducePendingDeletionYaml(w io.Writer, name string, absence *deploymentAbsence, namespace string) error {
+	pendingDeletion := k8sConfigMap{
+		ApiVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata: objectMetadata{
+			Name:      PendingDeletionPrefix + name,
+			Namespace: namespace,
+			Labels:    pendingDeletionLabels(),
+		},
+		Data: map[string]string{
+			"name":        name,
+			"deletionId":  strconv.FormatInt(absence.Since.Unix(), 10),
+			"absentLoops": strconv.Itoa(absence.Loops),
+			"absentSince": absence.Since.UTC().Format(time.RFC3339),
+		},
+	}
+	return writeYaml(w, pendingDeletion)
+}
+
+// pendingDeletionLabels label pending deletions apart from cdresource objects, so that garbage collection does not consider them
+func pendingDeletionLabels() map[string]string {
+	labels := map[string]string{
+		"reliza.io/type":       pendingDeletionType,
+		"reliza.io/managed-by": FieldManager,
+	}
+	if len(instanceId) > 0 {
+		labels["reliza.io/instance"] = instanceId
+	}
+	return labels
+}
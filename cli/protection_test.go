@@ -0,0 +1,116 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakePendingDeletions stubs tools with kubectl listing given pending deletion ConfigMap lines, absence state is reset
+// to be loaded from them
+func fakePendingDeletions(t *testing.T, pendingDeletions string) string {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	os.MkdirAll("workspace", 0700)
+	prevConfig := deletionProtectionConfig
+	absentDeployments = map[string]*deploymentAbsence{}
+	absencesLoaded = false
+	t.Cleanup(func() {
+		deletionProtectionConfig = prevConfig
+		absentDeployments = map[string]*deploymentAbsence{}
+		absencesLoaded = false
+	})
+	return fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *type=pending-deletion*) printf '" + pendingDeletions + "';; esac",
+	})
+}
+
+func TestTrackAbsences(t *testing.T) {
+	toolsPath := fakePendingDeletions(t, "")
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 2, GracePeriod: time.Minute}
+	start := time.Unix(1760000000, 0)
+
+	candidates := trackAbsences(map[string]bool{"prod---app": true, "dev---old": false}, start)
+	if len(candidates) != 0 {
+		t.Fatalf("expected no candidates on first absence, got %v", candidates)
+	}
+	candidates = trackAbsences(map[string]bool{"prod---app": true, "dev---old": false, "dev---older": false}, start.Add(30*time.Second))
+	if len(candidates) != 0 {
+		t.Fatalf("expected no candidates before grace period elapsed, got %v", candidates)
+	}
+	candidates = trackAbsences(map[string]bool{"prod---app": false, "dev---old": false, "dev---older": false}, start.Add(60*time.Second))
+	if !reflect.DeepEqual(candidates, []string{"dev---old"}) {
+		t.Fatalf("expected only dev---old past grace period, got %v", candidates)
+	}
+	// deployment returning to the instance resets its absence
+	trackAbsences(map[string]bool{"prod---app": true, "dev---old": false}, start.Add(100*time.Second))
+	if _, tracked := absentDeployments["prod---app"]; tracked {
+		t.Fatal("expected absence of returned deployment to be reset")
+	}
+	if _, tracked := absentDeployments["dev---older"]; tracked {
+		t.Fatal("expected absence of removed workspace deployment to be dropped")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl delete configmap "+PendingDeletionPrefix+"prod---app")) != 1 {
+		t.Fatal("expected pending deletion of returned deployment to be removed")
+	}
+	if len(fakeToolCalls(t, toolsPath, "kubectl apply", PendingDeletionPrefix+"dev---old.yaml")) != 4 {
+		t.Fatal("expected absence to be persisted on every loop")
+	}
+}
+
+func TestAbsencesSurviveRestart(t *testing.T) {
+	fakePendingDeletions(t, "dev---old\\t2\\t2025-10-09T08:53:20Z\\norphan.secret.reliza.dev---gone\\t1\\t2025-10-09T08:53:20Z\\n")
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 3}
+
+	selected := SelectDeploymentsForDeletion(map[string]bool{"dev---old": false, "prod---app": true})
+	if !reflect.DeepEqual(selected, []string{"dev---old"}) {
+		t.Fatalf("expected grace loops counted before restart to be kept, got %v", selected)
+	}
+	if absentDeployments["dev---old"].Since.Unix() != 1760000000 {
+		t.Fatal("expected deletion id of absence before restart to be kept")
+	}
+	if _, tracked := absentDeployments["orphan.secret.reliza.dev---gone"]; !tracked {
+		t.Fatal("expected orphan absence to be restored")
+	}
+}
+
+func TestNoDeletionsWhenAbsencesCannotBeLoaded(t *testing.T) {
+	fakePendingDeletions(t, "")
+	fakeTools(t, map[string]string{"kubectl": "exit 1"})
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 1}
+
+	if selected := SelectDeploymentsForDeletion(map[string]bool{"dev---old": false}); len(selected) != 0 {
+		t.Fatalf("expected no deletions without restored absences, got %v", selected)
+	}
+	if len(absentDeployments) != 0 {
+		t.Fatal("expected absences not to be tracked without restored absences")
+	}
+}
+
+func TestDeletionProtectionIsCheckedInTargetCluster(t *testing.T) {
+	toolsPath := fakePendingDeletions(t, "")
+	deletionProtectionConfig = DeletionProtectionConfig{GraceLoops: 1}
+	os.MkdirAll("workspace/eu---app", 0700)
+	os.WriteFile("workspace/eu---app/"+RecordedDeloyedData, []byte(`{"Name":"eu---app","Namespace":"eu","Cluster":"eu-prod"}`), 0600)
+
+	SelectDeploymentsForDeletion(map[string]bool{"eu---app": false})
+	if len(fakeToolCalls(t, toolsPath, "kubectl get namespace eu --kubeconfig clusters/eu-prod.kubeconfig")) != 1 {
+		t.Fatal("expected namespace protection to be checked in the cluster recorded for the deployment")
+	}
+}
@@ -0,0 +1,129 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RegistryTypeOci  = "oci"
+	RegistryTypeHttp = "http"
+)
+
+type RegistryConfig struct {
+	Registries []RegistryConfigEntry `yaml:"registries"`
+}
+
+// RegistryConfigEntry configures charts whose uri (without scheme) matches Match regular expression
+type RegistryConfigEntry struct {
+	Match             string           `yaml:"match"`
+	Type              string           `yaml:"type"`
+	CredentialsSecret string           `yaml:"credentialsSecret"`
+	SecretBackend     string           `yaml:"secretBackend"`
+	Mirrors           []RegistryMirror `yaml:"mirrors"`
+	matchRe           *regexp.Regexp
+}
+
+type RegistryMirror struct {
+	Uri               string `yaml:"uri"`
+	Type              string `yaml:"type"`
+	CredentialsSecret string `yaml:"credentialsSecret"`
+}
+
+var registryConfig RegistryConfig
+
+func initRegistryConfig() {
+	registryConfigFile := os.Getenv("REGISTRY_CONFIG_FILE")
+	if len(registryConfigFile) < 1 {
+		return
+	}
+	registryConfigBytes, err := os.ReadFile(registryConfigFile)
+	if err != nil {
+		sugar.Error("Failed to read REGISTRY_CONFIG_FILE: ", err)
+		return
+	}
+	parsedConfig, err := parseRegistryConfig(registryConfigBytes)
+	if err != nil {
+		sugar.Error("Failed to parse REGISTRY_CONFIG_FILE: ", err)
+		return
+	}
+	registryConfig = parsedConfig
+	sugar.Info("Loaded registry configuration with ", len(registryConfig.Registries), " entries")
+}
+
+func parseRegistryConfig(registryConfigBytes []byte) (RegistryConfig, error) {
+	var parsedConfig RegistryConfig
+	err := yaml.Unmarshal(registryConfigBytes, &parsedConfig)
+	if err != nil {
+		return parsedConfig, err
+	}
+	for i := range parsedConfig.Registries {
+		parsedConfig.Registries[i].matchRe, err = regexp.Compile(parsedConfig.Registries[i].Match)
+		if err != nil {
+			return parsedConfig, err
+		}
+		registryBackend := strings.ToLower(parsedConfig.Registries[i].SecretBackend)
+		if registryBackend != "" && registryBackend != SecretBackendSealed && registryBackend != SecretBackendExternalSecrets {
+			return parsedConfig, errors.New("unsupported secretBackend " + registryBackend + " for registry " + parsedConfig.Registries[i].Match +
+				", only " + SecretBackendSealed + " and " + SecretBackendExternalSecrets + " may be set per registry")
+		}
+		parsedConfig.Registries[i].SecretBackend = registryBackend
+	}
+	return parsedConfig, nil
+}
+
+// matchRegistryConfig returns first registry configuration entry matching artUri
+// and the remainder of the uri (without scheme) following the matched part
+func matchRegistryConfig(artUri string) (*RegistryConfigEntry, string) {
+	artUriNoScheme := stripUriScheme(artUri)
+	for i, entry := range registryConfig.Registries {
+		matchIndex := entry.matchRe.FindStringIndex(artUriNoScheme)
+		if matchIndex != nil {
+			return &registryConfig.Registries[i], strings.TrimPrefix(artUriNoScheme[matchIndex[1]:], "/")
+		}
+	}
+	return nil, ""
+}
+
+// resolveMirrorRepoInfos produces repo info for each mirror of the registry entry,
+// mirror uri replaces everything up to and including the matched part of the chart uri
+func resolveMirrorRepoInfos(uriRemainder string, chartName string, entry *RegistryConfigEntry) []HelmRepoInfo {
+	var mirrorInfos []HelmRepoInfo
+	for _, mirror := range entry.Mirrors {
+		mirrorUri := strings.TrimSuffix(mirror.Uri, "/") + "/" + uriRemainder
+		mirrorInfo := resolveHelmRepoInfo(mirrorUri, chartName, mirror.Type)
+		mirrorInfo.CredentialsSecret = mirror.CredentialsSecret
+		mirrorInfos = append(mirrorInfos, mirrorInfo)
+	}
+	return mirrorInfos
+}
+
+// resolveMirrorAuth resolves credentials for a mirror from its credentials secret, mirrors without one are accessed anonymously
+func resolveMirrorAuth(mirrorInfo HelmRepoInfo) ProjectAuth {
+	var mirrorPa ProjectAuth
+	if len(mirrorInfo.CredentialsSecret) > 0 {
+		mirrorPa = ResolveHelmAuthSecret(mirrorInfo.CredentialsSecret)
+	} else {
+		mirrorPa.Type = "NOCREDS"
+	}
+	return mirrorPa
+}
@@ -0,0 +1,77 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"testing"
+)
+
+func TestRegistryConfigMirrorFallback(t *testing.T) {
+	parsedConfig, err := parseRegistryConfig([]byte(`
+registries:
+  - match: "^registry\\.example\\.com/charts"
+    type: http
+    credentialsSecret: example-creds
+    mirrors:
+      - uri: oci://mirror.svc:5000/charts
+      - uri: backup.example.com/helm
+        type: http
+        credentialsSecret: backup-creds
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registryConfig = parsedConfig
+	defer func() { registryConfig = RegistryConfig{} }()
+
+	rd := RelizaDeployment{ArtUri: "https://registry.example.com/charts/app"}
+	helmRepoInfo := GetHelmRepoInfoFromDeployment(&rd)
+	if helmRepoInfo.UseOci || helmRepoInfo.RepoUri != "https://registry.example.com/charts" || helmRepoInfo.CredentialsSecret != "example-creds" {
+		t.Fatalf("unexpected helm repo info %+v", helmRepoInfo)
+	}
+	if len(helmRepoInfo.Mirrors) != 2 {
+		t.Fatalf("expected 2 mirrors, got %d", len(helmRepoInfo.Mirrors))
+	}
+	ociMirror := helmRepoInfo.Mirrors[0]
+	if !ociMirror.UseOci || ociMirror.OciUri != "oci://mirror.svc:5000/charts/app" || ociMirror.CredentialsSecret != "" {
+		t.Errorf("unexpected oci mirror %+v", ociMirror)
+	}
+	httpMirror := helmRepoInfo.Mirrors[1]
+	if httpMirror.UseOci || httpMirror.RepoUri != "https://backup.example.com/helm" || httpMirror.CredentialsSecret != "backup-creds" {
+		t.Errorf("unexpected http mirror %+v", httpMirror)
+	}
+}
+
+func TestRegistryConfigForcedType(t *testing.T) {
+	parsedConfig, err := parseRegistryConfig([]byte(`{"registries": [{"match": "^harbor\\.internal/", "type": "oci"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registryConfig = parsedConfig
+	defer func() { registryConfig = RegistryConfig{} }()
+
+	rd := RelizaDeployment{ArtUri: "harbor.internal/project/app"}
+	helmRepoInfo := GetHelmRepoInfoFromDeployment(&rd)
+	if !helmRepoInfo.UseOci || helmRepoInfo.OciUri != "oci://harbor.internal/project/app" {
+		t.Fatalf("unexpected helm repo info %+v", helmRepoInfo)
+	}
+
+	rd.ArtUri = "other.internal/project/app"
+	helmRepoInfo = GetHelmRepoInfoFromDeployment(&rd)
+	if helmRepoInfo.UseOci || len(helmRepoInfo.Mirrors) > 0 {
+		t.Fatalf("unexpected helm repo info for unmatched uri %+v", helmRepoInfo)
+	}
+}
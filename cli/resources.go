@@ -0,0 +1,297 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"encoding/base64"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FieldManager = "reliza-cd"
+)
+
+var (
+	forceApplyConflicts bool
+	instanceId          string
+)
+
+func initApplyConfig() {
+	forceApplyConflicts = strings.ToLower(os.Getenv("APPLY_FORCE_CONFLICTS")) == "true"
+	// instance api key ids are in form INSTANCE__<instance uuid>
+	instanceId = strings.TrimPrefix(os.Getenv("APIKEYID"), "INSTANCE__")
+}
+
+// KubectlApply server-side applies objects from path with reliza-cd field manager. Conflicts with fields owned by other managers
+// are reported and fail the apply, unless APPLY_FORCE_CONFLICTS is true, in which case reliza-cd takes ownership of them.
+func KubectlApply(path string) error {
+	return KubectlApplyWithFlags(path, "")
+}
+
+// KubectlApplyWithFlags server-side applies objects from path passing extra kubectl flags, i.e. ClusterFlags of the target cluster
+func KubectlApplyWithFlags(path string, extraFlags string) error {
+	applyCmd := KubectlApp + " apply --server-side --field-manager=" + FieldManager + extraFlags + " -f " + path
+	_, stderr, err := dryRunShellout(applyCmd)
+	if err != nil && isApplyConflict(stderr) {
+		sugar.Warnw("Server-side apply conflicts with fields owned by other field managers",
+			"path", path,
+			"conflicts", strings.TrimSpace(stderr),
+			"forceConflicts", forceApplyConflicts)
+		if forceApplyConflicts {
+			_, _, err = dryRunShellout(applyCmd + " --force-conflicts")
+		}
+	}
+	return err
+}
+
+func isApplyConflict(stderr string) bool {
+	return strings.Contains(stderr, "Apply failed with") && strings.Contains(stderr, "conflict")
+}
+
+// Minimal typed representations of Kubernetes objects produced by reliza-cd, marshalled to yaml and applied with kubectl
+
+type objectMetadata struct {
+	Name        string            `yaml:"name,omitempty"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Finalizers  []string          `yaml:"finalizers,omitempty"`
+}
+
+type k8sSecret struct {
+	ApiVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   objectMetadata    `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data,omitempty"`
+}
+
+type k8sConfigMap struct {
+	ApiVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   objectMetadata    `yaml:"metadata"`
+	Data       map[string]string `yaml:"data,omitempty"`
+}
+
+type k8sNamespace struct {
+	ApiVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   objectMetadata `yaml:"metadata"`
+}
+
+// k8sSpecObject represents objects whose spec is passed through from configuration as is, i.e. ResourceQuota and LimitRange
+type k8sSpecObject struct {
+	ApiVersion string                 `yaml:"apiVersion"`
+	Kind       string                 `yaml:"kind"`
+	Metadata   objectMetadata         `yaml:"metadata"`
+	Spec       map[string]interface{} `yaml:"spec"`
+}
+
+type sealedSecretTemplate struct {
+	Data     map[string]string `yaml:"data,omitempty"`
+	Metadata objectMetadata    `yaml:"metadata"`
+}
+
+type sealedSecretSpec struct {
+	EncryptedData map[string]string    `yaml:"encryptedData"`
+	Template      sealedSecretTemplate `yaml:"template"`
+}
+
+type sealedSecret struct {
+	ApiVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   objectMetadata   `yaml:"metadata"`
+	Spec       sealedSecretSpec `yaml:"spec"`
+}
+
+type argoSyncAutomated struct {
+	Prune    bool `yaml:"prune,omitempty"`
+	SelfHeal bool `yaml:"selfHeal,omitempty"`
+}
+
+type argoSyncPolicy struct {
+	Automated   *argoSyncAutomated     `yaml:"automated,omitempty"`
+	SyncOptions []string               `yaml:"syncOptions,omitempty"`
+	Retry       map[string]interface{} `yaml:"retry,omitempty"`
+}
+
+type argoDestination struct {
+	Namespace string `yaml:"namespace"`
+	Server    string `yaml:"server,omitempty"`
+	Name      string `yaml:"name,omitempty"`
+}
+
+type argoHelmSource struct {
+	Values string `yaml:"values"`
+}
+
+type argoApplicationSource struct {
+	Chart          string         `yaml:"chart"`
+	Helm           argoHelmSource `yaml:"helm"`
+	RepoURL        string         `yaml:"repoURL"`
+	TargetRevision string         `yaml:"targetRevision"`
+}
+
+type argoApplicationSpec struct {
+	SyncPolicy        argoSyncPolicy           `yaml:"syncPolicy"`
+	Destination       argoDestination          `yaml:"destination"`
+	Project           string                   `yaml:"project"`
+	Source            argoApplicationSource    `yaml:"source"`
+	IgnoreDifferences []map[string]interface{} `yaml:"ignoreDifferences,omitempty"`
+}
+
+type argoProjectDestination struct {
+	Namespace string `yaml:"namespace"`
+	Server    string `yaml:"server,omitempty"`
+	Name      string `yaml:"name,omitempty"`
+}
+
+type argoGroupKind struct {
+	Group string `yaml:"group"`
+	Kind  string `yaml:"kind"`
+}
+
+type argoAppProjectSpec struct {
+	Description              string                   `yaml:"description,omitempty"`
+	SourceRepos              []string                 `yaml:"sourceRepos"`
+	Destinations             []argoProjectDestination `yaml:"destinations"`
+	ClusterResourceWhitelist []argoGroupKind          `yaml:"clusterResourceWhitelist,omitempty"`
+}
+
+type argoAppProject struct {
+	ApiVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   objectMetadata     `yaml:"metadata"`
+	Spec       argoAppProjectSpec `yaml:"spec"`
+}
+
+type argoApplicationTemplate struct {
+	Metadata objectMetadata      `yaml:"metadata"`
+	Spec     argoApplicationSpec `yaml:"spec"`
+}
+
+type argoListGenerator struct {
+	Elements []ApplicationSetElement `yaml:"elements"`
+}
+
+type argoGenerator struct {
+	List argoListGenerator `yaml:"list"`
+}
+
+type argoApplicationSetSyncPolicy struct {
+	PreserveResourcesOnDeletion bool `yaml:"preserveResourcesOnDeletion"`
+}
+
+type argoApplicationSetSpec struct {
+	GoTemplate        bool                         `yaml:"goTemplate"`
+	GoTemplateOptions []string                     `yaml:"goTemplateOptions,omitempty"`
+	Generators        []argoGenerator              `yaml:"generators"`
+	Template          argoApplicationTemplate      `yaml:"template"`
+	TemplatePatch     string                       `yaml:"templatePatch,omitempty"`
+	SyncPolicy        argoApplicationSetSyncPolicy `yaml:"syncPolicy"`
+}
+
+type argoApplicationSet struct {
+	ApiVersion string                 `yaml:"apiVersion"`
+	Kind       string                 `yaml:"kind"`
+	Metadata   objectMetadata         `yaml:"metadata"`
+	Spec       argoApplicationSetSpec `yaml:"spec"`
+}
+
+type argoApplication struct {
+	ApiVersion string              `yaml:"apiVersion"`
+	Kind       string              `yaml:"kind"`
+	Metadata   objectMetadata      `yaml:"metadata"`
+	Spec       argoApplicationSpec `yaml:"spec"`
+}
+
+func writeYaml(w io.Writer, obj interface{}) error {
+	return writeYamlDocuments(w, obj)
+}
+
+// writeYamlDocuments writes objs as a multi-document yaml stream
+func writeYamlDocuments(w io.Writer, objs ...interface{}) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	var err error
+	for _, obj := range objs {
+		err = encoder.Encode(obj)
+		if err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// cdResourceLabels returns ownership labels of reliza-managed objects, name is the name of the deployment or of its auxiliary object
+func cdResourceLabels(name string) map[string]string {
+	labels := map[string]string{
+		"reliza.io/type":       "cdresource",
+		"reliza.io/name":       name,
+		"reliza.io/managed-by": FieldManager,
+	}
+	if len(instanceId) > 0 {
+		labels["reliza.io/instance"] = instanceId
+	}
+	return labels
+}
+
+// cdResourceAnnotations returns bundle and version of rd, which may not be valid label values
+func cdResourceAnnotations(rd *RelizaDeployment) map[string]string {
+	return map[string]string{
+		"reliza.io/bundle":  rd.Bundle,
+		"reliza.io/version": rd.ArtVersion,
+	}
+}
+
+// repositorySecretData returns plain data of Argo CD helm repository secret for rd
+func repositorySecretData(rd *RelizaDeployment, helmInfo HelmRepoInfo) map[string]string {
+	url := helmInfo.RepoUri
+	if helmInfo.UseOci {
+		url = helmInfo.RepoHost
+	}
+	return map[string]string{
+		"type":      "helm",
+		"url":       url,
+		"name":      rd.Name,
+		"enableOCI": strconv.FormatBool(helmInfo.UseOci),
+	}
+}
+
+func base64Data(data map[string]string) map[string]string {
+	encodedData := make(map[string]string, len(data))
+	for key, value := range data {
+		encodedData[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return encodedData
+}
+
+// sealedCredentialsData returns encrypted data of a sealed secret, omitting credentials not provided by the Hub
+func sealedCredentialsData(projAuth ProjectAuth) map[string]string {
+	encryptedData := make(map[string]string)
+	if len(projAuth.Login) > 0 {
+		encryptedData["username"] = projAuth.Login
+	}
+	if len(projAuth.Password) > 0 {
+		encryptedData["password"] = projAuth.Password
+	}
+	return encryptedData
+}
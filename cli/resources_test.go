@@ -0,0 +1,182 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func assertGolden(t *testing.T, goldenFile string, actual []byte) {
+	t.Helper()
+	goldenPath := filepath.Join("testdata", goldenFile)
+	if *updateGolden {
+		err := os.WriteFile(goldenPath, actual, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("%s does not match, got:\n%s", goldenPath, actual)
+	}
+}
+
+func testResourceDeployment() (RelizaDeployment, ProjectAuth, HelmRepoInfo) {
+	rd := RelizaDeployment{
+		Name:       "prod---my-app",
+		Namespace:  "prod",
+		Bundle:     "My Bundle",
+		ArtUri:     "registry.example.com/charts/my-app",
+		ArtVersion: "1.2.3",
+	}
+	// credentials with characters that need quoting in yaml
+	projAuth := ProjectAuth{Login: "robot$ci", Password: "p@ss: \"word\"\n#1", Type: "CREDS"}
+	helmInfo := HelmRepoInfo{
+		ChartName: "my-app",
+		RepoUri:   "oci://registry.example.com/charts",
+		RepoHost:  "registry.example.com/charts",
+		UseOci:    true,
+		OciUri:    "oci://registry.example.com/charts/my-app",
+	}
+	return rd, projAuth, helmInfo
+}
+
+func TestProduceSecretYamlGolden(t *testing.T) {
+	rd, projAuth, helmInfo := testResourceDeployment()
+	var secretYaml bytes.Buffer
+	err := ProduceSecretYaml(&secretYaml, &rd, projAuth, "argocd", helmInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "sealed-secret.yaml", secretYaml.Bytes())
+}
+
+func TestProducePlainSecretYamlGolden(t *testing.T) {
+	rd, projAuth, helmInfo := testResourceDeployment()
+	var secretYaml bytes.Buffer
+	err := ProducePlainSecretYaml(&secretYaml, &rd, projAuth, "argocd", helmInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "plain-secret.yaml", secretYaml.Bytes())
+}
+
+func TestProduceNoCredSecretYamlGolden(t *testing.T) {
+	rd, _, helmInfo := testResourceDeployment()
+	helmInfo.UseOci = false
+	helmInfo.RepoUri = "https://charts.example.com/stable"
+	var secretYaml bytes.Buffer
+	err := ProduceNoCredSecretYaml(&secretYaml, &rd, ProjectAuth{Type: "NOCREDS"}, "argocd", helmInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "nocred-secret.yaml", secretYaml.Bytes())
+}
+
+func TestProduceRegistryCredentialsSecretYamlGolden(t *testing.T) {
+	rd, projAuth, _ := testResourceDeployment()
+	rd.ArtUri = "123456789012.dkr.ecr.us-east-1.amazonaws.com/my-app"
+	var secretYaml bytes.Buffer
+	err := ProduceRegistryCredentialsSecretYaml(&secretYaml, &rd, projAuth, "argocd", "ecr-"+rd.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "registry-credentials-secret.yaml", secretYaml.Bytes())
+}
+
+func TestProduceArgoApplicationYamlGolden(t *testing.T) {
+	rd, _, _ := testResourceDeployment()
+	rd.ArtUri = "oci://registry.example.com/charts/my-app"
+	groupPath := t.TempDir() + "/"
+	err := os.WriteFile(groupPath+InstallValues, []byte("replicaCount: 2\nimage:\n  tag: \"1.2.3\"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applicationYaml bytes.Buffer
+	err = ProduceArgoApplicationYaml(&applicationYaml, &rd, "argocd", groupPath, ArgoApplicationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "argo-application.yaml", applicationYaml.Bytes())
+}
+
+func TestProducePendingChangeYamlGolden(t *testing.T) {
+	rd, _, _ := testResourceDeployment()
+	var pendingYaml bytes.Buffer
+	err := ProducePendingChangeYaml(&pendingYaml, &rd, "0123456789abcdef", "- path: image.tag\n  change: changed\n  old: 1.2.2\n  new: 1.2.3\n", "argocd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "pending-change.yaml", pendingYaml.Bytes())
+}
+
+func TestProducePendingDeletionYamlGolden(t *testing.T) {
+	rd, _, _ := testResourceDeployment()
+	var pendingYaml bytes.Buffer
+	err := ProducePendingDeletionYaml(&pendingYaml, rd.Name, &deploymentAbsence{Loops: 2, Since: time.Unix(1760000000, 0)}, "argocd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "pending-deletion.yaml", pendingYaml.Bytes())
+}
+
+func TestIsApplyConflict(t *testing.T) {
+	conflictStderr := `error: Apply failed with 1 conflict: conflict with "kubectl-client-side-apply" using v1: .data.password
+Please review the fields above--they currently have other managers.`
+	if !isApplyConflict(conflictStderr) {
+		t.Error("expected conflict to be detected")
+	}
+	if isApplyConflict(`error: unable to recognize "secret.yaml": no matches for kind "SealedSecret"`) {
+		t.Error("expected non-conflict error not to be detected as conflict")
+	}
+}
+
+func TestKubectlApplyConflicts(t *testing.T) {
+	toolsPath := fakeTools(t, map[string]string{
+		"kubectl": "case \"$*\" in *--force-conflicts*) exit 0;; esac\n" +
+			"echo 'error: Apply failed with 1 conflict: conflict with \"kubectl-edit\"' >&2; exit 1",
+	})
+	prevForce := forceApplyConflicts
+	t.Cleanup(func() { forceApplyConflicts = prevForce })
+
+	t.Setenv("APPLY_FORCE_CONFLICTS", "")
+	initApplyConfig()
+	if err := KubectlApply("secret.yaml"); err == nil {
+		t.Fatal("expected conflict to fail the apply by default")
+	}
+	if len(fakeToolCalls(t, toolsPath, "--force-conflicts")) != 0 {
+		t.Fatal("expected conflicts not to be forced by default")
+	}
+
+	t.Setenv("APPLY_FORCE_CONFLICTS", "true")
+	initApplyConfig()
+	if err := KubectlApply("secret.yaml"); err != nil {
+		t.Fatalf("expected forced apply to succeed, got %v", err)
+	}
+	if len(fakeToolCalls(t, toolsPath, "--force-conflicts")) != 1 {
+		t.Fatal("expected conflicts to be forced when APPLY_FORCE_CONFLICTS is true")
+	}
+}
@@ -0,0 +1,112 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sealedCertPath = "workspace/sealedCert.pem"
+)
+
+var (
+	sealedCertCheckInterval time.Duration
+	lastSealedCertCheck     time.Time
+)
+
+func initSealedCertCheckConfig() {
+	sealedCertCheckInterval = time.Hour
+	if len(os.Getenv("SEALED_CERT_CHECK_INTERVAL")) > 0 {
+		intervalSeconds, err := strconv.Atoi(os.Getenv("SEALED_CERT_CHECK_INTERVAL"))
+		if err != nil {
+			sugar.Error("Failed to parse SEALED_CERT_CHECK_INTERVAL, using default: ", err)
+		} else {
+			sealedCertCheckInterval = time.Duration(intervalSeconds) * time.Second
+		}
+	}
+}
+
+// IsSealedCertCheckDue returns true when sealing certificate should be re-fetched to detect key rotation of the Sealed Secrets controller
+func IsSealedCertCheckDue() bool {
+	return IsSecretBackendUsed(SecretBackendSealed) && time.Since(lastSealedCertCheck) >= sealedCertCheckInterval
+}
+
+// CheckSealedCertRotation re-fetches sealing certificate and, if the controller rotated its key, publishes the new certificate
+// to the Hub and re-encrypts all reliza-managed SealedSecrets with the active key. Returns true if rotation was detected.
+func CheckSealedCertRotation() bool {
+	cert := GetSealedCert()
+	if len(cert) < 1 {
+		sugar.Warn("Failed to fetch sealed cert for key rotation check")
+		return false
+	}
+	return PublishSealedCert(cert)
+}
+
+// PublishSealedCert publishes sealing certificate to the Hub. If a different certificate was published before, i.e. the key
+// was rotated while reliza-cd was not running, managed SealedSecrets are re-encrypted with the active key. Returns true if rotation was detected.
+func PublishSealedCert(cert string) bool {
+	lastSealedCertCheck = time.Now()
+	publishedCert, err := os.ReadFile(sealedCertPath)
+	if err != nil {
+		SetSealedCertificateOnTheHub(cert)
+		return false
+	}
+	if string(publishedCert) == cert {
+		return false
+	}
+	sugar.Info("Sealed Secrets key rotation detected, re-publishing sealed cert and re-encrypting managed sealed secrets")
+	SetSealedCertificateOnTheHub(cert)
+	ReencryptManagedSealedSecrets()
+	return true
+}
+
+// ReencryptManagedSealedSecrets re-encrypts SealedSecrets created by reliza-cd with the currently active key of the Sealed Secrets controller
+func ReencryptManagedSealedSecrets() {
+	names, _, err := shellout(KubectlApp + " get sealedsecret -l 'reliza.io/type=cdresource' -n " + SecretsNamespace + " -o jsonpath='{.items[*].metadata.name}'")
+	if err != nil {
+		return
+	}
+	for _, name := range strings.Fields(names) {
+		err := reencryptSealedSecret(name)
+		if err != nil {
+			sugar.Errorw("Failed to re-encrypt sealed secret",
+				"name", name,
+				"namespace", SecretsNamespace,
+				"error", err)
+		}
+	}
+}
+
+// reencryptSealedSecret re-encrypts SealedSecret name and server-side applies it, the re-encrypted object is kept in a
+// temporary file only holding encrypted data
+func reencryptSealedSecret(name string) error {
+	reencryptedFile, err := os.CreateTemp("", "sealedsecret-*.yaml")
+	if err != nil {
+		return err
+	}
+	reencryptedFile.Close()
+	defer os.Remove(reencryptedFile.Name())
+	_, stderr, err := shellout(KubectlApp + " get sealedsecret " + name + " -n " + SecretsNamespace + " -o yaml | " + KubesealApp + " --re-encrypt -o yaml > " + reencryptedFile.Name())
+	if err != nil {
+		return errors.New("re-encryption failed: " + strings.TrimSpace(stderr))
+	}
+	return KubectlApply(reencryptedFile.Name())
+}
@@ -0,0 +1,93 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func fakeSealedCert(t *testing.T, cert string) string {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("workspace", 0700); err != nil {
+		t.Fatal(err)
+	}
+	return fakeTools(t, map[string]string{
+		"kubeseal": "echo -n " + cert,
+		"kubectl":  "echo -n 'app-creds'",
+	})
+}
+
+func TestSealedCertCheckIsDueOnStartup(t *testing.T) {
+	prevBackend, prevCheck := secretBackend, lastSealedCertCheck
+	t.Cleanup(func() { secretBackend, lastSealedCertCheck = prevBackend, prevCheck })
+	secretBackend = SecretBackendSealed
+	lastSealedCertCheck = time.Time{}
+	initSealedCertCheckConfig()
+	if !IsSealedCertCheckDue() {
+		t.Fatal("expected sealed cert check to be due on startup")
+	}
+	fakeSealedCert(t, "cert-a")
+	CheckSealedCertRotation()
+	if IsSealedCertCheckDue() {
+		t.Fatal("expected sealed cert check not to be due right after the check")
+	}
+}
+
+func TestSealedCertRotation(t *testing.T) {
+	dir := fakeSealedCert(t, "cert-b")
+
+	// first publication, nothing to re-encrypt
+	if PublishSealedCert("cert-a") {
+		t.Fatal("expected first publication not to be reported as rotation")
+	}
+	if len(fakeToolCalls(t, dir, "setsecretcert --cert cert-a")) != 1 {
+		t.Fatal("expected sealed cert to be published to the Hub")
+	}
+	if CheckSealedCertRotation() != true {
+		t.Fatal("expected rotation to be detected")
+	}
+	// fetched cert is base64 encoded by GetSealedCert
+	if len(fakeToolCalls(t, dir, "setsecretcert --cert Y2VydC1i")) != 1 {
+		t.Fatal("expected rotated sealed cert to be published to the Hub")
+	}
+	if len(fakeToolCalls(t, dir, "get sealedsecret app-creds")) != 1 {
+		t.Fatal("expected managed sealed secret to be re-encrypted")
+	}
+	if len(fakeToolCalls(t, dir, "kubectl apply --server-side --field-manager=reliza-cd -f", "sealedsecret-")) != 1 {
+		t.Fatal("expected re-encrypted sealed secret to be server-side applied")
+	}
+	if CheckSealedCertRotation() {
+		t.Fatal("expected no rotation when sealed cert is unchanged")
+	}
+}
+
+func TestSealedCertRotatedWhileStopped(t *testing.T) {
+	dir := fakeSealedCert(t, "cert-b")
+	if err := os.WriteFile(sealedCertPath, []byte("cert-a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// startup publication of the current cert re-encrypts secrets sealed with the previous key
+	if !PublishSealedCert("cert-b") {
+		t.Fatal("expected rotation to be detected on startup")
+	}
+	if len(fakeToolCalls(t, dir, "get sealedsecret app-creds")) != 1 {
+		t.Fatal("expected managed sealed secret to be re-encrypted")
+	}
+}
@@ -0,0 +1,187 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SecretBackendSealed          = "sealed"
+	SecretBackendExternalSecrets = "external-secrets"
+	SecretBackendLocal           = "local"
+)
+
+type ExternalSecretsConfig struct {
+	StoreName       string
+	StoreKind       string
+	KeyPrefix       string
+	RefreshInterval string
+}
+
+var (
+	secretBackend          string
+	externalSecretsConfig  ExternalSecretsConfig
+	secretWaitTimeout      time.Duration
+	secretWaitPollInterval = time.Second
+)
+
+func initSecretBackendConfig() {
+	secretBackend = strings.ToLower(os.Getenv("SECRET_BACKEND"))
+	if len(secretBackend) < 1 {
+		secretBackend = SecretBackendSealed
+	}
+	secretWaitTimeout = time.Duration(parseIntEnv("SECRET_WAIT_TIMEOUT", 120)) * time.Second
+	externalSecretsConfig.StoreName = os.Getenv("EXTERNAL_SECRETS_STORE")
+	externalSecretsConfig.StoreKind = os.Getenv("EXTERNAL_SECRETS_STORE_KIND")
+	if len(externalSecretsConfig.StoreKind) < 1 {
+		externalSecretsConfig.StoreKind = "ClusterSecretStore"
+	}
+	externalSecretsConfig.KeyPrefix = os.Getenv("EXTERNAL_SECRETS_KEY_PREFIX")
+	if len(externalSecretsConfig.KeyPrefix) < 1 {
+		externalSecretsConfig.KeyPrefix = "reliza-cd/"
+	}
+	externalSecretsConfig.RefreshInterval = os.Getenv("EXTERNAL_SECRETS_REFRESH_INTERVAL")
+	if len(externalSecretsConfig.RefreshInterval) < 1 {
+		externalSecretsConfig.RefreshInterval = "1h"
+	}
+	if IsSecretBackendUsed(SecretBackendExternalSecrets) && len(externalSecretsConfig.StoreName) < 1 {
+		sugar.Error(SecretBackendExternalSecrets + " secret backend is used but EXTERNAL_SECRETS_STORE is not set")
+	}
+	if secretBackend == SecretBackendLocal && EnvMode != StandaloneMode {
+		sugar.Error("Local secret backend is only supported in " + StandaloneMode + " mode, since Argo CD requires repository secrets, falling back to " + SecretBackendSealed)
+		secretBackend = SecretBackendSealed
+	}
+	if secretBackend == SecretBackendLocal {
+		initLocalStore()
+	}
+	sugar.Info("Using " + secretBackend + " secret backend for repository credentials")
+}
+
+// ResolveSecretBackend returns secret backend used for repository credentials of the registry of helmInfo,
+// which is SECRET_BACKEND unless overridden for the registry with secretBackend in registry configuration
+func ResolveSecretBackend(helmInfo HelmRepoInfo) string {
+	if len(helmInfo.SecretBackend) > 0 && secretBackend != SecretBackendLocal {
+		return helmInfo.SecretBackend
+	}
+	return secretBackend
+}
+
+// IsSecretBackendUsed returns true if backend is SECRET_BACKEND or is configured for any registry in registry configuration
+func IsSecretBackendUsed(backend string) bool {
+	if secretBackend == backend {
+		return true
+	}
+	for _, entry := range registryConfig.Registries {
+		if entry.SecretBackend == backend && secretBackend != SecretBackendLocal {
+			return true
+		}
+	}
+	return false
+}
+
+type externalSecretStoreRef struct {
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"`
+}
+
+type externalSecretRemoteRef struct {
+	Key      string `yaml:"key"`
+	Property string `yaml:"property"`
+}
+
+type externalSecretData struct {
+	SecretKey string                  `yaml:"secretKey"`
+	RemoteRef externalSecretRemoteRef `yaml:"remoteRef"`
+}
+
+type externalSecretTemplate struct {
+	EngineVersion string            `yaml:"engineVersion"`
+	Metadata      objectMetadata    `yaml:"metadata"`
+	Data          map[string]string `yaml:"data"`
+}
+
+type externalSecretTarget struct {
+	Name           string                 `yaml:"name"`
+	CreationPolicy string                 `yaml:"creationPolicy"`
+	Template       externalSecretTemplate `yaml:"template"`
+}
+
+type externalSecretSpec struct {
+	RefreshInterval string                 `yaml:"refreshInterval"`
+	SecretStoreRef  externalSecretStoreRef `yaml:"secretStoreRef"`
+	Target          externalSecretTarget   `yaml:"target"`
+	Data            []externalSecretData   `yaml:"data"`
+}
+
+type externalSecret struct {
+	ApiVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   objectMetadata     `yaml:"metadata"`
+	Spec       externalSecretSpec `yaml:"spec"`
+}
+
+// ExternalSecretRemoteKey returns key of the external store holding username and password properties for the repository of the chart
+func ExternalSecretRemoteKey(helmInfo HelmRepoInfo) string {
+	return externalSecretsConfig.KeyPrefix + helmInfo.RepoHost
+}
+
+// ProduceExternalSecretYaml produces ExternalSecret, which External Secrets Operator resolves into repository secret of rd
+func ProduceExternalSecretYaml(w io.Writer, rd *RelizaDeployment, namespace string, helmInfo HelmRepoInfo) error {
+	remoteKey := ExternalSecretRemoteKey(helmInfo)
+	templateData := repositorySecretData(rd, helmInfo)
+	templateData["username"] = "{{ .username }}"
+	templateData["password"] = "{{ .password }}"
+	templateLabels := cdResourceLabels(rd.Name)
+	templateLabels["argocd.argoproj.io/secret-type"] = "repository"
+	es := externalSecret{
+		ApiVersion: "external-secrets.io/v1beta1",
+		Kind:       "ExternalSecret",
+		Metadata: objectMetadata{
+			Name:        rd.Name,
+			Namespace:   namespace,
+			Annotations: cdResourceAnnotations(rd),
+			Labels:      cdResourceLabels(rd.Name),
+		},
+		Spec: externalSecretSpec{
+			RefreshInterval: externalSecretsConfig.RefreshInterval,
+			SecretStoreRef: externalSecretStoreRef{
+				Name: externalSecretsConfig.StoreName,
+				Kind: externalSecretsConfig.StoreKind,
+			},
+			Target: externalSecretTarget{
+				Name:           rd.Name,
+				CreationPolicy: "Owner",
+				Template: externalSecretTemplate{
+					EngineVersion: "v2",
+					Metadata: objectMetadata{
+						Annotations: cdResourceAnnotations(rd),
+						Labels:      templateLabels,
+					},
+					Data: templateData,
+				},
+			},
+			Data: []externalSecretData{
+				{SecretKey: "username", RemoteRef: externalSecretRemoteRef{Key: remoteKey, Property: "username"}},
+				{SecretKey: "password", RemoteRef: externalSecretRemoteRef{Key: remoteKey, Property: "password"}},
+			},
+		},
+	}
+	return writeYaml(w, es)
+}
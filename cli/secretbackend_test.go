@@ -0,0 +1,110 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestProduceExternalSecretYaml(t *testing.T) {
+	externalSecretsConfig = ExternalSecretsConfig{StoreName: "vault", StoreKind: "ClusterSecretStore", KeyPrefix: "reliza-cd/", RefreshInterval: "1h"}
+	defer func() { externalSecretsConfig = ExternalSecretsConfig{} }()
+
+	rd := RelizaDeployment{Name: "default---app"}
+	helmInfo := HelmRepoInfo{ChartName: "app", RepoHost: "registry.example.com/charts", UseOci: true}
+	var esYaml bytes.Buffer
+	err := ProduceExternalSecretYaml(&esYaml, &rd, "argocd", helmInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var es externalSecret
+	err = yaml.Unmarshal(esYaml.Bytes(), &es)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if es.Metadata.Name != "default---app" || es.Spec.Target.Name != "default---app" || es.Spec.SecretStoreRef.Name != "vault" {
+		t.Errorf("unexpected external secret metadata %+v", es)
+	}
+	if len(es.Spec.Data) != 2 || es.Spec.Data[0].RemoteRef.Key != "reliza-cd/registry.example.com/charts" {
+		t.Errorf("unexpected external secret data %+v", es.Spec.Data)
+	}
+	templateData := es.Spec.Target.Template.Data
+	if templateData["url"] != "registry.example.com/charts" || templateData["enableOCI"] != "true" || templateData["password"] != "{{ .password }}" {
+		t.Errorf("unexpected external secret template data %+v", templateData)
+	}
+}
+
+func TestSecretBackendPerRegistry(t *testing.T) {
+	parsedConfig, err := parseRegistryConfig([]byte(`registries:
+- match: "^vault-registry\\.example\\.com/"
+  secretBackend: External-Secrets
+- match: "\\.dkr\\.ecr\\."
+  secretBackend: sealed
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevRegistryConfig := registryConfig
+	prevBackend := secretBackend
+	registryConfig = parsedConfig
+	secretBackend = SecretBackendSealed
+	defer func() {
+		registryConfig = prevRegistryConfig
+		secretBackend = prevBackend
+	}()
+
+	vaultInfo := GetHelmRepoInfoFromDeployment(&RelizaDeployment{ArtUri: "vault-registry.example.com/charts/app"})
+	if backend := ResolveSecretBackend(vaultInfo); backend != SecretBackendExternalSecrets {
+		t.Errorf("expected registry to use %s, got %s", SecretBackendExternalSecrets, backend)
+	}
+	otherInfo := GetHelmRepoInfoFromDeployment(&RelizaDeployment{ArtUri: "registry.example.com/charts/app"})
+	if backend := ResolveSecretBackend(otherInfo); backend != SecretBackendSealed {
+		t.Errorf("expected other registries to use SECRET_BACKEND, got %s", backend)
+	}
+	if !IsSecretBackendUsed(SecretBackendExternalSecrets) || !IsSecretBackendUsed(SecretBackendSealed) {
+		t.Error("expected both backends to be reported as used")
+	}
+
+	_, err = parseRegistryConfig([]byte("registries:\n- match: example\n  secretBackend: local\n"))
+	if err == nil {
+		t.Error("expected local backend to be rejected per registry")
+	}
+}
+
+func TestWaitUntilSecretCreatedTimesOut(t *testing.T) {
+	fakeTools(t, map[string]string{"kubectl": "exit 1"})
+	prevTimeout := secretWaitTimeout
+	prevInterval := secretWaitPollInterval
+	secretWaitTimeout = 50 * time.Millisecond
+	secretWaitPollInterval = 10 * time.Millisecond
+	defer func() {
+		secretWaitTimeout = prevTimeout
+		secretWaitPollInterval = prevInterval
+	}()
+
+	if err := WaitUntilSecretCreated("missing", "argocd"); err == nil {
+		t.Error("expected timeout waiting for missing secret")
+	}
+
+	fakeTools(t, map[string]string{"kubectl": "exit 0"})
+	if err := WaitUntilSecretCreated("present", "argocd"); err != nil {
+		t.Errorf("expected present secret to be found, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTools points shellout to a temporary directory with stub tools, each given as a shell script body
+// keyed by tool name, i.e. "kubectl". Every tool invocation is appended to calls.log in the returned directory.
+func fakeTools(t *testing.T, scripts map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "tools"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tool := range []string{"helm", "kubectl", "reliza-cli", "kubeseal", "cosign"} {
+		script := "#!/bin/sh\necho \"" + tool + " $*\" >> " + filepath.Join(dir, "calls.log") + "\n" + scripts[tool] + "\n"
+		err = os.WriteFile(filepath.Join(dir, "tools", tool), []byte(script), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevToolsDir := toolsDir
+	toolsDir = dir
+	t.Cleanup(func() { toolsDir = prevToolsDir })
+	return dir
+}
+
+// fakeToolCalls returns invocations of stub tools recorded so far which contain all of the given fragments
+func fakeToolCalls(t *testing.T, dir string, fragments ...string) []string {
+	t.Helper()
+	log, err := os.ReadFile(filepath.Join(dir, "calls.log"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	calls := []string{}
+	for _, call := range strings.Split(string(log), "\n") {
+		matches := len(call) > 0
+		for _, fragment := range fragments {
+			matches = matches && strings.Contains(call, fragment)
+		}
+		if matches {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
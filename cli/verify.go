@@ -0,0 +1,159 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+)
+
+const (
+	CosignApp                 = "tools/cosign"
+	DigestVerificationOff     = "off"
+	DigestVerificationReport  = "report"
+	DigestVerificationEnforce = "enforce"
+	ChartSourceRegistry       = "registry"
+	ChartSourceCache          = "cache"
+	ChartSourceOffline        = "offline"
+)
+
+type VerificationConfig struct {
+	DigestVerification string
+	HelmKeyring        string
+	CosignPublicKey    string
+}
+
+var (
+	verificationConfig VerificationConfig
+	pullDigestRe       = regexp.MustCompile(`Digest:\s*(sha256:[a-f0-9]{64})`)
+)
+
+func initVerificationConfig() {
+	verificationConfig.DigestVerification = parseDigestVerification(os.Getenv("VERIFY_CHART_DIGEST"))
+	verificationConfig.HelmKeyring = os.Getenv("HELM_VERIFY_KEYRING")
+	verificationConfig.CosignPublicKey = os.Getenv("COSIGN_PUBLIC_KEY")
+}
+
+// parseDigestVerification resolves VERIFY_CHART_DIGEST mode, verification is off unless explicitly enabled
+// as report (mismatch is logged) or enforce (mismatch blocks install, also accepted as true)
+func parseDigestVerification(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case DigestVerificationReport:
+		return DigestVerificationReport
+	case DigestVerificationEnforce, "true":
+		return DigestVerificationEnforce
+	}
+	return DigestVerificationOff
+}
+
+// helmProvenanceFlags returns helm pull flags enabling .prov verification for classic helm repositories when keyring is configured
+func helmProvenanceFlags() string {
+	if len(verificationConfig.HelmKeyring) > 0 {
+		return " --verify --keyring " + verificationConfig.HelmKeyring
+	}
+	return ""
+}
+
+// extractPullDigest extracts OCI manifest digest from the output of helm pull
+func extractPullDigest(pullOutput string) string {
+	match := pullDigestRe.FindStringSubmatch(pullOutput)
+	if len(match) > 1 {
+		return match[1]
+	}
+	return ""
+}
+
+// VerifyHelmChart verifies downloaded chart of rd before it is extracted. When enabled with VERIFY_CHART_DIGEST,
+// chart digest is checked against ArtHash of the CycloneDX component, which may be either sha256 of the chart archive
+// or, for OCI charts, the manifest digest reported by helm pull or shipped with offline charts.
+// For OCI charts cosign signature is verified when COSIGN_PUBLIC_KEY is configured: against the registry for pulled charts,
+// against signature shipped with the archive for offline charts, and not again for charts restored from the chart cache,
+// which were verified when stored.
+func VerifyHelmChart(path string, rd *RelizaDeployment, pa *ProjectAuth, helmRepoInfo HelmRepoInfo, pullDigest string, chartSource string) error {
+	var err error
+	if verificationConfig.DigestVerification != DigestVerificationOff && len(rd.ArtHash.Value) > 0 {
+		err = verifyChartDigest(path, rd.ArtHash, pullDigest)
+	}
+	if err != nil && verificationConfig.DigestVerification == DigestVerificationReport {
+		sugar.Warnw("Helm chart digest verification failed, installing as VERIFY_CHART_DIGEST is report",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"chartName", helmRepoInfo.ChartName,
+			"namespace", rd.Namespace,
+			"expectedDigest", ExtractRlzDigestFromCdxDigest(rd.ArtHash),
+			"error", err)
+		err = nil
+	}
+	if err == nil && helmRepoInfo.UseOci && len(verificationConfig.CosignPublicKey) > 0 {
+		switch chartSource {
+		case ChartSourceRegistry:
+			err = verifyCosignSignature(rd, pa, helmRepoInfo)
+		case ChartSourceOffline:
+			err = verifyOfflineCosignSignature(helmRepoInfo, rd.ArtVersion)
+		}
+	}
+	if err != nil {
+		sugar.Errorw("Helm chart verification failed, refusing to install",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"chartName", helmRepoInfo.ChartName,
+			"namespace", rd.Namespace,
+			"repoUri", helmRepoInfo.RepoUri,
+			"expectedDigest", ExtractRlzDigestFromCdxDigest(rd.ArtHash),
+			"error", err)
+	}
+	return err
+}
+
+func verifyChartDigest(path string, artHash cdx.Hash, pullDigest string) error {
+	if artHash.Algorithm != cdx.HashAlgoSHA256 {
+		sugar.Warn("Skipping chart digest verification, unsupported hash algorithm: ", artHash.Algorithm)
+		return nil
+	}
+	expectedDigest := ExtractRlzDigestFromCdxDigest(artHash)
+	archiveDigest := getHelmChartDigest(path)
+	if strings.EqualFold(archiveDigest, expectedDigest) || strings.EqualFold(pullDigest, expectedDigest) {
+		return nil
+	}
+	return errors.New("chart digest mismatch, archive digest = " + archiveDigest + ", pulled manifest digest = " + pullDigest + ", expected = " + expectedDigest)
+}
+
+func verifyCosignSignature(rd *RelizaDeployment, pa *ProjectAuth, helmRepoInfo HelmRepoInfo) error {
+	var err error
+	registryHost := strings.Split(helmRepoInfo.RepoHost, "/")[0]
+	if pa.Type != "NOCREDS" && len(pa.Login) > 0 {
+		_, _, err = shellout(CosignApp + " login " + registryHost + " --username " + pa.Login + " --password " + pa.Password)
+	}
+	if err == nil {
+		chartRef := strings.Replace(helmRepoInfo.OciUri, "oci://", "", 1) + ":" + rd.ArtVersion
+		_, _, err = shellout(CosignApp + " verify --key " + verificationConfig.CosignPublicKey + " " + chartRef)
+	}
+	return err
+}
+
+// verifyOfflineCosignSignature verifies cosign signature <chart>-<version>.tgz.sig shipped with offline chart archive
+func verifyOfflineCosignSignature(helmRepoInfo HelmRepoInfo, version string) error {
+	chartPath := offlineChartPath(helmRepoInfo, version)
+	if _, err := os.Stat(chartPath + ".sig"); err != nil {
+		return errors.New("cosign signature " + chartPath + ".sig is missing for offline chart")
+	}
+	_, _, err := shellout(CosignApp + " verify-blob --key " + verificationConfig.CosignPublicKey + " --signature " + chartPath + ".sig " + chartPath)
+	return err
+}
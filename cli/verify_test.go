@@ -0,0 +1,147 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+)
+
+const testManifestDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestExtractPullDigest(t *testing.T) {
+	pullOutput := "Pulled: registry.example.com/charts/my-app:1.2.3\nDigest: " + testManifestDigest + "\n"
+	if digest := extractPullDigest(pullOutput); digest != testManifestDigest {
+		t.Errorf("expected %s, got %s", testManifestDigest, digest)
+	}
+	if digest := extractPullDigest("Pulled: my-app-1.2.3.tgz\n"); digest != "" {
+		t.Errorf("expected no digest for classic repository pull, got %s", digest)
+	}
+	if digest := extractPullDigest("Digest: sha256:tooshort\n"); digest != "" {
+		t.Errorf("expected malformed digest to be ignored, got %s", digest)
+	}
+}
+
+func writeTestChartArchive(t *testing.T) (string, string) {
+	t.Helper()
+	groupPath := t.TempDir() + "/"
+	archive := []byte("chart archive")
+	err := os.WriteFile(groupPath+"my-app-1.2.3.tgz", archive, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveDigest := sha256.Sum256(archive)
+	return groupPath, hex.EncodeToString(archiveDigest[:])
+}
+
+func TestVerifyChartDigest(t *testing.T) {
+	fakeTools(t, nil)
+	groupPath, archiveDigest := writeTestChartArchive(t)
+
+	err := verifyChartDigest(groupPath, cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: archiveDigest}, "")
+	if err != nil {
+		t.Errorf("expected archive digest to match, got %v", err)
+	}
+	err = verifyChartDigest(groupPath, cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: testManifestDigest[7:]}, testManifestDigest)
+	if err != nil {
+		t.Errorf("expected OCI manifest digest to match, got %v", err)
+	}
+	err = verifyChartDigest(groupPath, cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: testManifestDigest[7:]}, "")
+	if err == nil {
+		t.Error("expected mismatch when neither archive nor manifest digest match")
+	}
+	err = verifyChartDigest(groupPath, cdx.Hash{Algorithm: cdx.HashAlgoSHA512, Value: "abc"}, "")
+	if err != nil {
+		t.Errorf("expected unsupported algorithm to be skipped, got %v", err)
+	}
+}
+
+func TestVerifyHelmChartDigestModes(t *testing.T) {
+	fakeTools(t, nil)
+	groupPath, _ := writeTestChartArchive(t)
+	rd, pa, helmInfo := testResourceDeployment()
+	rd.ArtHash = cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: testManifestDigest[7:]}
+	prevConfig := verificationConfig
+	defer func() { verificationConfig = prevConfig }()
+
+	expectations := map[string]bool{"": false, "false": false, "report": false, "enforce": true, "true": true}
+	for mode, expectError := range expectations {
+		verificationConfig = VerificationConfig{DigestVerification: parseDigestVerification(mode)}
+		err := VerifyHelmChart(groupPath, &rd, &pa, helmInfo, "", ChartSourceRegistry)
+		if (err != nil) != expectError {
+			t.Errorf("VERIFY_CHART_DIGEST=%s: expected error = %v, got %v", mode, expectError, err)
+		}
+	}
+}
+
+func TestCosignVerificationBySource(t *testing.T) {
+	toolsPath := fakeTools(t, nil)
+	groupPath, _ := writeTestChartArchive(t)
+	rd, pa, helmInfo := testResourceDeployment()
+	prevConfig := verificationConfig
+	prevOfflineDir := offlineChartsDir
+	verificationConfig = VerificationConfig{CosignPublicKey: "cosign.pub"}
+	offlineChartsDir = t.TempDir()
+	defer func() {
+		verificationConfig = prevConfig
+		offlineChartsDir = prevOfflineDir
+	}()
+
+	err := VerifyHelmChart(groupPath, &rd, &pa, helmInfo, "", ChartSourceCache)
+	if err != nil || len(fakeToolCalls(t, toolsPath, "cosign verify")) != 0 {
+		t.Errorf("expected cached chart not to be verified again, err = %v", err)
+	}
+
+	err = VerifyHelmChart(groupPath, &rd, &pa, helmInfo, "", ChartSourceOffline)
+	if err == nil {
+		t.Error("expected offline chart without signature to fail verification")
+	}
+	os.WriteFile(offlineChartPath(helmInfo, rd.ArtVersion)+".sig", []byte("signature"), 0600)
+	err = VerifyHelmChart(groupPath, &rd, &pa, helmInfo, "", ChartSourceOffline)
+	if err != nil || len(fakeToolCalls(t, toolsPath, "cosign verify-blob --key cosign.pub --signature")) != 1 {
+		t.Errorf("expected offline chart to be verified against shipped signature, err = %v", err)
+	}
+
+	err = VerifyHelmChart(groupPath, &rd, &pa, helmInfo, "", ChartSourceRegistry)
+	if err != nil || len(fakeToolCalls(t, toolsPath, "cosign verify --key cosign.pub registry.example.com/charts/my-app:1.2.3")) != 1 {
+		t.Errorf("expected pulled chart to be verified against the registry, err = %v", err)
+	}
+}
+
+func TestOfflineChartShipsManifestDigest(t *testing.T) {
+	fakeTools(t, nil)
+	prevOfflineDir := offlineChartsDir
+	offlineChartsDir = t.TempDir()
+	defer func() { offlineChartsDir = prevOfflineDir }()
+	rd, _, helmInfo := testResourceDeployment()
+	os.WriteFile(offlineChartPath(helmInfo, rd.ArtVersion), []byte("chart archive"), 0600)
+	os.WriteFile(filepath.Join(offlineChartsDir, "my-app-1.2.3.digest"), []byte(testManifestDigest+"\n"), 0600)
+
+	groupPath := t.TempDir() + "/"
+	manifestDigest, found := restoreChartFromOfflineDir(groupPath, helmInfo, rd.ArtVersion)
+	if !found || manifestDigest != testManifestDigest {
+		t.Fatalf("expected offline chart with manifest digest, found = %v, digest = %s", found, manifestDigest)
+	}
+	err := verifyChartDigest(groupPath, cdx.Hash{Algorithm: cdx.HashAlgoSHA256, Value: testManifestDigest[7:]}, manifestDigest)
+	if err != nil {
+		t.Errorf("expected offline chart to match OCI manifest digest, got %v", err)
+	}
+}
@@ -19,27 +19,41 @@ package controller
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	ecr "github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/relizaio/reliza-cd/cli"
 )
 
-func getRegionFromPaUrl(pa *cli.ProjectAuth) string {
+func getRegionFromPaUrl(pa *cli.ProjectAuth) (string, error) {
 	urlParts := strings.Split(pa.Url, ".")
-	return urlParts[3]
+	if len(urlParts) < 4 {
+		return "", errors.New("failed to resolve ECR region from url " + pa.Url)
+	}
+	return urlParts[3], nil
 }
 
-func getEcrToken(pa *cli.ProjectAuth) string {
-	region := getRegionFromPaUrl(pa)
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(
+// getEcrToken obtains ECR authorization token. Static access keys are used when provided,
+// otherwise AWS default credential chain is used, which covers IRSA and EKS pod identity.
+func getEcrToken(pa *cli.ProjectAuth) (registryToken, error) {
+	var token registryToken
+	region, err := getRegionFromPaUrl(pa)
+	if err != nil {
+		return token, err
+	}
+	configOptions := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if len(pa.Login) > 0 && len(pa.Password) > 0 {
+		configOptions = append(configOptions, config.WithCredentialsProvider(
 			credentials.NewStaticCredentialsProvider(pa.Login, pa.Password, "")))
+	}
+	cfg, err := config.LoadDefaultConfig(context.TODO(), configOptions...)
 	if err != nil {
-		sugar.Error(err)
+		return token, err
 	}
 
 	client := ecr.NewFromConfig(cfg)
@@ -47,16 +61,26 @@ func getEcrToken(pa *cli.ProjectAuth) string {
 
 	auth, err := client.GetAuthorizationToken(context.TODO(), &authParams)
 	if err != nil {
-		sugar.Error(err)
+		return token, err
+	}
+	if len(auth.AuthorizationData) < 1 || auth.AuthorizationData[0].AuthorizationToken == nil {
+		return token, errors.New("ECR returned no authorization data")
 	}
 
 	// token is in form AWS:token, all base64-d
-	authToken := *auth.AuthorizationData[0].AuthorizationToken
-
-	decodedAuthToken, err := base64.StdEncoding.DecodeString(authToken)
+	decodedAuthToken, err := base64.StdEncoding.DecodeString(aws.ToString(auth.AuthorizationData[0].AuthorizationToken))
 	if err != nil {
-		sugar.Error(err)
+		return token, err
 	}
-
-	return strings.Replace(string(decodedAuthToken), "AWS:", "", -1)
+	loginAndPassword := strings.SplitN(string(decodedAuthToken), ":", 2)
+	if len(loginAndPassword) != 2 {
+		return token, errors.New("ECR returned malformed authorization token")
+	}
+	token.Login = loginAndPassword[0]
+	token.Password = loginAndPassword[1]
+	token.ExpiresAt = aws.ToTime(auth.AuthorizationData[0].ExpiresAt)
+	if token.ExpiresAt.IsZero() {
+		token.ExpiresAt = time.Now().Add(time.Hour)
+	}
+	return token, nil
 }
@@ -0,0 +1,92 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/relizaio/reliza-cd/cli"
+)
+
+const (
+	// ACR accepts refresh tokens with this fixed username
+	acrTokenLogin = "00000000-0000-0000-0000-000000000000"
+	acrAadScope   = "https://containerregistry.azure.net/.default"
+)
+
+// acrTokenProvider obtains Azure Container Registry refresh tokens. Service principal is used when client secret is provided,
+// otherwise workload identity federated token from AZURE_FEDERATED_TOKEN_FILE is used.
+type acrTokenProvider struct {
+	AuthorityUrl string
+	HttpClient   *http.Client
+}
+
+var acrTokens = acrTokenProvider{
+	AuthorityUrl: "https://login.microsoftonline.com",
+	HttpClient:   registryAuthHttpClient,
+}
+
+func (p *acrTokenProvider) getToken(pa *cli.ProjectAuth, registryHost string) (registryToken, error) {
+	var token registryToken
+	tenantId := os.Getenv("AZURE_TENANT_ID")
+	if len(tenantId) < 1 {
+		return token, errors.New("AZURE_TENANT_ID must be set for ACR authentication")
+	}
+	clientId := pa.Login
+	if len(clientId) < 1 {
+		clientId = os.Getenv("AZURE_CLIENT_ID")
+	}
+
+	aadForm := url.Values{}
+	aadForm.Set("grant_type", "client_credentials")
+	aadForm.Set("client_id", clientId)
+	aadForm.Set("scope", acrAadScope)
+	if len(pa.Password) > 0 {
+		aadForm.Set("client_secret", pa.Password)
+	} else {
+		federatedToken, err := os.ReadFile(os.Getenv("AZURE_FEDERATED_TOKEN_FILE"))
+		if err != nil {
+			return token, errors.New("no ACR client secret provided and workload identity token is not available: " + err.Error())
+		}
+		aadForm.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		aadForm.Set("client_assertion", string(federatedToken))
+	}
+	aadResp, err := postTokenForm(p.HttpClient, p.AuthorityUrl+"/"+tenantId+"/oauth2/v2.0/token", aadForm)
+	if err != nil {
+		return token, err
+	}
+
+	exchangeForm := url.Values{}
+	exchangeForm.Set("grant_type", "access_token")
+	exchangeForm.Set("service", registryHost)
+	exchangeForm.Set("tenant", tenantId)
+	exchangeForm.Set("access_token", aadResp.AccessToken)
+	exchangeResp, err := postTokenForm(p.HttpClient, "https://"+registryHost+"/oauth2/exchange", exchangeForm)
+	if err != nil {
+		return token, err
+	}
+	if len(exchangeResp.RefreshToken) < 1 {
+		return token, errors.New("ACR token exchange returned no refresh token for " + registryHost)
+	}
+	token.Login = acrTokenLogin
+	token.Password = exchangeResp.RefreshToken
+	token.ExpiresAt = expiryFromJwt(exchangeResp.RefreshToken, time.Now().Add(time.Hour))
+	return token, nil
+}
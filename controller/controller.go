@@ -16,12 +16,12 @@ WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
 package controller
 
 import (
+	"bytes"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/relizaio/reliza-cd/cli"
-	"github.com/relizaio/reliza-cd/utils"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -40,6 +40,10 @@ func init() {
 }
 
 func loopInit() {
+	if !cli.IsSecretBackendUsed(cli.SecretBackendSealed) {
+		sugar.Info("Sealed Secrets are not used with the configured secret backends, skipping sealed cert setup")
+		return
+	}
 	sugar.Info("Starting loopInit - getting sealed cert")
 	sealedCert := cli.GetSealedCert()
 	sugar.Info("Got sealed cert, length: ", len(sealedCert))
@@ -54,11 +58,16 @@ func loopInit() {
 	}
 
 	sugar.Info("Setting sealed certificate on the hub")
-	cli.SetSealedCertificateOnTheHub(sealedCert)
+	cli.PublishSealedCert(sealedCert)
 	sugar.Info("Completed loopInit")
 }
 
 func singleLoopRun() {
+	if cli.IsSealedCertCheckDue() {
+		cli.CheckSealedCertRotation()
+	}
+	cli.SyncClusterKubeconfigs()
+
 	instManifest, err := cli.GetInstanceCycloneDX()
 
 	if err != nil {
@@ -70,10 +79,16 @@ func singleLoopRun() {
 
 		existingDeployments := collectExistingDeployments()
 
+		cli.ApplyArgoProject(rlzDeployments, existingDeployments)
+
 		namespacesForWatcher := make(map[string]bool)
 
 		isError := false
 
+		for _, nsRd := range cli.NamespaceDeployments(rlzDeployments) {
+			cli.EnsureNamespace(&nsRd)
+		}
+
 		for _, rd := range rlzDeployments {
 			existingDeployments[rd.Name] = true
 			err = processSingleDeployment(&rd)
@@ -87,13 +102,20 @@ func singleLoopRun() {
 			}
 			isError = (err != nil)
 			namespacesForWatcher[rd.Namespace] = true
-			cli.CreateNamespaceIfMissing(rd.Namespace)
 		}
 
 		cli.InstallWatcher(&namespacesForWatcher)
 
+		// applied regardless of errors of other bundles, deletions below drop elements only after deletion safeguards
+		cli.ApplyApplicationSet()
+
 		if !isError && len(rlzDeployments) > 0 {
+			cli.ResetDeletionBudget()
 			deleteObsoleteDeployments(&existingDeployments)
+			cli.DeleteEmptyNamespaces(existingDeployments)
+			if cli.IsOrphanGcDue() {
+				cli.GarbageCollectOrphans(existingDeployments)
+			}
 		}
 
 		helmDataStreamToHub(&existingDeployments)
@@ -104,6 +126,7 @@ func Loop() {
 	loopInit()
 
 	go cli.StartBackupScheduler()
+	go cli.StartMetricsServer()
 
 	for true {
 		singleLoopRun()
@@ -144,10 +167,8 @@ func getNamespaceFromPath(path string) string {
 }
 
 func deleteObsoleteDeployments(existingDeployments *map[string]bool) {
-	for edKey, edVal := range *existingDeployments {
-		if !edVal {
-			cli.DeleteObsoleteDeployment("workspace/" + edKey + "/")
-		}
+	for _, edKey := range cli.SelectDeploymentsForDeletion(*existingDeployments) {
+		cli.DeleteObsoleteDeployment("workspace/" + edKey + "/")
 	}
 }
 
@@ -158,7 +179,7 @@ func collectExistingDeployments() map[string]bool {
 		sugar.Error(err)
 	}
 	for _, we := range workspaceEntries {
-		if we.IsDir() && we.Name() != "watcher" && we.Name() != "lost+found" {
+		if we.IsDir() && we.Name() != "watcher" && we.Name() != "lost+found" && we.Name() != cli.ChartCacheDirName {
 			existingDeployments[we.Name()] = false
 		}
 	}
@@ -170,10 +191,21 @@ func processSingleDeployment(rd *cli.RelizaDeployment) error {
 		sugar.Info("SecretNS is null")
 		panic("secretnamespace must be set by this point")
 	}
+	helmInfo := cli.GetHelmRepoInfoFromDeployment(rd)
 	var projAuth cli.ProjectAuth
 	if rd.ArtHash.Value == "" {
 		// No hash means public repo, assume NOCREDS
 		projAuth.Type = "NOCREDS"
+	} else if cli.ResolveSecretBackend(helmInfo) == cli.SecretBackendExternalSecrets {
+		// credentials are synced from the external store, Hub artifact secrets are not used
+		projAuth.Type = "EXTERNAL_SECRET"
+	} else if cli.IsLocalSecretsBackend() {
+		digest := cli.ExtractRlzDigestFromCdxDigest(rd.ArtHash)
+		var err error
+		projAuth, err = cli.GetLocalProjectAuth(digest, rd.Namespace)
+		if err != nil {
+			return err
+		}
 	} else {
 		digest := cli.ExtractRlzDigestFromCdxDigest(rd.ArtHash)
 		projAuth = cli.GetProjectAuthByArtifactDigest(digest, rd.Namespace)
@@ -182,51 +214,38 @@ func processSingleDeployment(rd *cli.RelizaDeployment) error {
 	os.MkdirAll("workspace/"+dirName, 0700)
 	groupPath := "workspace/" + dirName + "/"
 
-	var helmDownloadPa cli.ProjectAuth
-
 	doInstall := false
 	isError := false
-	helmDownloadPa.Type = projAuth.Type
-	helmInfo := cli.GetHelmRepoInfoFromDeployment(rd)
-	if projAuth.Type == "ECR" {
-		ecrSecretPath := "workspace/" + dirName + "/ecrreposecret.yaml"
-		ecrSecretFile := utils.CreateFile(ecrSecretPath)
-		cli.ProduceEcrSecretYaml(ecrSecretFile, rd, projAuth, cli.SecretsNamespace)
-		cli.KubectlApply(ecrSecretPath)
-		cli.WaitUntilSecretCreated("ecr-"+rd.Name, cli.SecretsNamespace)
-		ecrAuthPa := cli.ResolveHelmAuthSecret("ecr-" + dirName)
-		ecrToken := getEcrToken(&ecrAuthPa)
-		var paForPlainSecret cli.ProjectAuth
-		paForPlainSecret.Login = "AWS"
-		paForPlainSecret.Password = ecrToken
-		paForPlainSecret.Type = "ECR"
-		paForPlainSecret.Url = ecrAuthPa.Url
-		secretPath := "workspace/" + dirName + "/reposecret.yaml"
-		secretFile := utils.CreateFile(secretPath)
-		cli.ProducePlainSecretYaml(secretFile, rd, paForPlainSecret, cli.SecretsNamespace, helmInfo)
-		cli.KubectlApply(secretPath)
-		cli.WaitUntilSecretCreated(rd.Name, cli.SecretsNamespace)
-		helmDownloadPa = cli.ResolveHelmAuthSecret(dirName)
-	}
-
-	if projAuth.Type == "CREDS" {
-		secretPath := "workspace/" + dirName + "/reposecret.yaml"
-		secretFile := utils.CreateFile(secretPath)
-		cli.ProduceSecretYaml(secretFile, rd, projAuth, cli.SecretsNamespace, helmInfo)
-		cli.KubectlApply(secretPath)
-		cli.WaitUntilSecretCreated(rd.Name, cli.SecretsNamespace)
-		helmDownloadPa = cli.ResolveHelmAuthSecret(dirName)
-	}
-
-	if projAuth.Type == "NOCREDS" {
-		secretPath := "workspace/" + dirName + "/reposecret.yaml"
-		secretFile := utils.CreateFile(secretPath)
-		cli.ProduceSecretYaml(secretFile, rd, projAuth, cli.SecretsNamespace, helmInfo)
-		cli.KubectlApply(secretPath)
-		cli.WaitUntilSecretCreated(rd.Name, cli.SecretsNamespace)
-		helmDownloadPa.Url = rd.ArtUri
+	if len(helmInfo.CredentialsSecret) > 0 {
+		// credentials configured for the registry in registry configuration take precedence over credentials from the Hub
+		projAuth.Type = "REGISTRY_SECRET"
 	}
-	var err error
+
+	credsReq := CredentialRequest{Deployment: rd, ProjectAuth: projAuth, HelmInfo: helmInfo}
+	credsProvider, err := getCredentialProvider(projAuth.Type)
+	var helmDownloadPa cli.ProjectAuth
+	if err == nil {
+		helmDownloadPa, err = resolveDeploymentCredentials(credsProvider, &credsReq, groupPath)
+	}
+	if err != nil {
+		sugar.Errorw("Failed to resolve registry credentials",
+			"bundle", rd.Bundle,
+			"version", rd.ArtVersion,
+			"namespace", rd.Namespace,
+			"authType", projAuth.Type,
+			"repoHost", helmInfo.RepoHost,
+			"error", err)
+		return err
+	}
+
+	if !cli.IsHelmDeployment(rd) {
+		err = processManifestsDeployment(groupPath, rd, &helmDownloadPa, helmInfo)
+		if err != nil {
+			credsProvider.Refresh(&credsReq)
+		}
+		return err
+	}
+
 	lastHelmVer := cli.GetLastHelmVersion(groupPath)
 	doDownloadChart := false
 	if rd.ArtVersion != lastHelmVer {
@@ -244,6 +263,7 @@ func processSingleDeployment(rd *cli.RelizaDeployment) error {
 		} else {
 			// Error already logged in DownloadHelmChart with full context
 			isError = true
+			credsProvider.Refresh(&credsReq)
 		}
 	}
 
@@ -262,12 +282,28 @@ func processSingleDeployment(rd *cli.RelizaDeployment) error {
 		isError = (err != nil)
 	}
 
+	if !isError {
+		// resolved on every loop, so that changed options are applied and covered by the change digest
+		optionsChanged := cli.IsArgoApplicationOptionsChanged(groupPath, rd)
+		doInstall = doInstall || optionsChanged
+	}
+
 	if !isError && !doInstall {
 		doInstall = cli.IsValuesDiff(groupPath)
 	}
 	if !isError && !doInstall {
 		doInstall = !cli.IsFirstInstallDone(rd)
 	}
+	if !isError && !doInstall && cli.IsDriftCheckDue(rd) {
+		doInstall = cli.CheckDrift(groupPath, rd)
+	}
+
+	changePending := false
+	if !isError && !doInstall {
+		// change detected on one of the previous loops is still waiting for approval
+		changePending = cli.IsChangePending(groupPath, rd)
+		doInstall = changePending
+	}
 
 	if !isError && doInstall {
 		err = cli.SetHelmChartAppVersion(groupPath, rd)
@@ -279,15 +315,118 @@ func processSingleDeployment(rd *cli.RelizaDeployment) error {
 		isError = (err != nil)
 	}
 
+	if !isError && doInstall && !changePending {
+		// diff is produced as soon as a change is detected so that it can be reviewed before approval,
+		// it is informational only and failure to produce it does not block install
+		cli.ProduceDeploymentDiff(groupPath, rd)
+	}
+
+	if !isError && doInstall && cli.IsApprovalRequired(rd) {
+		doInstall, err = cli.IsChangeApproved(groupPath, rd)
+		isError = (err != nil)
+	}
+
 	if !isError && doInstall {
 		// cli.CreateNamespaceIfMissing(rd.Namespace)
 		err := cli.InstallApplication(groupPath, rd)
 		isError = (err != nil)
 	}
 
-	if !isError && doInstall {
+	if !isError && doInstall && !cli.IsApplicationSetMode() {
+		// in ApplicationSet mode deployed data is recorded once the ApplicationSet is applied
 		cli.RecordDeployedData(groupPath, rd)
+		cli.ClearPendingChange(groupPath, rd)
+	} else if !isError && !doInstall {
+		cli.EnsureApplicationSetElement(groupPath, rd)
+		cli.RefreshArgoApplicationStatus(groupPath, rd)
 	}
 
 	return err
 }
+
+func processManifestsDeployment(groupPath string, rd *cli.RelizaDeployment, pa *cli.ProjectAuth, helmInfo cli.HelmRepoInfo) error {
+	var err error
+	doDownload := rd.ArtVersion != cli.GetLastHelmVersion(groupPath)
+	if _, statErr := os.Stat(groupPath + cli.GetChartNameFromDeployment(rd)); statErr != nil {
+		doDownload = true
+	}
+	if doDownload {
+		err = cli.DownloadManifestsArtifact(groupPath, rd, pa, helmInfo)
+		if err != nil {
+			return err
+		}
+		cli.RecordHelmChartVersion(groupPath, rd)
+	}
+
+	err = cli.RenderManifests(groupPath, rd)
+	if err != nil {
+		return err
+	}
+
+	doInstall := cli.IsManifestsDiff(groupPath)
+	if !doInstall && cli.IsDriftCheckDue(rd) {
+		doInstall = cli.CheckDrift(groupPath, rd)
+	}
+	changePending := false
+	if !doInstall {
+		changePending = cli.IsChangePending(groupPath, rd)
+		doInstall = changePending
+	}
+	if doInstall && !changePending {
+		cli.ProduceDeploymentDiff(groupPath, rd)
+	}
+	if doInstall && cli.IsApprovalRequired(rd) {
+		doInstall, err = cli.IsChangeApproved(groupPath, rd)
+	}
+
+	if err == nil && doInstall {
+		err = cli.ApplyManifests(groupPath, rd)
+		if err == nil {
+			cli.RecordDeployedData(groupPath, rd)
+			cli.ClearPendingChange(groupPath, rd)
+		}
+	}
+	return err
+}
+
+// resolveDeploymentCredentials applies repository secret produced by the credential provider and resolves download credentials
+func resolveDeploymentCredentials(credsProvider CredentialProvider, credsReq *CredentialRequest, groupPath string) (cli.ProjectAuth, error) {
+	if cli.IsLocalSecretsBackend() {
+		// credentials are used directly for helm registry logins, no repository secret is needed in standalone mode
+		return credsProvider.ResolveCredentials(credsReq)
+	}
+	var secretYaml bytes.Buffer
+	err := credsProvider.ProduceRepositorySecret(&secretYaml, credsReq)
+	if err != nil {
+		return cli.ProjectAuth{}, err
+	}
+	err = applySecretIfChanged(groupPath+"reposecret.yaml", secretYaml.Bytes(), credsReq.Deployment.Name)
+	if err != nil {
+		return cli.ProjectAuth{}, err
+	}
+	return credsProvider.ResolveCredentials(credsReq)
+}
+
+// applySecretIfChanged applies secret yaml when it differs from the previously applied one or the secret is missing from the cluster,
+// so that unchanged credentials are not re-applied every loop
+func applySecretIfChanged(secretPath string, secretYaml []byte, secretName string) error {
+	appliedYaml, err := os.ReadFile(secretPath)
+	if err == nil && bytes.Equal(appliedYaml, secretYaml) && cli.IsSecretPresent(secretName, cli.SecretsNamespace) {
+		return nil
+	}
+	err = os.WriteFile(secretPath, secretYaml, 0600)
+	if err != nil {
+		sugar.Error(err)
+		return err
+	}
+	err = cli.KubectlApply(secretPath)
+	if err != nil {
+		// forget applied yaml, so that apply is retried on the next loop
+		os.Remove(secretPath)
+		sugar.Errorw("Failed to apply repository secret",
+			"secretName", secretName,
+			"error", err)
+		return err
+	}
+	return cli.WaitUntilSecretCreated(secretName, cli.SecretsNamespace)
+}
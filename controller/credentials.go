@@ -0,0 +1,145 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package controller
+
+import (
+	"errors"
+	"io"
+
+	"github.com/relizaio/reliza-cd/cli"
+)
+
+// CredentialRequest describes deployment for which registry credentials are resolved, ProjectAuth is as received from the Hub
+type CredentialRequest struct {
+	Deployment  *cli.RelizaDeployment
+	ProjectAuth cli.ProjectAuth
+	HelmInfo    cli.HelmRepoInfo
+}
+
+// CredentialProvider resolves registry credentials for a ProjectAuth type
+type CredentialProvider interface {
+	// ResolveCredentials returns credentials used to download artifacts of the deployment, called after repository secret is applied
+	ResolveCredentials(req *CredentialRequest) (cli.ProjectAuth, error)
+	// ProduceRepositorySecret writes repository secret of the deployment, which is used by Argo CD
+	ProduceRepositorySecret(w io.Writer, req *CredentialRequest) error
+	// Refresh discards cached credentials of the deployment, so that they are obtained again, i.e. after download failure
+	Refresh(req *CredentialRequest)
+}
+
+var credentialProviders = make(map[string]CredentialProvider)
+
+// RegisterCredentialProvider registers provider for ProjectAuth type, replacing previously registered provider of the same type
+func RegisterCredentialProvider(authType string, provider CredentialProvider) {
+	credentialProviders[authType] = provider
+}
+
+func getCredentialProvider(authType string) (CredentialProvider, error) {
+	provider, isRegistered := credentialProviders[authType]
+	if !isRegistered {
+		return nil, errors.New("no credential provider registered for auth type '" + authType + "'")
+	}
+	return provider, nil
+}
+
+func init() {
+	RegisterCredentialProvider("CREDS", &sealedCredentialProvider{})
+	RegisterCredentialProvider("NOCREDS", &noCredentialProvider{})
+	RegisterCredentialProvider("REGISTRY_SECRET", &registrySecretCredentialProvider{})
+	RegisterCredentialProvider("EXTERNAL_SECRET", &externalSecretCredentialProvider{})
+	RegisterCredentialProvider("ECR", &tokenCredentialProvider{exchange: func(pa *cli.ProjectAuth, _ string) (registryToken, error) {
+		return getEcrToken(pa)
+	}})
+	RegisterCredentialProvider("ACR", &tokenCredentialProvider{exchange: acrTokens.getToken})
+	RegisterCredentialProvider("GAR", &tokenCredentialProvider{exchange: func(pa *cli.ProjectAuth, _ string) (registryToken, error) {
+		return garTokens.getToken(pa)
+	}})
+}
+
+// sealedCredentialProvider handles static credentials sealed by the Hub, which are unsealed in the cluster from the repository secret.
+// With the local secret backend credentials are not sealed and are used as received.
+type sealedCredentialProvider struct{}
+
+func (p *sealedCredentialProvider) ResolveCredentials(req *CredentialRequest) (cli.ProjectAuth, error) {
+	if cli.IsLocalSecretsBackend() {
+		// credentials are received from the Hub unsealed
+		return req.ProjectAuth, nil
+	}
+	return cli.ResolveHelmAuthSecret(req.Deployment.Name), nil
+}
+
+func (p *sealedCredentialProvider) ProduceRepositorySecret(w io.Writer, req *CredentialRequest) error {
+	return cli.ProduceSecretYaml(w, req.Deployment, req.ProjectAuth, cli.SecretsNamespace, req.HelmInfo)
+}
+
+func (p *sealedCredentialProvider) Refresh(req *CredentialRequest) {}
+
+// noCredentialProvider handles public repositories
+type noCredentialProvider struct{}
+
+func (p *noCredentialProvider) ResolveCredentials(req *CredentialRequest) (cli.ProjectAuth, error) {
+	var pa cli.ProjectAuth
+	pa.Type = "NOCREDS"
+	pa.Url = req.Deployment.ArtUri
+	return pa, nil
+}
+
+func (p *noCredentialProvider) ProduceRepositorySecret(w io.Writer, req *CredentialRequest) error {
+	if cli.ResolveSecretBackend(req.HelmInfo) == cli.SecretBackendSealed {
+		return cli.ProduceSecretYaml(w, req.Deployment, req.ProjectAuth, cli.SecretsNamespace, req.HelmInfo)
+	}
+	return cli.ProduceNoCredSecretYaml(w, req.Deployment, req.ProjectAuth, cli.SecretsNamespace, req.HelmInfo)
+}
+
+func (p *noCredentialProvider) Refresh(req *CredentialRequest) {}
+
+// registrySecretCredentialProvider handles credentials from a secret configured for the registry in registry configuration
+type registrySecretCredentialProvider struct{}
+
+func (p *registrySecretCredentialProvider) ResolveCredentials(req *CredentialRequest) (cli.ProjectAuth, error) {
+	pa := cli.ResolveHelmAuthSecret(req.HelmInfo.CredentialsSecret)
+	pa.Type = "REGISTRY_SECRET"
+	if len(pa.Login) < 1 && len(pa.Password) < 1 {
+		return pa, errors.New("registry credentials secret " + req.HelmInfo.CredentialsSecret + " not found or empty")
+	}
+	return pa, nil
+}
+
+func (p *registrySecretCredentialProvider) ProduceRepositorySecret(w io.Writer, req *CredentialRequest) error {
+	pa, err := p.ResolveCredentials(req)
+	if err == nil {
+		err = cli.ProducePlainSecretYaml(w, req.Deployment, pa, cli.SecretsNamespace, req.HelmInfo)
+	}
+	return err
+}
+
+func (p *registrySecretCredentialProvider) Refresh(req *CredentialRequest) {}
+
+// externalSecretCredentialProvider handles credentials synced by External Secrets Operator from an external store, i.e. HashiCorp Vault
+type externalSecretCredentialProvider struct{}
+
+func (p *externalSecretCredentialProvider) ResolveCredentials(req *CredentialRequest) (cli.ProjectAuth, error) {
+	pa := cli.ResolveHelmAuthSecret(req.Deployment.Name)
+	if len(pa.Login) < 1 && len(pa.Password) < 1 {
+		return pa, errors.New("no credentials synced from external store key " + cli.ExternalSecretRemoteKey(req.HelmInfo))
+	}
+	return pa, nil
+}
+
+func (p *externalSecretCredentialProvider) ProduceRepositorySecret(w io.Writer, req *CredentialRequest) error {
+	return cli.ProduceExternalSecretYaml(w, req.Deployment, cli.SecretsNamespace, req.HelmInfo)
+}
+
+func (p *externalSecretCredentialProvider) Refresh(req *CredentialRequest) {}
@@ -0,0 +1,79 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package controller
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/relizaio/reliza-cd/cli"
+)
+
+type fakeCredentialProvider struct{}
+
+func (p *fakeCredentialProvider) ResolveCredentials(req *CredentialRequest) (cli.ProjectAuth, error) {
+	return cli.ProjectAuth{Login: "robot", Password: "token", Type: req.ProjectAuth.Type}, nil
+}
+
+func (p *fakeCredentialProvider) ProduceRepositorySecret(w io.Writer, req *CredentialRequest) error {
+	return nil
+}
+
+func (p *fakeCredentialProvider) Refresh(req *CredentialRequest) {}
+
+func TestRegisterCredentialProvider(t *testing.T) {
+	_, err := getCredentialProvider("HARBOR_ROBOT")
+	if err == nil {
+		t.Fatal("expected error for unregistered auth type")
+	}
+	RegisterCredentialProvider("HARBOR_ROBOT", &fakeCredentialProvider{})
+	defer delete(credentialProviders, "HARBOR_ROBOT")
+
+	provider, err := getCredentialProvider("HARBOR_ROBOT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa, _ := provider.ResolveCredentials(&CredentialRequest{ProjectAuth: cli.ProjectAuth{Type: "HARBOR_ROBOT"}})
+	if pa.Login != "robot" || pa.Type != "HARBOR_ROBOT" {
+		t.Fatalf("unexpected credentials %+v", pa)
+	}
+}
+
+func TestTokenCredentialProviderRefresh(t *testing.T) {
+	exchangeCount := 0
+	provider := tokenCredentialProvider{exchange: func(pa *cli.ProjectAuth, registryHost string) (registryToken, error) {
+		exchangeCount++
+		return registryToken{Login: "AWS", Password: "token", ExpiresAt: time.Now().Add(12 * time.Hour)}, nil
+	}}
+	req := CredentialRequest{
+		Deployment:  &cli.RelizaDeployment{Name: "ns---bundle", ArtUri: "123456789012.dkr.ecr.us-east-1.amazonaws.com/app"},
+		ProjectAuth: cli.ProjectAuth{Type: "ECR"},
+		HelmInfo:    cli.HelmRepoInfo{RepoHost: "123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+	}
+	defer provider.Refresh(&req)
+
+	provider.ResolveCredentials(&req)
+	provider.ResolveCredentials(&req)
+	if exchangeCount != 1 {
+		t.Fatalf("expected cached token to be reused, exchanged %d times", exchangeCount)
+	}
+	provider.Refresh(&req)
+	pa, err := provider.ResolveCredentials(&req)
+	if err != nil || exchangeCount != 2 || pa.Password != "token" {
+		t.Fatalf("expected token to be exchanged again after refresh, exchanged %d times, err %v", exchangeCount, err)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package controller
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/relizaio/reliza-cd/cli"
+)
+
+const (
+	// GAR accepts OAuth access tokens with this fixed username
+	garTokenLogin = "oauth2accesstoken"
+	gcpScope      = "https://www.googleapis.com/auth/cloud-platform"
+	gcpJwtGrant   = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+type gcpServiceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+}
+
+// garTokenProvider obtains Google Artifact Registry access tokens. Service account JSON key is used when provided as password,
+// otherwise token of the workload identity service account is requested from the metadata server.
+type garTokenProvider struct {
+	MetadataUrl string
+	HttpClient  *http.Client
+}
+
+var garTokens = garTokenProvider{
+	MetadataUrl: "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token",
+	HttpClient:  registryAuthHttpClient,
+}
+
+func (p *garTokenProvider) getToken(pa *cli.ProjectAuth) (registryToken, error) {
+	var token registryToken
+	var tokenResp oauthTokenResponse
+	var err error
+	if len(pa.Password) > 0 {
+		tokenResp, err = p.getServiceAccountKeyToken(pa.Password)
+	} else {
+		tokenResp, err = p.getMetadataToken()
+	}
+	if err != nil {
+		return token, err
+	}
+	if len(tokenResp.AccessToken) < 1 {
+		return token, errors.New("GAR token request returned no access token")
+	}
+	token.Login = garTokenLogin
+	token.Password = tokenResp.AccessToken
+	token.ExpiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	return token, nil
+}
+
+func (p *garTokenProvider) getServiceAccountKeyToken(serviceAccountJson string) (oauthTokenResponse, error) {
+	var saKey gcpServiceAccountKey
+	err := json.Unmarshal([]byte(serviceAccountJson), &saKey)
+	if err != nil {
+		return oauthTokenResponse{}, errors.New("failed to parse GAR service account key: " + err.Error())
+	}
+	if len(saKey.TokenUri) < 1 {
+		saKey.TokenUri = "https://oauth2.googleapis.com/token"
+	}
+	assertion, err := signServiceAccountJwt(saKey, time.Now())
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", gcpJwtGrant)
+	form.Set("assertion", assertion)
+	return postTokenForm(p.HttpClient, saKey.TokenUri, form)
+}
+
+func (p *garTokenProvider) getMetadataToken() (oauthTokenResponse, error) {
+	var tokenResp oauthTokenResponse
+	req, err := http.NewRequest(http.MethodGet, p.MetadataUrl, nil)
+	if err != nil {
+		return tokenResp, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := p.HttpClient.Do(req)
+	if err != nil {
+		return tokenResp, errors.New("no GAR service account key provided and metadata server is not available: " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return tokenResp, errors.New("metadata server returned " + resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	return tokenResp, err
+}
+
+// signServiceAccountJwt produces RS256-signed JWT assertion for OAuth JWT bearer grant
+func signServiceAccountJwt(saKey gcpServiceAccountKey, now time.Time) (string, error) {
+	pemBlock, _ := pem.Decode([]byte(saKey.PrivateKey))
+	if pemBlock == nil {
+		return "", errors.New("GAR service account key has no PEM private key")
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+	if err != nil {
+		return "", err
+	}
+	rsaKey, isRsa := parsedKey.(*rsa.PrivateKey)
+	if !isRsa {
+		return "", errors.New("GAR service account private key is not an RSA key")
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   saKey.ClientEmail,
+		"scope": gcpScope,
+		"aud":   saKey.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,168 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/relizaio/reliza-cd/cli"
+	"github.com/relizaio/reliza-cd/utils"
+)
+
+// registryToken is a short-lived registry credential obtained by exchanging long-lived cloud credentials
+type registryToken struct {
+	Login     string
+	Password  string
+	ExpiresAt time.Time
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+const (
+	// tokens are refreshed when they are due to expire within this margin
+	registryTokenRefreshMargin = 15 * time.Minute
+)
+
+var (
+	registryAuthHttpClient = &http.Client{Timeout: 30 * time.Second}
+	registryTokenCache     = make(map[string]registryToken)
+)
+
+// tokenCredentialProvider handles token-based auth types (ECR, ACR, GAR). Cloud credentials from the Hub are exchanged for registry tokens,
+// which are cached per registry and credential and are only exchanged again when due to expire, so that cloud credentials are not resolved on every loop.
+type tokenCredentialProvider struct {
+	exchange func(pa *cli.ProjectAuth, registryHost string) (registryToken, error)
+}
+
+func (p *tokenCredentialProvider) ResolveCredentials(req *CredentialRequest) (cli.ProjectAuth, error) {
+	rd := req.Deployment
+	registryHost := strings.Split(req.HelmInfo.RepoHost, "/")[0]
+	cacheKey := registryTokenCacheKey(req.ProjectAuth.Type, registryHost, &req.ProjectAuth)
+	token, isCached := getCachedRegistryToken(cacheKey, time.Now())
+	if !isCached {
+		credsPa := req.ProjectAuth
+		credsPa.Url = rd.ArtUri
+		if !cli.IsLocalSecretsBackend() && (len(req.ProjectAuth.Login) > 0 || len(req.ProjectAuth.Password) > 0) {
+			// credentials sealed by the Hub are unsealed in the cluster, without credentials workload identity of reliza-cd pod is used
+			authTypeLower := strings.ToLower(req.ProjectAuth.Type)
+			credsSecretName := authTypeLower + "-" + rd.Name
+			credsSecretPath := "workspace/" + rd.Name + "/" + authTypeLower + "reposecret.yaml"
+			credsSecretFile := utils.CreateFile(credsSecretPath)
+			err := cli.ProduceRegistryCredentialsSecretYaml(credsSecretFile, rd, req.ProjectAuth, cli.SecretsNamespace, credsSecretName)
+			credsSecretFile.Close()
+			if err != nil {
+				return cli.ProjectAuth{}, err
+			}
+			err = cli.KubectlApply(credsSecretPath)
+			if err != nil {
+				return cli.ProjectAuth{}, err
+			}
+			err = cli.WaitUntilSecretCreated(credsSecretName, cli.SecretsNamespace)
+			if err != nil {
+				return cli.ProjectAuth{}, err
+			}
+			credsPa = cli.ResolveHelmAuthSecret(credsSecretName)
+		}
+		var err error
+		token, err = p.exchange(&credsPa, registryHost)
+		if err != nil {
+			return cli.ProjectAuth{}, err
+		}
+		registryTokenCache[cacheKey] = token
+		sugar.Debugw("Obtained registry token", "authType", req.ProjectAuth.Type, "registry", registryHost, "expiresAt", token.ExpiresAt)
+	}
+	var tokenPa cli.ProjectAuth
+	tokenPa.Login = token.Login
+	tokenPa.Password = token.Password
+	tokenPa.Type = req.ProjectAuth.Type
+	tokenPa.Url = rd.ArtUri
+	return tokenPa, nil
+}
+
+func (p *tokenCredentialProvider) ProduceRepositorySecret(w io.Writer, req *CredentialRequest) error {
+	tokenPa, err := p.ResolveCredentials(req)
+	if err == nil {
+		err = cli.ProducePlainSecretYaml(w, req.Deployment, tokenPa, cli.SecretsNamespace, req.HelmInfo)
+	}
+	return err
+}
+
+func (p *tokenCredentialProvider) Refresh(req *CredentialRequest) {
+	registryHost := strings.Split(req.HelmInfo.RepoHost, "/")[0]
+	delete(registryTokenCache, registryTokenCacheKey(req.ProjectAuth.Type, registryHost, &req.ProjectAuth))
+}
+
+// registryTokenCacheKey identifies token by auth type, registry and credentials as received from the Hub
+func registryTokenCacheKey(authType string, registryHost string, pa *cli.ProjectAuth) string {
+	digest := sha256.Sum256([]byte(authType + "|" + registryHost + "|" + pa.Login + "|" + pa.Password))
+	return hex.EncodeToString(digest[:])
+}
+
+func getCachedRegistryToken(cacheKey string, now time.Time) (registryToken, bool) {
+	token, isCached := registryTokenCache[cacheKey]
+	if isCached && now.Add(registryTokenRefreshMargin).Before(token.ExpiresAt) {
+		return token, true
+	}
+	return registryToken{}, false
+}
+
+// postTokenForm posts form to a token endpoint and decodes OAuth token response
+func postTokenForm(httpClient *http.Client, tokenUrl string, form url.Values) (oauthTokenResponse, error) {
+	var tokenResp oauthTokenResponse
+	resp, err := httpClient.PostForm(tokenUrl, form)
+	if err != nil {
+		return tokenResp, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return tokenResp, errors.New("token endpoint " + tokenUrl + " returned " + resp.Status + ": " + string(body))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	return tokenResp, err
+}
+
+// expiryFromJwt reads exp claim of a JWT without verifying it, returns fallback if token is not a parsable JWT
+func expiryFromJwt(token string, fallback time.Time) time.Time {
+	tokenParts := strings.Split(token, ".")
+	if len(tokenParts) != 3 {
+		return fallback
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(tokenParts[1])
+	if err != nil {
+		return fallback
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return fallback
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,153 @@
+/*
+The MIT License (MIT)
+
+Copyright (c) 2022-2026 Reliza Incorporated (Reliza (tm), https://reliza.io)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package controller
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relizaio/reliza-cd/cli"
+)
+
+func TestAcrTokenExchange(t *testing.T) {
+	t.Setenv("AZURE_TENANT_ID", "test-tenant")
+	fakeAzure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/test-tenant/oauth2/v2.0/token":
+			if r.Form.Get("client_id") != "sp-id" || r.Form.Get("client_secret") != "sp-secret" || r.Form.Get("scope") != acrAadScope {
+				http.Error(w, "bad client credentials", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token": "aad-token", "expires_in": 3600}`))
+		case "/oauth2/exchange":
+			if r.Form.Get("access_token") != "aad-token" || r.Form.Get("tenant") != "test-tenant" || r.Form.Get("service") != r.Host {
+				http.Error(w, "bad exchange", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"refresh_token": "acr-refresh-token"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer fakeAzure.Close()
+
+	provider := acrTokenProvider{AuthorityUrl: fakeAzure.URL, HttpClient: fakeAzure.Client()}
+	registryHost := strings.TrimPrefix(fakeAzure.URL, "https://")
+	token, err := provider.getToken(&cli.ProjectAuth{Login: "sp-id", Password: "sp-secret"}, registryHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Login != acrTokenLogin || token.Password != "acr-refresh-token" || token.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	_, err = provider.getToken(&cli.ProjectAuth{Login: "sp-id", Password: "wrong"}, registryHost)
+	if err == nil {
+		t.Fatal("expected error for rejected client credentials")
+	}
+}
+
+func TestGarServiceAccountKeyToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8Key, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	fakeGoogle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		jwtParts := strings.Split(r.Form.Get("assertion"), ".")
+		if r.Form.Get("grant_type") != gcpJwtGrant || len(jwtParts) != 3 {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(jwtParts[2])
+		digest := sha256.Sum256([]byte(jwtParts[0] + "." + jwtParts[1]))
+		if rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"access_token": "gar-access-token", "expires_in": 3599}`))
+	}))
+	defer fakeGoogle.Close()
+
+	saKey, _ := json.Marshal(gcpServiceAccountKey{
+		ClientEmail: "cd@project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Key})),
+		TokenUri:    fakeGoogle.URL + "/token",
+	})
+	provider := garTokenProvider{HttpClient: fakeGoogle.Client()}
+	token, err := provider.getToken(&cli.ProjectAuth{Login: "_json_key", Password: string(saKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Login != garTokenLogin || token.Password != "gar-access-token" {
+		t.Fatalf("unexpected token %+v", token)
+	}
+}
+
+func TestGarMetadataToken(t *testing.T) {
+	fakeMetadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing metadata header", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"access_token": "workload-token", "expires_in": 3599}`))
+	}))
+	defer fakeMetadata.Close()
+
+	provider := garTokenProvider{MetadataUrl: fakeMetadata.URL, HttpClient: fakeMetadata.Client()}
+	token, err := provider.getToken(&cli.ProjectAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Password != "workload-token" {
+		t.Fatalf("unexpected token %+v", token)
+	}
+}
+
+func TestRegistryTokenCacheRefreshesNearExpiry(t *testing.T) {
+	now := time.Now()
+	pa := cli.ProjectAuth{Login: "sealed-login", Password: "sealed-password"}
+	cacheKey := registryTokenCacheKey("ECR", "123456789012.dkr.ecr.us-east-1.amazonaws.com", &pa)
+	registryTokenCache[cacheKey] = registryToken{Login: "AWS", Password: "token", ExpiresAt: now.Add(12 * time.Hour)}
+	defer delete(registryTokenCache, cacheKey)
+
+	token, isCached := getCachedRegistryToken(cacheKey, now)
+	if !isCached || token.Password != "token" {
+		t.Fatalf("expected valid cached token, got %+v", token)
+	}
+	_, isCached = getCachedRegistryToken(cacheKey, now.Add(12*time.Hour-registryTokenRefreshMargin/2))
+	if isCached {
+		t.Fatal("expected token due to expire to be refreshed")
+	}
+	otherPa := cli.ProjectAuth{Login: "sealed-login", Password: "rotated-password"}
+	_, isCached = getCachedRegistryToken(registryTokenCacheKey("ECR", "123456789012.dkr.ecr.us-east-1.amazonaws.com", &otherPa), now)
+	if isCached {
+		t.Fatal("expected rotated credentials to miss the cache")
+	}
+}